@@ -4,6 +4,8 @@ import (
 	"os"
 
 	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/errors"
+	"github.com/replicate/cog/pkg/global"
 	"github.com/replicate/cog/pkg/image"
 	"github.com/replicate/cog/pkg/util/console"
 	"github.com/spf13/cobra"
@@ -11,16 +13,23 @@ import (
 
 var buildTag string
 var buildProgressOutput string
+var buildSSH []string
+var buildLocked bool
+var buildReproducible bool
+var buildCacheFrom []string
+var buildCacheTo []string
 
 func newBuildCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "build",
 		Short: "Build an image from cog.yaml",
 		Args:  cobra.NoArgs,
-		RunE:  buildCommand,
+		RunE:  withJSONResult(buildCommand),
 	}
-	addBuildProgressOutputFlag(cmd)
+	addBuildFlags(cmd)
+	addCacheFlags(cmd)
 	cmd.Flags().StringVarP(&buildTag, "tag", "t", "", "A name for the built image in the form 'repository:tag'")
+	cmd.Flags().BoolVar(&buildReproducible, "reproducible", false, "Build from the base image digests recorded in "+global.LockFilename+" or a previous build of the image, instead of the current ones")
 	return cmd
 }
 
@@ -38,19 +47,42 @@ func buildCommand(cmd *cobra.Command, args []string) error {
 		imageName = config.DockerImageName(projectDir)
 	}
 
-	if err := image.Build(cfg, projectDir, imageName, buildProgressOutput); err != nil {
-		return err
+	lifecycle := newContainerLifecycle()
+	defer lifecycle.Close()
+
+	if err := image.Build(lifecycle.ctx, cfg, projectDir, imageName, buildOptions()); err != nil {
+		return lifecycle.Err(errors.BuildFailed(err))
 	}
 
 	console.Infof("\nImage built as %s", imageName)
 
-	return nil
+	return lifecycle.Err(recordImage(lifecycle.ctx, imageName, false))
 }
 
-func addBuildProgressOutputFlag(cmd *cobra.Command) {
+func addBuildFlags(cmd *cobra.Command) {
 	defaultOutput := "auto"
 	if os.Getenv("TERM") == "dumb" {
 		defaultOutput = "plain"
 	}
 	cmd.Flags().StringVar(&buildProgressOutput, "progress", defaultOutput, "Set type of build progress output, 'auto' (default), 'tty' or 'plain'")
+	cmd.Flags().StringArrayVar(&buildSSH, "ssh", []string{}, "SSH agent socket or keys to forward to the build, for git+ssh Python packages, in the form 'default' or 'id=/path/to/key'. Can be repeated")
+	cmd.Flags().BoolVar(&buildLocked, "locked", false, "Fail if "+global.LockFilename+" doesn't exist or "+global.ConfigFilename+" or the files it refers to have changed since it was made")
+}
+
+// addCacheFlags adds the flags for the build cache, which is only used when building the
+// image to push
+func addCacheFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&buildCacheFrom, "cache-from", []string{}, "Import the build cache from here. Either 'registry', 'local', 'none', or a buildx cache spec like 'type=registry,ref=r8.im/user/model:buildcache'. Replaces build.cache in "+global.ConfigFilename)
+	cmd.Flags().StringArrayVar(&buildCacheTo, "cache-to", []string{}, "Export the build cache to here, in the same form as --cache-from. Replaces build.cache in "+global.ConfigFilename)
+}
+
+func buildOptions() image.BuildOptions {
+	return image.BuildOptions{
+		ProgressOutput: buildProgressOutput,
+		SSH:            buildSSH,
+		Locked:         buildLocked,
+		Reproducible:   buildReproducible,
+		CacheFrom:      buildCacheFrom,
+		CacheTo:        buildCacheTo,
+	}
 }
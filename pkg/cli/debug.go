@@ -1,13 +1,11 @@
 package cli
 
 import (
-	"fmt"
-
 	"github.com/spf13/cobra"
 
 	"github.com/replicate/cog/pkg/config"
-	"github.com/replicate/cog/pkg/dockerfile"
 	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/image"
 	"github.com/replicate/cog/pkg/util/console"
 )
 
@@ -15,8 +13,9 @@ func newDebugCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:    "debug",
 		Hidden: true,
-		RunE:   cmdDockerfile,
+		RunE:   withJSONResult(cmdDockerfile),
 	}
+	addBuildFlags(cmd)
 
 	debug := &cobra.Command{
 		Use:    "debug",
@@ -30,23 +29,25 @@ func newDebugCommand() *cobra.Command {
 }
 
 func cmdDockerfile(cmd *cobra.Command, args []string) error {
-	config, projectDir, err := config.GetConfig(projectDirFlag)
+	cfg, projectDir, err := config.GetConfig(projectDirFlag)
 	if err != nil {
 		return err
 	}
 
-	generator, err := dockerfile.NewGenerator(config, projectDir)
-	if err != nil {
-		return fmt.Errorf("Error creating Dockerfile generator: %w", err)
+	imageName := cfg.Image
+	if imageName == "" {
+		imageName = config.DockerImageName(projectDir)
 	}
-	defer func() {
-		if err := generator.Cleanup(); err != nil {
-			console.Warnf("Error cleaning up after build: %v", err)
-		}
-	}()
-	out, err := generator.Generate()
+	lifecycle := newContainerLifecycle()
+	defer lifecycle.Close()
+
+	out, err := image.Dockerfile(lifecycle.ctx, cfg, projectDir, imageName, buildOptions())
 	if err != nil {
-		return err
+		return lifecycle.Err(err)
+	}
+	if console.IsMachine() {
+		cmdResult.Dockerfile = out
+		return nil
 	}
 	console.Output(out)
 	return nil
@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/go-units"
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var (
+	labelVersion = global.LabelNamespace + "version"
+	labelConfig  = global.LabelNamespace + "config"
+)
+
+// cogImage is an image built by Cog, in the output of `cog images --format json`
+type cogImage struct {
+	ID         string    `json:"id"`
+	Tags       []string  `json:"tags"`
+	ProjectDir string    `json:"project_dir"`
+	CogVersion string    `json:"cog_version"`
+	Base       bool      `json:"base"`
+	Size       int64     `json:"size"`
+	CreatedAt  time.Time `json:"created_at"`
+	AgeSeconds float64   `json:"age_seconds"`
+}
+
+func newImagesCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "images",
+		Short: "List Docker images built by Cog",
+		Long: `List Docker images built by Cog, newest first.
+
+This includes the base images Cog builds for 'cog run' and 'cog predict', and old
+builds that are no longer tagged. Use 'cog prune' to remove the ones you don't need.`,
+		RunE: withJSONResult(cmdImages),
+		Args: cobra.NoArgs,
+	}
+
+	return cmd
+}
+
+func cmdImages(cmd *cobra.Command, args []string) error {
+	images, err := listCogImages(time.Now())
+	if err != nil {
+		return err
+	}
+
+	cmdResult.Images = &images
+	if console.IsMachine() {
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(w, "IMAGE\tIMAGE ID\tPROJECT\tCOG VERSION\tSIZE\tCREATED")
+	for _, img := range images {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s ago\n",
+			imageTags(img),
+			shortID(strings.TrimPrefix(img.ID, "sha256:")),
+			valueOrDash(img.ProjectDir),
+			valueOrDash(img.CogVersion),
+			units.HumanSize(float64(img.Size)),
+			units.HumanDuration(time.Duration(img.AgeSeconds)*time.Second),
+		)
+	}
+	return w.Flush()
+}
+
+// listCogImages returns the images with Cog's version label, newest first
+func listCogImages(now time.Time) ([]cogImage, error) {
+	summaries, err := docker.ImageList(labelVersion)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list images: %w", err)
+	}
+	images := []cogImage{}
+	for _, summary := range summaries {
+		images = append(images, cogImageFromSummary(summary, now))
+	}
+	sort.SliceStable(images, func(i, j int) bool {
+		return images[i].CreatedAt.After(images[j].CreatedAt)
+	})
+	return images, nil
+}
+
+func cogImageFromSummary(summary types.ImageSummary, now time.Time) cogImage {
+	img := cogImage{
+		ID:         summary.ID,
+		Tags:       []string{},
+		ProjectDir: summary.Labels[docker.LabelProjectDir],
+		CogVersion: summary.Labels[labelVersion],
+		// Only images built with `cog build` have their config in a label
+		Base: summary.Labels[labelConfig] == "",
+		Size: summary.Size,
+	}
+	for _, tag := range summary.RepoTags {
+		// Docker lists untagged images with the tag <none>:<none>
+		if tag != "<none>:<none>" {
+			img.Tags = append(img.Tags, tag)
+		}
+	}
+	sort.Strings(img.Tags)
+	createdAt := time.Unix(summary.Created, 0)
+	img.CreatedAt = createdAt.UTC()
+	img.AgeSeconds = now.Sub(createdAt).Round(time.Second).Seconds()
+	return img
+}
+
+func imageTags(img cogImage) string {
+	if len(img.Tags) == 0 {
+		return "<none>"
+	}
+	return strings.Join(img.Tags, ", ")
+}
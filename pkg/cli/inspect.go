@@ -0,0 +1,189 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var inspectJSON bool
+
+// inspectResult is the output of `cog inspect --json`
+type inspectResult struct {
+	Image        string                `json:"image"`
+	ID           string                `json:"id,omitempty"`
+	Remote       bool                  `json:"remote"`
+	Created      string                `json:"created,omitempty"`
+	CogVersion   string                `json:"cog_version"`
+	BaseImage    string                `json:"base_image,omitempty"`
+	RuntimeImage string                `json:"runtime_image,omitempty"`
+	Config       *config.Config        `json:"config"`
+	Inputs       []*predict.InputField `json:"inputs"`
+	Output       string                `json:"output,omitempty"`
+	Schema       *openapi3.T           `json:"openapi_schema,omitempty"`
+}
+
+func newInspectCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "inspect <image>",
+		Short: "Show how a model image was built and what its inputs and outputs are",
+		Long: `Show how a model image was built and what its inputs and outputs are.
+
+This reads the labels Cog adds to images when it builds them: the version of Cog,
+the build configuration, and the inputs and output of the model. If the image isn't
+available locally, it is read from its registry without pulling it.`,
+		Args: cobra.ExactArgs(1),
+		RunE: withJSONResult(cmdInspect),
+	}
+	cmd.Flags().BoolVar(&inspectJSON, "json", false, "Output the model as a JSON object")
+
+	return cmd
+}
+
+func cmdInspect(cmd *cobra.Command, args []string) error {
+	lifecycle := newContainerLifecycle()
+	defer lifecycle.Close()
+
+	model, err := image.Inspect(lifecycle.ctx, args[0])
+	if err != nil {
+		return lifecycle.Err(err)
+	}
+	result, err := inspectResultFromModel(model)
+	if err != nil {
+		return err
+	}
+
+	if inspectJSON {
+		return writeJSONFlagOutput(result)
+	}
+	cmdResult.Image = result.Image
+	cmdResult.Model = result
+	if console.IsMachine() {
+		return nil
+	}
+	return printInspectResult(os.Stdout, result)
+}
+
+func inspectResultFromModel(model *image.Model) (*inspectResult, error) {
+	result := &inspectResult{
+		Image:        model.Image,
+		ID:           model.ID,
+		Remote:       model.Remote,
+		Created:      model.Created,
+		CogVersion:   model.CogVersion,
+		BaseImage:    model.BaseImage,
+		RuntimeImage: model.RuntimeImage,
+		Config:       model.Config,
+		Inputs:       []*predict.InputField{},
+		Schema:       model.Schema,
+	}
+	if model.Schema != nil {
+		inputs, err := predict.InputFields(model.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read the inputs of %s: %w", model.Image, err)
+		}
+		result.Inputs = inputs
+		result.Output = predict.OutputTypeName(model.Schema)
+	}
+	return result, nil
+}
+
+func printInspectResult(out io.Writer, result *inspectResult) error {
+	build := result.Config.Build
+	w := tabwriter.NewWriter(out, 0, 8, 3, ' ', 0)
+	fmt.Fprintf(w, "Image:\t%s\n", result.Image)
+	if result.Remote {
+		fmt.Fprintf(w, "Image ID:\t- (not pulled)\n")
+	} else {
+		fmt.Fprintf(w, "Image ID:\t%s\n", valueOrDash(result.ID))
+	}
+	fmt.Fprintf(w, "Created:\t%s\n", valueOrDash(result.Created))
+	fmt.Fprintf(w, "Cog version:\t%s\n", valueOrDash(result.CogVersion))
+	if result.BaseImage != "" {
+		fmt.Fprintf(w, "Base image:\t%s\n", result.BaseImage)
+	}
+	if result.RuntimeImage != "" {
+		fmt.Fprintf(w, "Runtime image:\t%s\n", result.RuntimeImage)
+	}
+	fmt.Fprintf(w, "Python:\t%s\n", valueOrDash(build.PythonVersion))
+	if build.GPU {
+		fmt.Fprintf(w, "GPU:\tyes\n")
+		fmt.Fprintf(w, "CUDA:\t%s\n", valueOrDash(build.CUDA))
+		fmt.Fprintf(w, "CuDNN:\t%s\n", valueOrDash(build.CuDNN))
+	} else {
+		fmt.Fprintf(w, "GPU:\tno\n")
+	}
+	if len(build.PythonPackages) > 0 {
+		fmt.Fprintf(w, "Python packages:\t%s\n", strings.Join(build.PythonPackages, ", "))
+	}
+	if len(build.SystemPackages) > 0 {
+		fmt.Fprintf(w, "System packages:\t%s\n", strings.Join(build.SystemPackages, ", "))
+	}
+	fmt.Fprintf(w, "Predictor:\t%s\n", valueOrDash(result.Config.Predict))
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if result.Schema == nil {
+		return nil
+	}
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Inputs:")
+	w = tabwriter.NewWriter(out, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(w, "  NAME\tTYPE\tDEFAULT\tALLOWED VALUES\tDESCRIPTION")
+	for _, input := range result.Inputs {
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\n",
+			input.Name,
+			input.TypeName(),
+			inputDefault(input),
+			valueOrDash(inputConstraints(input)),
+			valueOrDash(input.Description),
+		)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "Output: %s\n", valueOrDash(result.Output))
+	return nil
+}
+
+func inputDefault(input *predict.InputField) string {
+	if input.Required {
+		return "(required)"
+	}
+	if input.Default == nil {
+		return "-"
+	}
+	return predict.FormatInputValue(input.Default)
+}
+
+// inputConstraints describes the values an input can be set to, e.g. "1 to 10"
+func inputConstraints(input *predict.InputField) string {
+	if len(input.Choices) > 0 {
+		choices := []string{}
+		for _, choice := range input.Choices {
+			choices = append(choices, predict.FormatInputValue(choice))
+		}
+		return strings.Join(choices, ", ")
+	}
+	switch {
+	case input.Minimum != nil && input.Maximum != nil:
+		return fmt.Sprintf("%v to %v", *input.Minimum, *input.Maximum)
+	case input.Minimum != nil:
+		return fmt.Sprintf(">= %v", *input.Minimum)
+	case input.Maximum != nil:
+		return fmt.Sprintf("<= %v", *input.Maximum)
+	}
+	return ""
+}
@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/image"
+)
+
+func TestPrintInspectResult(t *testing.T) {
+	schema, err := openapi3.NewLoader().LoadFromData([]byte(`{
+		"openapi": "3.0.2",
+		"info": {"title": "Cog", "version": "0.1.0"},
+		"paths": {},
+		"components": {"schemas": {
+			"Input": {"type": "object", "required": ["prompt"], "properties": {
+				"prompt": {"type": "string", "description": "Text to complete", "x-order": 0},
+				"steps": {"type": "integer", "default": 50, "minimum": 1, "x-order": 1}
+			}},
+			"Response": {"type": "object", "properties": {"output": {"type": "string"}}}
+		}}
+	}`))
+	require.NoError(t, err)
+	cfg := config.DefaultConfig()
+	cfg.Build.GPU = true
+	cfg.Build.CUDA = "11.6"
+	cfg.Build.CuDNN = "8"
+	cfg.Predict = "predict.py:Predictor"
+
+	result, err := inspectResultFromModel(&image.Model{
+		Image:      "r8.im/user/model",
+		Remote:     true,
+		CogVersion: "0.5.0",
+		Config:     cfg,
+		Schema:     schema,
+	})
+	require.NoError(t, err)
+	var out bytes.Buffer
+	require.NoError(t, printInspectResult(&out, result))
+
+	require.Contains(t, out.String(), "Image ID:      - (not pulled)\n")
+	require.Contains(t, out.String(), "CUDA:          11.6\n")
+	require.Contains(t, out.String(), "  prompt   string    (required)   -                Text to complete\n")
+	require.Contains(t, out.String(), "  steps    integer   50           >= 1             -\n")
+	require.Contains(t, out.String(), "Output: string\n")
+}
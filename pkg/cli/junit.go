@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"time"
+)
+
+// JUnit XML, in the form CI systems read test reports in
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Error     *junitProblem `xml:"error,omitempty"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// junitReport converts the results of 'cog test' to a JUnit report. Examples with the
+// wrong output are failures, and examples where the prediction failed are errors.
+func junitReport(results []*exampleResult, duration time.Duration) *junitTestSuites {
+	suite := junitTestSuite{
+		Name:  "cog",
+		Tests: len(results),
+		Time:  fmt.Sprintf("%.3f", duration.Seconds()),
+		Cases: []junitTestCase{},
+	}
+	for _, result := range results {
+		testCase := junitTestCase{
+			Name:      result.Name,
+			ClassName: "examples",
+			Time:      fmt.Sprintf("%.3f", result.DurationSeconds),
+		}
+		switch result.Status {
+		case exampleStatusFailed:
+			suite.Failures++
+			testCase.Failure = &junitProblem{Message: result.Message, Text: result.Message}
+		case exampleStatusError:
+			suite.Errors++
+			testCase.Error = &junitProblem{Message: result.Message, Text: result.Message}
+		}
+		suite.Cases = append(suite.Cases, testCase)
+	}
+	return &junitTestSuites{Suites: []junitTestSuite{suite}}
+}
+
+func writeJUnitReport(path string, results []*exampleResult, duration time.Duration) error {
+	data, err := xml.MarshalIndent(junitReport(results, duration), "", "  ")
+	if err != nil {
+		return fmt.Errorf("Failed to convert results to JUnit XML: %w", err)
+	}
+	data = append([]byte(xml.Header), data...)
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("Failed to write %s: %w", path, err)
+	}
+	return nil
+}
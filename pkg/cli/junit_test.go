@@ -0,0 +1,31 @@
+package cli
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJUnitReport(t *testing.T) {
+	report := junitReport([]*exampleResult{
+		{Name: "cat", Status: exampleStatusPassed, DurationSeconds: 1.5},
+		{Name: "dog", Status: exampleStatusFailed, Message: `Expected output "dog", but got "cat"`, DurationSeconds: 1},
+		{Name: "example 3", Status: exampleStatusError, Message: "Prediction failed: CUDA out of memory", DurationSeconds: 0.25},
+	}, 3*time.Second)
+
+	data, err := xml.MarshalIndent(report, "", "  ")
+	require.NoError(t, err)
+	require.Equal(t, `<testsuites>
+  <testsuite name="cog" tests="3" failures="1" errors="1" time="3.000">
+    <testcase name="cat" classname="examples" time="1.500"></testcase>
+    <testcase name="dog" classname="examples" time="1.000">
+      <failure message="Expected output &#34;dog&#34;, but got &#34;cat&#34;">Expected output &#34;dog&#34;, but got &#34;cat&#34;</failure>
+    </testcase>
+    <testcase name="example 3" classname="examples" time="0.250">
+      <error message="Prediction failed: CUDA out of memory">Prediction failed: CUDA out of memory</error>
+    </testcase>
+  </testsuite>
+</testsuites>`, string(data))
+}
@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/errors"
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/shell"
+)
+
+const (
+	containerStopTimeout = 10 * time.Second
+	containerKillTimeout = 5 * time.Second
+)
+
+// containerLifecycle makes sure the containers a command starts are cleaned up when it
+// exits, including when it is interrupted with Ctrl-C or SIGTERM.
+//
+// The first signal cancels ctx, which stops any builds and predictions in progress, then
+// the containers are stopped when Close is called. A second signal kills them and exits
+// without waiting.
+type containerLifecycle struct {
+	ctx         context.Context
+	stopSignals func()
+
+	mu         sync.Mutex
+	containers []string
+}
+
+func newContainerLifecycle() *containerLifecycle {
+	l := &containerLifecycle{}
+	l.ctx, l.stopSignals = shell.InterruptContext(l.kill)
+	return l
+}
+
+// Add registers a container to be stopped when the command exits
+func (l *containerLifecycle) Add(containerID string) {
+	if containerID == "" {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.containers = append(l.containers, containerID)
+}
+
+// Err returns an interrupted error in place of err if the command got a signal to stop, so the
+// user sees why it stopped rather than whatever failed as a result
+func (l *containerLifecycle) Err(err error) error {
+	if err != nil && l.ctx.Err() != nil {
+		return errors.Interrupted()
+	}
+	return err
+}
+
+// Close stops the containers, killing any that fail to stop in time
+func (l *containerLifecycle) Close() {
+	defer l.stopSignals()
+
+	for _, id := range l.registered() {
+		console.Debugf("Stopping container %s...", id)
+		ctx, cancel := context.WithTimeout(context.Background(), containerStopTimeout)
+		err := docker.DefaultClient().Stop(ctx, id)
+		cancel()
+		// Containers that have already exited and been removed don't need stopping
+		if err == nil || err == docker.ErrNoSuchContainer {
+			continue
+		}
+		console.Debugf("Failed to stop container %s, killing it: %s", id, err)
+		l.killContainer(id)
+	}
+}
+
+func (l *containerLifecycle) kill() {
+	for _, id := range l.registered() {
+		l.killContainer(id)
+	}
+}
+
+func (l *containerLifecycle) killContainer(id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), containerKillTimeout)
+	defer cancel()
+	if err := docker.DefaultClient().Kill(ctx, id); err != nil && err != docker.ErrNoSuchContainer {
+		console.Warnf("Failed to kill container %s: %s", id, err)
+	}
+}
+
+func (l *containerLifecycle) registered() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string{}, l.containers...)
+}
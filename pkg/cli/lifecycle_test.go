@@ -0,0 +1,27 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/docker/dockertest"
+)
+
+func TestContainerLifecycleClose(t *testing.T) {
+	client := dockertest.NewFakeClient()
+	docker.SetDefaultClient(client)
+	client.Containers["running"] = &types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{ID: "running"}}
+
+	lifecycle := newContainerLifecycle()
+	lifecycle.Add("running")
+	lifecycle.Add("")
+	// Already exited and removed, so there's nothing to stop or kill
+	lifecycle.Add("removed")
+	lifecycle.Close()
+
+	require.Equal(t, []string{"running"}, client.Stopped)
+	require.Empty(t, client.Killed)
+}
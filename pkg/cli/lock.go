@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/errors"
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+func newLockCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "lock",
+		Short: "Resolve the exact versions of packages and save them in " + global.LockFilename,
+		Long: `Resolve the exact versions of packages and save them in ` + global.LockFilename + `.
+
+This builds the environment in ` + global.ConfigFilename + `, then saves the version of every
+Python package and conda package that was installed in ` + global.LockFilename + `, and every
+system package installed on top of the base image, including the dependencies of the ones
+in system_packages. If the base image doesn't have a digest, only the packages in
+system_packages are saved. When
+` + global.LockFilename + ` exists, images are built with those versions, so rebuilding an
+image installs the same packages.
+
+Run this again after you change ` + global.ConfigFilename + `.`,
+		Args: cobra.NoArgs,
+		RunE: cmdLock,
+	}
+	addBuildFlags(cmd)
+	// The lock is always made from cog.yaml
+	_ = cmd.Flags().MarkHidden("locked")
+	return cmd
+}
+
+func cmdLock(cmd *cobra.Command, args []string) error {
+	cfg, projectDir, err := config.GetConfig(projectDirFlag)
+	if err != nil {
+		return err
+	}
+
+	lifecycle := newContainerLifecycle()
+	defer lifecycle.Close()
+
+	lock, err := image.Lock(lifecycle.ctx, cfg, projectDir, buildOptions())
+	if err != nil {
+		return lifecycle.Err(errors.BuildFailed(err))
+	}
+	if err := lock.Write(projectDir); err != nil {
+		return err
+	}
+
+	console.Infof("\nWrote %d Python packages and %d system packages to %s", len(lock.PythonPackages), len(lock.SystemPackages), global.LockFilename)
+	return nil
+}
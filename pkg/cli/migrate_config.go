@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+func newMigrateConfigCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate-config",
+		Short: "Update " + global.ConfigFilename + " to the latest version of the format",
+		Long: `Update ` + global.ConfigFilename + ` to the latest version of the format.
+
+This replaces deprecated options with their equivalents, like moving the commands in
+'pre_install' into 'run', and sets 'version' to ` + config.LatestVersion + `. Only the lines
+that need to change are rewritten, so comments and blank lines are kept.`,
+		Args: cobra.NoArgs,
+		RunE: cmdMigrateConfig,
+	}
+	return cmd
+}
+
+func cmdMigrateConfig(cmd *cobra.Command, args []string) error {
+	projectDir, err := config.GetProjectDir(projectDirFlag)
+	if err != nil {
+		return err
+	}
+	configPath := path.Join(projectDir, global.ConfigFilename)
+	info, err := os.Stat(configPath)
+	if err != nil {
+		return fmt.Errorf("Failed to read %s: %w", configPath, err)
+	}
+	contents, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("Failed to read %s: %w", configPath, err)
+	}
+
+	migrated, changes, err := config.Migrate(contents)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		console.Infof("%s is already version %s", global.ConfigFilename, config.LatestVersion)
+		return nil
+	}
+	// Don't replace a config that worked with one that doesn't
+	if _, err := config.FromYAML(migrated); err != nil {
+		if errs, ok := err.(*config.ValidationErrors); ok {
+			errs.SetSource(global.ConfigFilename, migrated)
+		}
+		return fmt.Errorf("The migrated %s isn't valid, so it hasn't been changed: %w", global.ConfigFilename, err)
+	}
+	if err := ioutil.WriteFile(configPath, migrated, info.Mode()); err != nil {
+		return fmt.Errorf("Failed to write %s: %w", configPath, err)
+	}
+
+	for _, change := range changes {
+		console.Infof("%s", change)
+	}
+	console.Infof("\nUpdated %s to version %s", global.ConfigFilename, config.LatestVersion)
+	return nil
+}
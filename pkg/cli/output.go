@@ -0,0 +1,157 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/errors"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+const (
+	outputFormatText = "text"
+	outputFormatJSON = "json"
+)
+
+var outputFormat string
+
+// commandResult is the result of a command. With --format json, it is written to stdout
+// as a single JSON object when the command finishes.
+type commandResult struct {
+	Command    string            `json:"command"`
+	Status     string            `json:"status"`
+	Image      string            `json:"image,omitempty"`
+	Digest     string            `json:"digest,omitempty"`
+	Schema     interface{}       `json:"schema,omitempty"`
+	Dockerfile string            `json:"dockerfile,omitempty"`
+	Prediction *predictionResult `json:"prediction,omitempty"`
+	// Findings are the problems found by `cog validate`
+	Findings []*config.ValidationError `json:"findings,omitempty"`
+	// Examples are the results of the examples run by `cog test`
+	Examples []*exampleResult `json:"examples,omitempty"`
+	// Containers are the containers listed by `cog ps`. It's a pointer, so an empty list
+	// is still written.
+	Containers *[]psContainer `json:"containers,omitempty"`
+	// Images are the images listed by `cog images`, which is also a pointer
+	Images *[]cogImage `json:"images,omitempty"`
+	// Model is the image shown by `cog inspect`
+	Model *inspectResult `json:"model,omitempty"`
+	Error *resultError   `json:"error,omitempty"`
+}
+
+type predictionResult struct {
+	Status      string      `json:"status"`
+	Output      interface{} `json:"output,omitempty"`
+	OutputPaths []string    `json:"output_paths,omitempty"`
+	ResultsPath string      `json:"results_path,omitempty"`
+	Error       string      `json:"error,omitempty"`
+}
+
+type resultError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// cmdResult is the result of the command that is running. Commands wrapped with
+// withJSONResult fill it in as they go.
+var cmdResult = &commandResult{}
+
+func defaultOutputFormat() string {
+	if format := os.Getenv("COG_OUTPUT"); format != "" {
+		return format
+	}
+	return outputFormatText
+}
+
+func setOutputFormat(format string) error {
+	switch format {
+	case outputFormatText:
+		console.SetMachine(false)
+	case outputFormatJSON:
+		console.SetMachine(true)
+	default:
+		return fmt.Errorf("Unknown output format '%s', must be one of: %s, %s", format, outputFormatText, outputFormatJSON)
+	}
+	return nil
+}
+
+// withJSONResult wraps a command's RunE so that, in machine mode, cmdResult is written to
+// stdout when it finishes, including the error and its code if it failed
+func withJSONResult(run func(cmd *cobra.Command, args []string) error) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		cmdResult = &commandResult{Command: cmd.Name()}
+		err := run(cmd, args)
+		if !console.IsMachine() {
+			return err
+		}
+
+		cmdResult.Status = "succeeded"
+		if err != nil {
+			code := errors.Code(err)
+			if code == "" {
+				code = errors.CodeUnknown
+			}
+			cmdResult.Status = "failed"
+			cmdResult.Error = &resultError{Code: code, Message: err.Error()}
+		}
+		if outputErr := console.OutputJSON(cmdResult); outputErr != nil && err == nil {
+			return fmt.Errorf("Failed to write result: %w", outputErr)
+		}
+		return err
+	}
+}
+
+// writeJSONFlagOutput writes v to stdout as indented JSON, for commands with a --json flag
+// that outputs just what the command lists or shows. With --format json, the output is in
+// cmdResult instead, so the two can't be used together.
+func writeJSONFlagOutput(v interface{}) error {
+	if console.IsMachine() {
+		return fmt.Errorf("--json can't be used with --format %s. Use one or the other", outputFormatJSON)
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// recordImage adds an image's name, digest and schema to cmdResult. The digest is the
+// image ID, or the registry digest if it has been pushed. This is only needed for the
+// JSON result, so it does nothing in text mode.
+func recordImage(ctx context.Context, imageName string, pushed bool) error {
+	if !console.IsMachine() {
+		return nil
+	}
+	cmdResult.Image = imageName
+
+	inspect, err := docker.ImageInspect(imageName)
+	if err != nil {
+		return fmt.Errorf("Failed to inspect %s: %w", imageName, err)
+	}
+	cmdResult.Digest = inspect.ID
+	if pushed {
+		repository := strings.SplitN(imageName, "@", 2)[0]
+		if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+			repository = repository[:i]
+		}
+		for _, repoDigest := range inspect.RepoDigests {
+			if strings.HasPrefix(repoDigest, repository+"@") {
+				cmdResult.Digest = strings.TrimPrefix(repoDigest, repository+"@")
+			}
+		}
+	}
+
+	schema, err := image.GetOpenAPISchema(ctx, imageName)
+	if err != nil {
+		console.Debugf("Failed to get schema of %s: %s", imageName, err)
+		return nil
+	}
+	cmdResult.Schema = schema
+	return nil
+}
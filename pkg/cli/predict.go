@@ -2,6 +2,7 @@ package cli
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -14,6 +15,7 @@ import (
 
 	"github.com/replicate/cog/pkg/config"
 	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/errors"
 	"github.com/replicate/cog/pkg/image"
 	"github.com/replicate/cog/pkg/predict"
 	"github.com/replicate/cog/pkg/util/console"
@@ -21,8 +23,11 @@ import (
 )
 
 var (
-	inputFlags []string
-	outPath    string
+	inputFlags  []string
+	outPath     string
+	batchPath   string
+	parallelism int
+	interactive bool
 )
 
 func newPredictCommand() *cobra.Command {
@@ -36,91 +41,132 @@ It must be an image that has been built by Cog.
 
 Otherwise, it will build the model in the current directory and run
 the prediction on that.`,
-		RunE:       cmdPredict,
+		RunE:       withJSONResult(cmdPredict),
 		Args:       cobra.MaximumNArgs(1),
 		SuggestFor: []string{"infer"},
 	}
-	addBuildProgressOutputFlag(cmd)
-	cmd.Flags().StringArrayVarP(&inputFlags, "input", "i", []string{}, "Inputs, in the form name=value. if value is prefixed with @, then it is read from a file on disk. E.g. -i path=@image.jpg")
-	cmd.Flags().StringVarP(&outPath, "output", "o", "", "Output path")
+	addBuildFlags(cmd)
+	cmd.Flags().StringArrayVarP(&inputFlags, "input", "i", []string{}, "Inputs, in the form name=value. if value is prefixed with @, then it is read from a file on disk. E.g. -i path=@image.jpg. Pass an input more than once to give it a list")
+	cmd.Flags().StringVarP(&outPath, "output", "o", "", "Output path. With --batch, the directory to write outputs and results.jsonl to (default \"predictions\")")
+	cmd.Flags().StringVar(&batchPath, "batch", "", "Run a prediction for each row of a JSONL or CSV file of inputs, using one running model")
+	cmd.Flags().IntVar(&parallelism, "parallelism", 1, "With --batch, the number of predictions to run at once")
+	cmd.Flags().BoolVar(&interactive, "interactive", false, "Prompt for each input, then run more predictions on the same running model")
 
 	return cmd
 }
 
 func cmdPredict(cmd *cobra.Command, args []string) error {
-	imageName := ""
-	volumes := []docker.Volume{}
-	gpus := ""
+	if batchPath != "" && len(inputFlags) > 0 {
+		return fmt.Errorf("--batch and --input can't be used together. Put the inputs in the batch file instead")
+	}
+	if interactive && (batchPath != "" || len(inputFlags) > 0) {
+		return fmt.Errorf("--interactive can't be used with --batch or --input")
+	}
+	if interactive && (console.IsMachine() || !console.IsTerminal()) {
+		return fmt.Errorf("--interactive needs a terminal to prompt for inputs")
+	}
+	if parallelism < 1 {
+		return fmt.Errorf("--parallelism must be at least 1")
+	}
+
+	lifecycle := newContainerLifecycle()
+	defer lifecycle.Close()
+
+	runOptions, err := imageToRun(lifecycle.ctx, "predict", args)
+	if err != nil {
+		return lifecycle.Err(err)
+	}
+	cmdResult.Image = runOptions.Image
+
+	console.Info("")
+	console.Infof("Starting Docker image %s and running setup()...", runOptions.Image)
+
+	predictor := predict.NewPredictor(runOptions)
+	logsWriter, logsDone := console.LogWriter(console.InfoLevel)
+	defer logsDone()
+	err = predictor.Start(lifecycle.ctx, logsWriter)
+	// The container is running even if setup failed or was interrupted
+	lifecycle.Add(predictor.ContainerID())
+	if err != nil {
+		return lifecycle.Err(errors.SetupFailed(err))
+	}
+
+	if batchPath != "" {
+		outputDir := outPath
+		if outputDir == "" {
+			outputDir = "predictions"
+		}
+		return lifecycle.Err(predictBatch(lifecycle.ctx, predictor, batchPath, outputDir, parallelism))
+	}
+
+	if interactive {
+		return lifecycle.Err(predictInteractive(lifecycle.ctx, predictor, outPath))
+	}
+
+	return lifecycle.Err(predictIndividualInputs(lifecycle.ctx, predictor, inputFlags, outPath))
+}
+
+// imageToRun returns the options to run predictions with. If no image is passed in args,
+// the model in the current directory is built and mounted into the container. command is
+// the Cog command that is running it, which is added as a label to the container.
+func imageToRun(ctx context.Context, command string, args []string) (docker.RunOptions, error) {
+	runOptions := docker.RunOptions{
+		Labels: map[string]string{docker.LabelCommand: command},
+	}
 
 	if len(args) == 0 {
 		// Build image
 
 		cfg, projectDir, err := config.GetConfig(projectDirFlag)
 		if err != nil {
-			return err
+			return runOptions, err
 		}
 
-		if imageName, err = image.BuildBase(cfg, projectDir, buildProgressOutput); err != nil {
-			return err
+		if runOptions.Image, err = image.BuildBase(ctx, cfg, projectDir, buildOptions()); err != nil {
+			return runOptions, errors.BuildFailed(err)
 		}
 
 		// Base image doesn't have /src in it, so mount as volume
-		volumes = append(volumes, docker.Volume{
+		runOptions.Volumes = append(runOptions.Volumes, docker.Volume{
 			Source:      projectDir,
 			Destination: "/src",
 		})
+		runOptions.Labels[docker.LabelProjectDir] = projectDir
 
 		if cfg.Build.GPU {
-			gpus = "all"
+			runOptions.GPUs = "all"
 		}
 
-	} else {
-		// Use existing image
-		imageName = args[0]
-
-		exists, err := docker.ImageExists(imageName)
-		if err != nil {
-			return fmt.Errorf("Failed to determine if %s exists: %w", imageName, err)
-		}
-		if !exists {
-			console.Infof("Pulling image: %s", imageName)
-			if err := docker.Pull(imageName); err != nil {
-				return fmt.Errorf("Failed to pull %s: %w", imageName, err)
-			}
-		}
-		conf, err := image.GetConfig(imageName)
-		if err != nil {
-			return err
-		}
-		if conf.Build.GPU {
-			gpus = "all"
-		}
+		return runOptions, nil
 	}
 
-	console.Info("")
-	console.Infof("Starting Docker image %s and running setup()...", imageName)
-
-	predictor := predict.NewPredictor(docker.RunOptions{
-		GPUs:    gpus,
-		Image:   imageName,
-		Volumes: volumes,
-	})
-	if err := predictor.Start(os.Stderr); err != nil {
-		return err
-	}
+	// Use existing image
+	imageName := args[0]
+	runOptions.Image = imageName
 
-	// FIXME: will not run on signal
-	defer func() {
-		console.Debugf("Stopping container...")
-		if err := predictor.Stop(); err != nil {
-			console.Warnf("Failed to stop container: %s", err)
+	// The config is read from the registry if the image hasn't been pulled, so images
+	// that aren't Cog models fail before they're downloaded
+	conf, err := image.GetConfig(ctx, imageName)
+	if err != nil {
+		return runOptions, err
+	}
+	exists, err := docker.ImageExists(imageName)
+	if err != nil {
+		return runOptions, fmt.Errorf("Failed to determine if %s exists: %w", imageName, err)
+	}
+	if !exists {
+		console.Infof("Pulling image: %s", imageName)
+		if err := docker.Pull(imageName); err != nil {
+			return runOptions, fmt.Errorf("Failed to pull %s: %w", imageName, err)
 		}
-	}()
-
-	return predictIndividualInputs(predictor, inputFlags, outPath)
+	}
+	if conf.Build.GPU {
+		runOptions.GPUs = "all"
+	}
+	return runOptions, nil
 }
 
-func predictIndividualInputs(predictor predict.Predictor, inputFlags []string, outputPath string) error {
+func predictIndividualInputs(ctx context.Context, predictor predict.Predictor, inputFlags []string, outputPath string) error {
 	console.Info("Running prediction...")
 	schema, err := predictor.GetSchema()
 	if err != nil {
@@ -131,9 +177,19 @@ func predictIndividualInputs(predictor predict.Predictor, inputFlags []string, o
 	if err != nil {
 		return err
 	}
-	prediction, err := predictor.Predict(inputs)
+	return runPrediction(ctx, predictor, schema, inputs, outputPath)
+}
+
+// runPrediction runs a prediction and writes its output to outputPath, or stdout if it's
+// empty. File outputs are written to output.<extension> if there's no path.
+func runPrediction(ctx context.Context, predictor predict.Predictor, schema *openapi3.T, inputs predict.Inputs, outputPath string) error {
+	prediction, err := predictor.PredictWithContext(ctx, inputs)
 	if err != nil {
-		return err
+		return errors.PredictionFailed(err)
+	}
+	cmdResult.Prediction = &predictionResult{Status: string(prediction.Status), Error: prediction.Error}
+	if prediction.Status != "succeeded" {
+		return errors.PredictionFailed(fmt.Errorf("Prediction failed: %s", prediction.Error))
 	}
 
 	// Generate output depending on type in schema
@@ -146,17 +202,13 @@ func predictIndividualInputs(predictor predict.Predictor, inputFlags []string, o
 	}
 
 	if outputSchema.Type == "string" && outputSchema.Format == "uri" {
-		dataurlObj, err := dataurl.DecodeString((*prediction.Output).(string))
+		var extension string
+		out, extension, err = decodeOutputFile((*prediction.Output).(string))
 		if err != nil {
-			return fmt.Errorf("Failed to decode dataurl: %w", err)
+			return err
 		}
-		out = dataurlObj.Data
 		if outputPath == "" {
-			outputPath = "output"
-			extension := mime.ExtensionByType(dataurlObj.ContentType())
-			if extension != "" {
-				outputPath += extension
-			}
+			outputPath = "output" + extension
 		}
 	} else if outputSchema.Type == "string" {
 		// Handle strings separately because if we encode it to JSON it will be surrounded by quotes.
@@ -183,6 +235,10 @@ func predictIndividualInputs(predictor predict.Predictor, inputFlags []string, o
 
 	// Write to stdout
 	if outputPath == "" {
+		if console.IsMachine() {
+			cmdResult.Prediction.Output = prediction.Output
+			return nil
+		}
 		console.Output(string(out))
 		return nil
 	}
@@ -202,7 +258,7 @@ func writeOutput(outputPath string, output []byte) error {
 	}
 
 	// Write to file
-	outFile, err := os.OpenFile(outputPath, os.O_WRONLY|os.O_CREATE, 0o755)
+	outFile, err := os.OpenFile(outputPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o755)
 	if err != nil {
 		return err
 	}
@@ -214,6 +270,9 @@ func writeOutput(outputPath string, output []byte) error {
 		return err
 	}
 	console.Infof("Written output to %s", outputPath)
+	if cmdResult.Prediction != nil {
+		cmdResult.Prediction.OutputPaths = append(cmdResult.Prediction.OutputPaths, outputPath)
+	}
 	return nil
 }
 
@@ -224,13 +283,10 @@ func handleMultipleFileOutput(prediction *predict.Response, outputSchema *openap
 	}
 
 	for i, output := range outputs {
-		outputString := output.(string)
-		dataurlObj, err := dataurl.DecodeString(outputString)
+		out, extension, err := decodeOutputFile(output.(string))
 		if err != nil {
-			return fmt.Errorf("Failed to decode dataurl: %w", err)
+			return err
 		}
-		out := dataurlObj.Data
-		extension := mime.ExtensionByType(dataurlObj.ContentType())
 		outputPath := fmt.Sprintf("output.%d%s", i, extension)
 		if err := writeOutput(outputPath, out); err != nil {
 			return err
@@ -240,50 +296,43 @@ func handleMultipleFileOutput(prediction *predict.Response, outputSchema *openap
 	return nil
 }
 
+// decodeOutputFile decodes a file output, which is returned as a data URL, returning its
+// contents and a file extension for its content type
+func decodeOutputFile(s string) (data []byte, extension string, err error) {
+	dataurlObj, err := dataurl.DecodeString(s)
+	if err != nil {
+		return nil, "", fmt.Errorf("Failed to decode dataurl: %w", err)
+	}
+	return dataurlObj.Data, mime.ExtensionByType(dataurlObj.ContentType()), nil
+}
+
+// parseInputFlags parses -i flags into inputs of the types in the model's schema. Inputs
+// without a name are for the model's first input.
 func parseInputFlags(inputs []string, schema *openapi3.T) (predict.Inputs, error) {
-	var err error
-	keyVals := map[string]string{}
+	fields, err := predict.InputFields(schema)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string][]string{}
 	for _, input := range inputs {
 		var name, value string
 
 		// Default input name is "input"
 		if !strings.Contains(input, "=") {
-			name, err = getFirstInput(schema)
-			if err != nil {
-				return nil, err
+			if len(fields) == 0 {
+				return nil, fmt.Errorf("Could not determine the default input based on the order of the inputs. Please specify inputs in the format '-i name=value'")
 			}
+			name = fields[0].Name
 			value = input
 		} else {
 			split := strings.SplitN(input, "=", 2)
 			name = split[0]
 			value = split[1]
 		}
-		if strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
+		if len(value) >= 2 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
 			value = value[1 : len(value)-1]
 		}
-		keyVals[name] = value
-	}
-	return predict.NewInputs(keyVals), nil
-}
-
-func getFirstInput(schema *openapi3.T) (string, error) {
-	inputProperties := schema.Components.Schemas["Input"].Value.Properties
-	for k, v := range inputProperties {
-		val, ok := v.Value.Extensions["x-order"]
-		if !ok {
-			continue
-		}
-		rawMsg, ok := val.(json.RawMessage)
-		if !ok {
-			continue
-		}
-		var order int
-		if err := json.Unmarshal(rawMsg, &order); err != nil {
-			return "", err
-		}
-		if order == 0 {
-			return k, nil
-		}
+		values[name] = append(values[name], value)
 	}
-	return "", fmt.Errorf("Could not determine the default input based on the order of the inputs. Please specify inputs in the format '-i name=value'")
+	return predict.ParseInputs(fields, values)
 }
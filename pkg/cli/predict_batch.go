@@ -0,0 +1,166 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/getkin/kin-openapi/openapi3"
+
+	"github.com/replicate/cog/pkg/errors"
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// batchResult is a line in results.jsonl. Lines are in the same order as the rows of the
+// batch file, and Index is the row each one is for.
+type batchResult struct {
+	Index           int      `json:"index"`
+	Status          string   `json:"status"`
+	Outputs         []string `json:"outputs,omitempty"`
+	Error           string   `json:"error,omitempty"`
+	DurationSeconds float64  `json:"duration_seconds"`
+}
+
+// predictBatch runs a prediction for each row in a batch file against a single running
+// predictor, with up to parallelism predictions running at once. The outputs for each row
+// are written to a numbered directory in outputDir, alongside a results.jsonl with the
+// status of each prediction. Both are written in the order of the rows, as soon as each
+// prediction and the ones before it have finished, so little is lost if Cog stops partway
+// through. If ctx is cancelled, the predictions that haven't
+// finished are recorded as failed.
+func predictBatch(ctx context.Context, predictor predict.Predictor, batchPath string, outputDir string, parallelism int) error {
+	schema, err := predictor.GetSchema()
+	if err != nil {
+		return err
+	}
+	fields, err := predict.InputFields(schema)
+	if err != nil {
+		return err
+	}
+	rows, err := predict.ReadBatchFile(batchPath, fields)
+	if err != nil {
+		return err
+	}
+	outputSchema := schema.Components.Schemas["Response"].Value.Properties["output"].Value
+
+	if err := os.MkdirAll(outputDir, 0o755); err != nil {
+		return fmt.Errorf("Failed to create output directory: %w", err)
+	}
+	resultsPath := filepath.Join(outputDir, "results.jsonl")
+	resultsFile, err := os.Create(resultsPath)
+	if err != nil {
+		return fmt.Errorf("Failed to create %s: %w", resultsPath, err)
+	}
+	defer resultsFile.Close()
+	encoder := json.NewEncoder(resultsFile)
+
+	console.Infof("Running %d predictions...", len(rows))
+	finished := 0
+	failed := 0
+	var writeErr error
+	// Keep reading results after a write error, so the predictions can finish
+	for prediction := range predictor.PredictAll(ctx, rows, parallelism) {
+		finished++
+		i := prediction.Index
+		result := batchResultFromPrediction(prediction, outputSchema, filepath.Join(outputDir, strconv.Itoa(i)))
+		result.Index = i
+		if result.Status == "succeeded" {
+			console.Infof("Prediction %d succeeded (%d of %d finished)", i, finished, len(rows))
+		} else {
+			failed++
+			console.Warnf("Prediction %d failed (%d of %d finished): %s", i, finished, len(rows), result.Error)
+		}
+		if writeErr == nil {
+			writeErr = encoder.Encode(result)
+		}
+	}
+	if writeErr != nil {
+		return fmt.Errorf("Failed to write %s: %w", resultsPath, writeErr)
+	}
+	if err := resultsFile.Close(); err != nil {
+		return fmt.Errorf("Failed to write %s: %w", resultsPath, err)
+	}
+
+	console.Infof("Written results to %s", resultsPath)
+	cmdResult.Prediction = &predictionResult{Status: "succeeded", ResultsPath: resultsPath}
+	if failed > 0 {
+		cmdResult.Prediction.Status = "failed"
+		return errors.PredictionFailed(fmt.Errorf("%d of %d predictions failed", failed, len(rows)))
+	}
+	return nil
+}
+
+func batchResultFromPrediction(prediction predict.PredictionResult, outputSchema *openapi3.Schema, dir string) batchResult {
+	result := batchResult{Status: "failed", DurationSeconds: prediction.Duration.Seconds()}
+	if prediction.Err != nil {
+		result.Error = prediction.Err.Error()
+		return result
+	}
+	if prediction.Response.Status != "succeeded" {
+		result.Error = prediction.Response.Error
+		return result
+	}
+	var err error
+	if result.Outputs, err = writeOutputToDir(prediction.Response, outputSchema, dir); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Status = "succeeded"
+	return result
+}
+
+// writeOutputToDir writes the output of a prediction to files in dir, returning their paths
+func writeOutputToDir(prediction *predict.Response, outputSchema *openapi3.Schema, dir string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	if prediction.Output == nil {
+		return nil, nil
+	}
+
+	files := map[string][]byte{}
+	switch {
+	case outputSchema.Type == "array" && outputSchema.Items.Value != nil && outputSchema.Items.Value.Type == "string" && outputSchema.Items.Value.Format == "uri":
+		outputs, ok := (*prediction.Output).([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Failed to decode output")
+		}
+		for i, output := range outputs {
+			data, extension, err := decodeOutputFile(output.(string))
+			if err != nil {
+				return nil, err
+			}
+			files[fmt.Sprintf("output.%d%s", i, extension)] = data
+		}
+	case outputSchema.Type == "string" && outputSchema.Format == "uri":
+		data, extension, err := decodeOutputFile((*prediction.Output).(string))
+		if err != nil {
+			return nil, err
+		}
+		files["output"+extension] = data
+	case outputSchema.Type == "string":
+		files["output.txt"] = []byte((*prediction.Output).(string))
+	default:
+		data, err := json.MarshalIndent(prediction.Output, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("Failed to encode prediction output as JSON: %w", err)
+		}
+		files["output.json"] = data
+	}
+
+	paths := []string{}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
@@ -0,0 +1,33 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/predict"
+)
+
+func TestWriteOutputToDir(t *testing.T) {
+	dir := t.TempDir()
+
+	var fileOutput interface{} = "data:text/plain;base64,aGVsbG8="
+	paths, err := writeOutputToDir(&predict.Response{Output: &fileOutput}, &openapi3.Schema{Type: "string", Format: "uri"}, filepath.Join(dir, "0"))
+	require.NoError(t, err)
+	require.Len(t, paths, 1)
+	require.Equal(t, filepath.Join(dir, "0"), filepath.Dir(paths[0]))
+	contents, err := os.ReadFile(paths[0])
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(contents))
+
+	var numberOutput interface{} = 3.5
+	paths, err = writeOutputToDir(&predict.Response{Output: &numberOutput}, &openapi3.Schema{Type: "number"}, filepath.Join(dir, "1"))
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join(dir, "1", "output.json")}, paths)
+	contents, err = os.ReadFile(paths[0])
+	require.NoError(t, err)
+	require.Equal(t, "3.5", string(contents))
+}
@@ -0,0 +1,166 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+
+	"github.com/replicate/cog/pkg/errors"
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// predictInteractive prompts for each of the model's inputs, runs a prediction, then
+// offers to run another one on the same container. The values entered for the previous
+// prediction are the defaults for the next one.
+func predictInteractive(ctx context.Context, predictor predict.Predictor, outputPath string) error {
+	schema, err := predictor.GetSchema()
+	if err != nil {
+		return err
+	}
+	fields, err := predict.InputFields(schema)
+	if err != nil {
+		return err
+	}
+
+	previous := map[string]string{}
+	for {
+		inputs := predict.Inputs{}
+		for _, field := range fields {
+			text, input, err := promptInput(field, previous[field.Name])
+			if err != nil {
+				return promptError(err)
+			}
+			previous[field.Name] = text
+			if input != nil {
+				inputs[field.Name] = *input
+			}
+		}
+
+		console.Info("Running prediction...")
+		if err := runPrediction(ctx, predictor, schema, inputs, outputPath); err != nil {
+			// The model is still running, so it can be tried again with different inputs
+			if !errors.IsPredictionFailed(err) {
+				return err
+			}
+			console.Warn(err.Error())
+		}
+		console.Info("")
+
+		again, err := console.InteractiveBool{
+			Prompt:  "Run another prediction?",
+			Default: true,
+		}.Read()
+		if err != nil {
+			return promptError(err)
+		}
+		if !again {
+			return nil
+		}
+	}
+}
+
+// promptError converts an error reading a prompt. Ctrl-D ends the session, and Ctrl-C
+// is reported like it would be if the terminal weren't in raw mode.
+func promptError(err error) error {
+	switch {
+	case err == io.EOF:
+		return nil
+	case err == console.ErrInterrupted:
+		return errors.Interrupted()
+	}
+	return err
+}
+
+// promptInput asks for the value of an input until a valid one is entered. It returns
+// the text that was entered and the input, which is nil if it was left empty.
+func promptInput(field *predict.InputField, previous string) (string, *predict.Input, error) {
+	console.Info("")
+	description := field.Description
+	if len(field.Choices) == 0 {
+		if constraints := inputConstraints(field); constraints != "" {
+			description = strings.TrimSpace(fmt.Sprintf("%s (%s)", description, constraints))
+		}
+	}
+	if description != "" {
+		console.Info(description)
+	}
+
+	prompt := console.Interactive{
+		Prompt:   fmt.Sprintf("%s [%s]", field.Name, field.TypeName()),
+		Required: field.Required,
+	}
+	for _, choice := range field.Choices {
+		prompt.Options = append(prompt.Options, predict.FormatInputValue(choice))
+	}
+	if field.Default != nil {
+		prompt.Default = predict.FormatInputValue(field.Default)
+	}
+	if previous != "" {
+		prompt.Default = previous
+	}
+	if field.TypeName() == "file" || (field.Items != nil && field.Items.TypeName() == "file") {
+		console.Info("Enter a path prefixed with @, or a URL. Press tab to complete paths.")
+		prompt.Complete = completeFilePath
+	}
+	if field.Type == "array" {
+		console.Info("Enter a value, or a JSON list of values.")
+	}
+
+	for {
+		text, err := prompt.Read()
+		if err != nil {
+			return "", nil, err
+		}
+		if text == "" {
+			return "", nil, nil
+		}
+		input, err := field.Parse([]string{text})
+		if err != nil {
+			console.Warn(err.Error())
+			continue
+		}
+		return text, &input, nil
+	}
+}
+
+// completeFilePath completes text to the files it could be, if it's a path prefixed with
+// @. Directories end in a slash, so they can be completed further.
+func completeFilePath(text string) []string {
+	if !strings.HasPrefix(text, "@") {
+		return nil
+	}
+	dir, prefix := filepath.Split(text[1:])
+	listDir := dir
+	if listDir == "" {
+		listDir = "."
+	}
+	listDir, err := homedir.Expand(listDir)
+	if err != nil {
+		return nil
+	}
+	entries, err := ioutil.ReadDir(listDir)
+	if err != nil {
+		return nil
+	}
+	matches := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		// Hidden files are only completed if a . has been typed
+		if !strings.HasPrefix(name, prefix) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(prefix, ".")) {
+			continue
+		}
+		if entry.IsDir() {
+			name += "/"
+		}
+		matches = append(matches, "@"+dir+name)
+	}
+	sort.Strings(matches)
+	return matches
+}
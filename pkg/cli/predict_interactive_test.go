@@ -0,0 +1,24 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompleteFilePath(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"image.jpg", "image.png", "notes.txt", ".hidden"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte{}, 0o644))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "images"), 0o755))
+
+	require.Equal(t, []string{"@" + dir + "/image.jpg", "@" + dir + "/image.png", "@" + dir + "/images/"}, completeFilePath("@"+dir+"/ima"))
+	require.Equal(t, []string{"@" + dir + "/notes.txt"}, completeFilePath("@"+dir+"/n"))
+	require.Equal(t, []string{"@" + dir + "/.hidden"}, completeFilePath("@"+dir+"/."))
+	require.Equal(t, []string{"@" + dir + "/image.jpg", "@" + dir + "/image.png", "@" + dir + "/images/", "@" + dir + "/notes.txt"}, completeFilePath("@"+dir+"/"))
+	require.Empty(t, completeFilePath("@"+dir+"/missing"))
+	require.Nil(t, completeFilePath(dir+"/ima"))
+}
@@ -0,0 +1,35 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseInputFlags(t *testing.T) {
+	schema, err := openapi3.NewLoader().LoadFromData([]byte(`{
+		"openapi": "3.0.2",
+		"info": {"title": "Cog", "version": "0.1.0"},
+		"paths": {},
+		"components": {"schemas": {
+			"Input": {"type": "object", "properties": {
+				"steps": {"type": "integer", "x-order": 1},
+				"prompts": {"type": "array", "items": {"type": "string"}, "x-order": 0}
+			}}
+		}}
+	}`))
+	require.NoError(t, err)
+
+	// Inputs without a name are for the first input, and inputs passed more than once are lists
+	inputs, err := parseInputFlags([]string{"a cat", `prompts="a dog"`, "steps=20"}, schema)
+	require.NoError(t, err)
+	prompts := *inputs["prompts"].Array
+	require.Len(t, prompts, 2)
+	require.Equal(t, "a cat", *prompts[0].String)
+	require.Equal(t, "a dog", *prompts[1].String)
+	require.Equal(t, int64(20), *inputs["steps"].Value)
+
+	_, err = parseInputFlags([]string{"steps=lots"}, schema)
+	require.ErrorContains(t, err, `- steps: Expected an integer, but got "lots"`)
+}
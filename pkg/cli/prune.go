@@ -0,0 +1,179 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var (
+	pruneOlderThan    time.Duration
+	pruneKeepLatest   int
+	pruneDanglingBase bool
+	pruneDryRun       bool
+)
+
+// pruneFilter chooses which images `cog prune` removes. An image is removed if it
+// matches all the filters that are set.
+type pruneFilter struct {
+	olderThan    time.Duration
+	keepLatest   int
+	danglingBase bool
+}
+
+func newPruneCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove Docker images built by Cog",
+		Long: `Remove Docker images built by Cog.
+
+Choose which images to remove with filters. If you pass more than one, an image is
+only removed if it matches all of them. For example, to remove images older than a
+week, but keep the two newest images of each project:
+
+    cog prune --older-than 168h --keep-latest 2
+
+Images are grouped by the project they were built from. Images built without a
+project, like ones built by older versions of Cog, are grouped by repository.
+Images that are used by a container are skipped.`,
+		RunE: cmdPrune,
+		Args: cobra.NoArgs,
+	}
+	cmd.Flags().DurationVar(&pruneOlderThan, "older-than", 0, "Remove images built longer ago than this, e.g. 24h")
+	cmd.Flags().IntVar(&pruneKeepLatest, "keep-latest", 0, "Keep the newest N images of each project")
+	cmd.Flags().BoolVar(&pruneDanglingBase, "dangling-base", false, "Remove base images of projects that no longer exist")
+	cmd.Flags().BoolVar(&pruneDryRun, "dry-run", false, "List the images that would be removed without removing them")
+
+	return cmd
+}
+
+func cmdPrune(cmd *cobra.Command, args []string) error {
+	if pruneKeepLatest < 0 {
+		return fmt.Errorf("--keep-latest must be 0 or more")
+	}
+	filter := pruneFilter{
+		olderThan:    pruneOlderThan,
+		keepLatest:   pruneKeepLatest,
+		danglingBase: pruneDanglingBase,
+	}
+	if filter == (pruneFilter{}) {
+		return fmt.Errorf("Choose which images to remove with --older-than, --keep-latest or --dangling-base")
+	}
+
+	now := time.Now()
+	images, err := listCogImages(now)
+	if err != nil {
+		return err
+	}
+	toPrune := imagesToPrune(images, filter, now, projectExists)
+	if len(toPrune) == 0 {
+		console.Info("There are no images to remove")
+		return nil
+	}
+
+	removed := 0
+	var size int64
+	for _, img := range toPrune {
+		if pruneDryRun {
+			console.Infof("Would remove %s (%s)", describeImage(img), units.HumanSize(float64(img.Size)))
+			size += img.Size
+			continue
+		}
+		if err := removeImage(img); err != nil {
+			console.Warnf("Skipping %s: %s", describeImage(img), err)
+			continue
+		}
+		console.Infof("Removed %s (%s)", describeImage(img), units.HumanSize(float64(img.Size)))
+		removed++
+		size += img.Size
+	}
+
+	// The sizes include layers that images share, so this is how much is freed at most
+	if pruneDryRun {
+		console.Infof("\nWould remove %d images, up to %s", len(toPrune), units.HumanSize(float64(size)))
+	} else {
+		console.Infof("\nRemoved %d images, up to %s", removed, units.HumanSize(float64(size)))
+	}
+	return nil
+}
+
+// imagesToPrune returns the images that match filter. images must be newest first.
+// projectExists reports whether a project directory still has a Cog project in it.
+func imagesToPrune(images []cogImage, filter pruneFilter, now time.Time, projectExists func(dir string) bool) []cogImage {
+	toPrune := []cogImage{}
+	// How many images of each project have been seen so far. Base images are counted
+	// separately, so keeping the latest doesn't remove the base image `cog run` uses.
+	seen := map[string]int{}
+	for _, img := range images {
+		group := pruneGroup(img)
+		seen[group]++
+
+		if filter.olderThan > 0 && now.Sub(img.CreatedAt) <= filter.olderThan {
+			continue
+		}
+		if filter.keepLatest > 0 && seen[group] <= filter.keepLatest {
+			continue
+		}
+		// Base images without a project label can't be checked, so they're never dangling
+		if filter.danglingBase && (!img.Base || img.ProjectDir == "" || projectExists(img.ProjectDir)) {
+			continue
+		}
+		toPrune = append(toPrune, img)
+	}
+	return toPrune
+}
+
+// pruneGroup returns the group an image is counted in for --keep-latest. Images without a
+// project label are grouped by repository, so images of different models aren't counted
+// together, and untagged ones are each in a group of their own.
+func pruneGroup(img cogImage) string {
+	group := "project:" + img.ProjectDir
+	if img.ProjectDir == "" {
+		if len(img.Tags) > 0 {
+			group = "repository:" + docker.ImageRepository(img.Tags[0])
+		} else {
+			group = "id:" + img.ID
+		}
+	}
+	return fmt.Sprintf("%s:%t", group, img.Base)
+}
+
+// removeImage removes each of an image's tags, which removes the image when the last
+// one is removed, so images with several tags don't need to be forced
+func removeImage(img cogImage) error {
+	refs := img.Tags
+	if len(refs) == 0 {
+		refs = []string{img.ID}
+	}
+	sort.Strings(refs)
+	for _, ref := range refs {
+		if err := docker.ImageRemove(ref); err != nil && !errors.Is(err, docker.ErrNoSuchImage) {
+			return err
+		}
+	}
+	return nil
+}
+
+func describeImage(img cogImage) string {
+	id := shortID(strings.TrimPrefix(img.ID, "sha256:"))
+	if len(img.Tags) == 0 {
+		return id
+	}
+	return fmt.Sprintf("%s (%s)", strings.Join(img.Tags, ", "), id)
+}
+
+func projectExists(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, global.ConfigFilename))
+	return err == nil
+}
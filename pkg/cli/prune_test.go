@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/docker"
+)
+
+func TestCogImageFromSummary(t *testing.T) {
+	now := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	img := cogImageFromSummary(types.ImageSummary{
+		ID:       "sha256:0123456789abcdef",
+		RepoTags: []string{"<none>:<none>"},
+		Size:     1000,
+		Created:  now.Add(-time.Hour).Unix(),
+		Labels: map[string]string{
+			docker.LabelProjectDir: "/home/user/model",
+			"run.cog.version":      "0.5.0",
+		},
+	}, now)
+
+	require.Equal(t, []string{}, img.Tags)
+	require.Equal(t, "/home/user/model", img.ProjectDir)
+	require.Equal(t, "0.5.0", img.CogVersion)
+	require.True(t, img.Base)
+	require.Equal(t, 3600.0, img.AgeSeconds)
+	require.Equal(t, "<none>", imageTags(img))
+	require.Equal(t, "0123456789ab", describeImage(img))
+}
+
+func TestImagesToPrune(t *testing.T) {
+	now := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	image := func(id string, projectDir string, base bool, age time.Duration) cogImage {
+		return cogImage{ID: id, ProjectDir: projectDir, Base: base, CreatedAt: now.Add(-age)}
+	}
+	// Newest first
+	images := []cogImage{
+		image("model-1", "/src/model", false, time.Hour),
+		image("model-base-1", "/src/model", true, 2*time.Hour),
+		image("model-2", "/src/model", false, 48*time.Hour),
+		image("deleted-base", "/src/deleted", true, 72*time.Hour),
+		image("model-3", "/src/model", false, 96*time.Hour),
+		image("unknown-base", "", true, 120*time.Hour),
+	}
+	exists := func(dir string) bool { return dir == "/src/model" }
+	ids := func(filter pruneFilter) []string {
+		result := []string{}
+		for _, img := range imagesToPrune(images, filter, now, exists) {
+			result = append(result, img.ID)
+		}
+		return result
+	}
+
+	require.Equal(t, []string{"model-2", "deleted-base", "model-3", "unknown-base"}, ids(pruneFilter{olderThan: 24 * time.Hour}))
+	// Base images and images of other projects are counted separately
+	require.Equal(t, []string{"model-3"}, ids(pruneFilter{keepLatest: 2}))
+	require.Equal(t, []string{"deleted-base"}, ids(pruneFilter{danglingBase: true}))
+	require.Equal(t, []string{"model-2", "model-3"}, ids(pruneFilter{olderThan: 24 * time.Hour, keepLatest: 1}))
+	require.Equal(t, []string{}, ids(pruneFilter{olderThan: 100 * time.Hour, danglingBase: true}))
+}
+
+func TestImagesToPruneWithoutProject(t *testing.T) {
+	now := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	image := func(id string, tag string, age time.Duration) cogImage {
+		img := cogImage{ID: id, Tags: []string{}, CreatedAt: now.Add(-age)}
+		if tag != "" {
+			img.Tags = []string{tag}
+		}
+		return img
+	}
+	// Newest first, built without a project label
+	images := []cogImage{
+		image("a-2", "r8.im/user/a:v2", time.Hour),
+		image("b-1", "localhost:5000/b:latest", 2*time.Hour),
+		image("a-1", "r8.im/user/a:v1", 3*time.Hour),
+		image("untagged-1", "", 4*time.Hour),
+		image("untagged-2", "", 5*time.Hour),
+	}
+	ids := []string{}
+	for _, img := range imagesToPrune(images, pruneFilter{keepLatest: 1}, now, projectExists) {
+		ids = append(ids, img.ID)
+	}
+	// Only the older image of the same repository is removed
+	require.Equal(t, []string{"a-1"}, ids)
+}
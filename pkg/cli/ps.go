@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/go-units"
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var psJSON bool
+
+// psContainer is a container in the output of `cog ps --json`
+type psContainer struct {
+	ID            string    `json:"id"`
+	ProjectDir    string    `json:"project_dir"`
+	Command       string    `json:"command"`
+	Image         string    `json:"image"`
+	Ports         []string  `json:"ports"`
+	StartedAt     time.Time `json:"started_at"`
+	UptimeSeconds float64   `json:"uptime_seconds"`
+}
+
+func newPsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ps",
+		Short: "List running Cog containers",
+		RunE:  withJSONResult(cmdPs),
+		Args:  cobra.NoArgs,
+	}
+	cmd.Flags().BoolVar(&psJSON, "json", false, "Output the containers as a JSON array")
+
+	return cmd
+}
+
+func cmdPs(cmd *cobra.Command, args []string) error {
+	containers, err := docker.ContainerList(docker.LabelStartedAt)
+	if err != nil {
+		return fmt.Errorf("Failed to list containers: %w", err)
+	}
+	now := time.Now()
+	result := []psContainer{}
+	for _, cont := range containers {
+		result = append(result, psContainerFromSummary(cont, now))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].StartedAt.After(result[j].StartedAt)
+	})
+
+	if psJSON {
+		return writeJSONFlagOutput(result)
+	}
+	cmdResult.Containers = &result
+	if console.IsMachine() {
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(w, "CONTAINER ID\tPROJECT\tCOMMAND\tIMAGE\tPORTS\tUPTIME")
+	for _, c := range result {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			shortID(c.ID),
+			valueOrDash(c.ProjectDir),
+			valueOrDash(c.Command),
+			c.Image,
+			valueOrDash(strings.Join(c.Ports, ", ")),
+			units.HumanDuration(time.Duration(c.UptimeSeconds)*time.Second),
+		)
+	}
+	return w.Flush()
+}
+
+func psContainerFromSummary(cont types.Container, now time.Time) psContainer {
+	c := psContainer{
+		ID:         cont.ID,
+		ProjectDir: cont.Labels[docker.LabelProjectDir],
+		Command:    cont.Labels[docker.LabelCommand],
+		Image:      cont.Labels[docker.LabelImage],
+		Ports:      []string{},
+	}
+	if c.Image == "" {
+		c.Image = cont.Image
+	}
+	startedAt, err := time.Parse(time.RFC3339, cont.Labels[docker.LabelStartedAt])
+	if err != nil {
+		startedAt = time.Unix(cont.Created, 0)
+	}
+	c.StartedAt = startedAt.UTC()
+	c.UptimeSeconds = now.Sub(startedAt).Round(time.Second).Seconds()
+
+	for _, port := range cont.Ports {
+		if port.PublicPort == 0 {
+			continue
+		}
+		ip := port.IP
+		if ip == "" {
+			ip = "0.0.0.0"
+		}
+		c.Ports = append(c.Ports, fmt.Sprintf("%s:%d->%d/%s", ip, port.PublicPort, port.PrivatePort, port.Type))
+	}
+	sort.Strings(c.Ports)
+	return c
+}
+
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+func valueOrDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
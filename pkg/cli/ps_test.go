@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/docker"
+)
+
+func TestPsContainerFromSummary(t *testing.T) {
+	now := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	c := psContainerFromSummary(types.Container{
+		ID:    "0123456789abcdef",
+		Image: "sha256:abc",
+		Labels: map[string]string{
+			docker.LabelProjectDir: "/home/user/model",
+			docker.LabelCommand:    "serve",
+			docker.LabelImage:      "cog-model-base",
+			docker.LabelStartedAt:  "2022-09-01T11:58:30Z",
+		},
+		Ports: []types.Port{
+			{PrivatePort: 5000, Type: "tcp"},
+			{IP: "0.0.0.0", PrivatePort: 5000, PublicPort: 5001, Type: "tcp"},
+		},
+	}, now)
+
+	require.Equal(t, "/home/user/model", c.ProjectDir)
+	require.Equal(t, "serve", c.Command)
+	require.Equal(t, "cog-model-base", c.Image)
+	require.Equal(t, []string{"0.0.0.0:5001->5000/tcp"}, c.Ports)
+	require.Equal(t, 90.0, c.UptimeSeconds)
+	require.Equal(t, "0123456789ab", shortID(c.ID))
+}
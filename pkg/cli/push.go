@@ -8,6 +8,7 @@ import (
 
 	"github.com/replicate/cog/pkg/config"
 	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/errors"
 	"github.com/replicate/cog/pkg/global"
 	"github.com/replicate/cog/pkg/image"
 	"github.com/replicate/cog/pkg/util/console"
@@ -19,10 +20,11 @@ func newPushCommand() *cobra.Command {
 
 		Short:   "Build and push model in current directory to a Docker registry",
 		Example: `cog push registry.hooli.corp/hotdog-detector`,
-		RunE:    push,
+		RunE:    withJSONResult(push),
 		Args:    cobra.MaximumNArgs(1),
 	}
-	addBuildProgressOutputFlag(cmd)
+	addBuildFlags(cmd)
+	addCacheFlags(cmd)
 
 	return cmd
 }
@@ -42,20 +44,23 @@ func push(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("To push images, you must either set the 'image' option in cog.yaml or pass an image name as an argument. For example, 'cog push registry.hooli.corp/hotdog-detector'")
 	}
 
-	if err := image.Build(cfg, projectDir, imageName, buildProgressOutput); err != nil {
-		return err
+	lifecycle := newContainerLifecycle()
+	defer lifecycle.Close()
+
+	if err := image.Build(lifecycle.ctx, cfg, projectDir, imageName, buildOptions()); err != nil {
+		return lifecycle.Err(errors.BuildFailed(err))
 	}
 
 	console.Infof("\nPushing image '%s'...", imageName)
 
-	exitStatus := docker.Push(imageName)
-	if exitStatus == nil {
-		console.Infof("Image '%s' pushed", imageName)
-		replicatePrefix := fmt.Sprintf("%s/", global.ReplicateRegistryHost)
-		if strings.HasPrefix(imageName, replicatePrefix) {
-			replicatePage := fmt.Sprintf("https://%s", strings.Replace(imageName, global.ReplicateRegistryHost, global.ReplicateWebsiteHost, 1))
-			console.Infof("\nRun your model on Replicate:\n    %s", replicatePage)
-		}
+	if err := docker.Push(imageName); err != nil {
+		return lifecycle.Err(errors.PushFailed(err))
+	}
+	console.Infof("Image '%s' pushed", imageName)
+	replicatePrefix := fmt.Sprintf("%s/", global.ReplicateRegistryHost)
+	if strings.HasPrefix(imageName, replicatePrefix) {
+		replicatePage := fmt.Sprintf("https://%s", strings.Replace(imageName, global.ReplicateRegistryHost, global.ReplicateWebsiteHost, 1))
+		console.Infof("\nRun your model on Replicate:\n    %s", replicatePage)
 	}
-	return exitStatus
+	return lifecycle.Err(recordImage(lifecycle.ctx, imageName, true))
 }
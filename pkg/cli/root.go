@@ -2,9 +2,11 @@ package cli
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/spf13/cobra"
 
+	"github.com/replicate/cog/pkg/docker"
 	"github.com/replicate/cog/pkg/global"
 	"github.com/replicate/cog/pkg/update"
 	"github.com/replicate/cog/pkg/util/console"
@@ -24,14 +26,21 @@ https://github.com/replicate/cog`,
       $ cog run echo hello world`,
 		Version: fmt.Sprintf("%s (built %s)", global.Version, global.BuildTime),
 		// This stops errors being printed because we print them in cmd/cog/cog.go
-		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 			if global.Debug {
 				console.SetLevel(console.DebugLevel)
 			}
 			cmd.SilenceUsage = true
+			if err := setOutputFormat(outputFormat); err != nil {
+				return err
+			}
+			if _, err := docker.ParseRuntime(global.Runtime); err != nil {
+				return err
+			}
 			if err := update.DisplayAndCheckForRelease(); err != nil {
 				console.Debugf("%s", err)
 			}
+			return nil
 		},
 		SilenceErrors: true,
 	}
@@ -40,9 +49,18 @@ https://github.com/replicate/cog`,
 	rootCmd.AddCommand(
 		newBuildCommand(),
 		newDebugCommand(),
+		newImagesCommand(),
+		newInspectCommand(),
+		newLockCommand(),
+		newMigrateConfigCommand(),
 		newPredictCommand(),
+		newPruneCommand(),
+		newPsCommand(),
 		newPushCommand(),
 		newRunCommand(),
+		newServeCommand(),
+		newTestCommand(),
+		newValidateCommand(),
 		newLoginCommand(),
 		newInitCommand(),
 	)
@@ -54,5 +72,14 @@ func setPersistentFlags(cmd *cobra.Command) {
 	cmd.PersistentFlags().BoolVar(&global.Debug, "debug", false, "Show debugging output")
 	cmd.PersistentFlags().BoolVar(&global.ProfilingEnabled, "profile", false, "Enable profiling")
 	cmd.PersistentFlags().Bool("version", false, "Show version of Cog")
+	cmd.PersistentFlags().StringVar(&global.Runtime, "runtime", defaultRuntime(), "Container runtime to use: docker, podman or nerdctl. Defaults to $COG_RUNTIME, or docker")
+	cmd.PersistentFlags().StringVar(&outputFormat, "format", defaultOutputFormat(), "Output format: text or json. Defaults to $COG_OUTPUT, or text. With json, build, debug, predict, push, test and validate write a single JSON result to stdout and log JSON lines to stderr")
 	_ = cmd.PersistentFlags().MarkHidden("profile")
 }
+
+func defaultRuntime() string {
+	if runtime := os.Getenv("COG_RUNTIME"); runtime != "" {
+		return runtime
+	}
+	return string(docker.RuntimeDocker)
+}
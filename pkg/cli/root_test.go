@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatFlag(t *testing.T) {
+	rootCmd, err := NewRootCommand()
+	require.NoError(t, err)
+
+	cmd, args, err := rootCmd.Find([]string{"predict", "--format", "json", "-o", "out.png"})
+	require.NoError(t, err)
+	require.Equal(t, "predict", cmd.Name())
+	require.NoError(t, cmd.ParseFlags(args))
+	require.Equal(t, "json", outputFormat)
+	require.Equal(t, "out.png", outPath)
+
+	require.Error(t, setOutputFormat("bogus"))
+}
+
+func TestJSONFlags(t *testing.T) {
+	rootCmd, err := NewRootCommand()
+	require.NoError(t, err)
+
+	cmd, args, err := rootCmd.Find([]string{"ps", "--json"})
+	require.NoError(t, err)
+	require.NoError(t, cmd.ParseFlags(args))
+	require.True(t, psJSON)
+	cmd, args, err = rootCmd.Find([]string{"inspect", "--json", "r8.im/user/model"})
+	require.NoError(t, err)
+	require.NoError(t, cmd.ParseFlags(args))
+	require.True(t, inspectJSON)
+
+	require.NoError(t, setOutputFormat(outputFormatJSON))
+	defer func() { require.NoError(t, setOutputFormat(outputFormatText)) }()
+	require.ErrorContains(t, writeJSONFlagOutput([]psContainer{}), "--json can't be used with --format json")
+}
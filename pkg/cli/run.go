@@ -1,8 +1,11 @@
 package cli
 
 import (
+	"fmt"
+	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/replicate/cog/pkg/config"
 	"github.com/replicate/cog/pkg/docker"
@@ -22,7 +25,7 @@ func newRunCommand() *cobra.Command {
 		RunE:  run,
 		Args:  cobra.MinimumNArgs(1),
 	}
-	addBuildProgressOutputFlag(cmd)
+	addBuildFlags(cmd)
 
 	flags := cmd.Flags()
 	// Flags after first argment are considered args and passed to command
@@ -41,9 +44,12 @@ func run(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	imageName, err := image.BuildBase(cfg, projectDir, buildProgressOutput)
+	lifecycle := newContainerLifecycle()
+	defer lifecycle.Close()
+
+	imageName, err := image.BuildBase(lifecycle.ctx, cfg, projectDir, buildOptions())
 	if err != nil {
-		return err
+		return lifecycle.Err(err)
 	}
 
 	gpus := ""
@@ -52,9 +58,14 @@ func run(cmd *cobra.Command, args []string) error {
 	}
 
 	runOptions := docker.RunOptions{
-		Args:    args,
-		GPUs:    gpus,
-		Image:   imageName,
+		Args:  args,
+		GPUs:  gpus,
+		Image: imageName,
+		Labels: map[string]string{
+			docker.LabelCommand:    "run " + strings.Join(args, " "),
+			docker.LabelProjectDir: projectDir,
+		},
+		Name:    fmt.Sprintf("cog-run-%d", time.Now().UnixNano()),
 		Volumes: []docker.Volume{{Source: projectDir, Destination: "/src"}},
 		Workdir: "/src",
 	}
@@ -70,5 +81,10 @@ func run(cmd *cobra.Command, args []string) error {
 
 	console.Info("")
 	console.Infof("Running '%s' in Docker with the current directory mounted as a volume...", strings.Join(args, " "))
-	return docker.Run(runOptions)
+	// Cancelling the run only stops the docker CLI, so the container is registered before
+	// it starts, for the lifecycle to stop, or kill on a second Ctrl-C. If it exits by
+	// itself, it has already been removed, which Close ignores.
+	lifecycle.Add(runOptions.Name)
+	err = docker.DefaultClient().RunWithIO(lifecycle.ctx, runOptions, os.Stdin, os.Stdout, os.Stderr)
+	return lifecycle.Err(err)
 }
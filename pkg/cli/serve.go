@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/shell"
+)
+
+var servePort int
+
+func newServeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "serve [image]",
+		Short: "Run the model's HTTP server",
+		Long: `Run the model's HTTP server in the foreground.
+
+If 'image' is passed, it will serve that Docker image.
+It must be an image that has been built by Cog.
+
+Otherwise, it will build the model in the current directory and serve
+that, with the current directory mounted as a volume.`,
+		Example: `cog serve --port 8080`,
+		RunE:    cmdServe,
+		Args:    cobra.MaximumNArgs(1),
+	}
+	addBuildFlags(cmd)
+	cmd.Flags().IntVarP(&servePort, "port", "p", 5000, "Port on the host to serve on")
+
+	return cmd
+}
+
+func cmdServe(cmd *cobra.Command, args []string) error {
+	if shell.PortIsOpen(servePort) {
+		return fmt.Errorf("Port %d is already in use. Pass a different port with --port", servePort)
+	}
+
+	lifecycle := newContainerLifecycle()
+	defer lifecycle.Close()
+
+	runOptions, err := imageToRun(lifecycle.ctx, "serve", args)
+	if err != nil {
+		return lifecycle.Err(err)
+	}
+
+	console.Info("")
+	console.Infof("Starting Docker image %s and running setup()...", runOptions.Image)
+
+	predictor := predict.NewPredictor(runOptions)
+	err = predictor.StartOnPort(lifecycle.ctx, os.Stderr, servePort)
+	lifecycle.Add(predictor.ContainerID())
+	if err != nil {
+		return lifecycle.Err(err)
+	}
+
+	console.Info("")
+	console.Infof("Serving at %s", predictor.URL())
+	console.Infof("API documentation is at %s/docs", predictor.URL())
+	console.Info("Press Ctrl-C to stop.")
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-lifecycle.ctx.Done():
+			return nil
+		case <-ticker.C:
+			if !predictor.IsRunning() {
+				return fmt.Errorf("Container exited unexpectedly")
+			}
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/errors"
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+const (
+	exampleStatusPassed = "passed"
+	exampleStatusFailed = "failed"
+	exampleStatusError  = "error"
+)
+
+var testJUnitPath string
+
+// exampleResult is the result of running one of the examples in cog.yaml
+type exampleResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	// Message explains why the example failed
+	Message         string  `json:"message,omitempty"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+func newTestCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "test [image]",
+		Short: "Run the examples in " + global.ConfigFilename + " and check their outputs",
+		Long: `Run the examples in ` + global.ConfigFilename + ` and check their outputs.
+
+If 'image' is passed, the examples are run on that Docker image, which must have been
+built by Cog. Otherwise, the model in the current directory is built and run.
+
+Each example runs a prediction with its input. It passes if the prediction succeeds and
+the output matches the example's expected output, if it has one. This exits with a
+non-zero status if any examples fail, so it can be used in CI.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: withJSONResult(cmdTest),
+	}
+	addBuildFlags(cmd)
+	cmd.Flags().StringVar(&testJUnitPath, "junit", "", "Write the results to this path as a JUnit XML report")
+	return cmd
+}
+
+func cmdTest(cmd *cobra.Command, args []string) error {
+	lifecycle := newContainerLifecycle()
+	defer lifecycle.Close()
+
+	cfg, baseDir, err := exampleConfig(lifecycle.ctx, args)
+	if err != nil {
+		return lifecycle.Err(err)
+	}
+	if len(cfg.Examples) == 0 {
+		return fmt.Errorf("There are no examples to run. Add some to 'examples' in %s", global.ConfigFilename)
+	}
+
+	runOptions, err := imageToRun(lifecycle.ctx, "test", args)
+	if err != nil {
+		return lifecycle.Err(err)
+	}
+	cmdResult.Image = runOptions.Image
+
+	console.Info("")
+	console.Infof("Starting Docker image %s and running setup()...", runOptions.Image)
+
+	predictor := predict.NewPredictor(runOptions)
+	logsWriter, logsDone := console.LogWriter(console.InfoLevel)
+	defer logsDone()
+	err = predictor.Start(lifecycle.ctx, logsWriter)
+	lifecycle.Add(predictor.ContainerID())
+	if err != nil {
+		return lifecycle.Err(errors.SetupFailed(err))
+	}
+
+	schema, err := predictor.GetSchema()
+	if err != nil {
+		return lifecycle.Err(err)
+	}
+	fields, err := predict.InputFields(schema)
+	if err != nil {
+		return lifecycle.Err(err)
+	}
+
+	console.Infof("Running %d examples...", len(cfg.Examples))
+	start := time.Now()
+	results := runExamples(lifecycle.ctx, predictor, fields, cfg.Examples, baseDir)
+	cmdResult.Examples = results
+
+	if testJUnitPath != "" {
+		if err := writeJUnitReport(testJUnitPath, results, time.Since(start)); err != nil {
+			return lifecycle.Err(err)
+		}
+		console.Infof("Written JUnit report to %s", testJUnitPath)
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Status != exampleStatusPassed {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return lifecycle.Err(errors.TestFailed(fmt.Errorf("%d of %d examples failed", failed, len(results))))
+	}
+	console.Infof("\nAll %d examples passed", len(results))
+	return nil
+}
+
+// exampleConfig returns the config with the examples to run, and the directory that
+// files in them are relative to. With an image in args, the examples are the ones the
+// image was built with.
+func exampleConfig(ctx context.Context, args []string) (*config.Config, string, error) {
+	if len(args) == 0 {
+		return config.GetConfig(projectDirFlag)
+	}
+	baseDir, err := config.GetProjectDir(projectDirFlag)
+	if err != nil {
+		if baseDir, err = os.Getwd(); err != nil {
+			return nil, "", err
+		}
+	}
+	// If the image hasn't been pulled, this reads it from the registry, so there's no need
+	// to pull it if it doesn't have any examples
+	cfg, err := image.GetConfig(ctx, args[0])
+	if err != nil {
+		return nil, "", err
+	}
+	return cfg, baseDir, nil
+}
+
+// runExamples runs each example against a running predictor, one at a time, and checks
+// their outputs. The inputs are parsed against fields, the inputs in the model's schema,
+// and files in the examples are relative to baseDir.
+func runExamples(ctx context.Context, predictor predict.Predictor, fields []*predict.InputField, examples []*config.Example, baseDir string) []*exampleResult {
+	results := []*exampleResult{}
+	for i, example := range examples {
+		result := &exampleResult{Name: example.Name}
+		if result.Name == "" {
+			result.Name = fmt.Sprintf("example %d", i+1)
+		}
+
+		values := map[string][]string{}
+		for name, value := range example.Input {
+			values[name] = []string{value}
+		}
+		inputs, parseErr := predict.ParseInputsWithBaseDir(fields, values, baseDir)
+
+		start := time.Now()
+		var prediction *predict.Response
+		var err error
+		if parseErr == nil {
+			prediction, err = predictor.PredictWithContext(ctx, inputs)
+		}
+		result.DurationSeconds = time.Since(start).Seconds()
+		switch {
+		case parseErr != nil:
+			result.Status = exampleStatusError
+			result.Message = fmt.Sprintf("Invalid inputs:\n%s", parseErr)
+		case err != nil:
+			result.Status = exampleStatusError
+			result.Message = err.Error()
+		case prediction.Status != "succeeded":
+			result.Status = exampleStatusError
+			result.Message = fmt.Sprintf("Prediction failed: %s", prediction.Error)
+		default:
+			var output interface{}
+			if prediction.Output != nil {
+				output = *prediction.Output
+			}
+			if err := predict.CheckExampleOutput(example, output, baseDir); err != nil {
+				result.Status = exampleStatusFailed
+				result.Message = err.Error()
+			} else {
+				result.Status = exampleStatusPassed
+			}
+		}
+
+		if result.Status == exampleStatusPassed {
+			console.Infof("✅ %s (%.1fs)", result.Name, result.DurationSeconds)
+		} else {
+			console.Infof("❌ %s (%.1fs): %s", result.Name, result.DurationSeconds, result.Message)
+		}
+		results = append(results, result)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return results
+}
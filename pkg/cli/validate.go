@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"io/ioutil"
+	"path"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+func newValidateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "validate",
+		Aliases: []string{"lint"},
+		Short:   "Check cog.yaml and the files it refers to, without building an image",
+		Long: `Check cog.yaml and the files it refers to, without building an image.
+
+This checks that cog.yaml is valid, that the file in 'predict' exists and defines
+the predictor class, and that the files in 'python_requirements' and
+'conda_environment' exist. It exits with a non-zero status if there are any
+problems, so it can be used as a pre-commit hook.`,
+		Args: cobra.NoArgs,
+		RunE: withJSONResult(cmdValidate),
+	}
+	return cmd
+}
+
+func cmdValidate(cmd *cobra.Command, args []string) error {
+	cfg, projectDir, err := config.GetConfig(projectDirFlag)
+	errs := &config.ValidationErrors{}
+	if err != nil {
+		validationErrs, ok := err.(*config.ValidationErrors)
+		if !ok {
+			return err
+		}
+		errs.Errors = append(errs.Errors, validationErrs.Errors...)
+	}
+	if cfg != nil {
+		if err := cfg.ValidateProjectFiles(projectDir); err != nil {
+			errs.Errors = append(errs.Errors, err.(*config.ValidationErrors).Errors...)
+		}
+	}
+	if projectDir == "" {
+		projectDir, err = config.GetProjectDir(projectDirFlag)
+		if err != nil {
+			return err
+		}
+	}
+	cmdResult.Findings = errs.Errors
+
+	if len(errs.Errors) == 0 {
+		console.Infof("%s is valid", global.ConfigFilename)
+		return nil
+	}
+	if contents, err := ioutil.ReadFile(path.Join(projectDir, global.ConfigFilename)); err == nil {
+		errs.SetSource(global.ConfigFilename, contents)
+	}
+	return errs
+}
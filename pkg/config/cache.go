@@ -0,0 +1,75 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/replicate/cog/pkg/global"
+)
+
+const (
+	CacheTypeRegistry = "registry"
+	CacheTypeLocal    = "local"
+
+	// defaultCacheTag is the tag of the image the build cache is pushed to, in the
+	// repository of 'image'
+	defaultCacheTag = "buildcache"
+)
+
+// BuildCache is where the layers of the image are cached between builds, e.g. so CI
+// runners don't have to rebuild images from scratch
+type BuildCache struct {
+	// Type is registry or local
+	Type string `json:"type" yaml:"type"`
+	// Ref is the image the cache is pushed to with the registry type. Defaults to the
+	// buildcache tag in the repository of 'image'.
+	Ref string `json:"ref,omitempty" yaml:"ref"`
+	// Dir is the directory the cache is saved in with the local type, relative to the
+	// project directory. Defaults to a directory for the project in the user's cache
+	// directory, so it isn't part of the build context.
+	Dir string `json:"dir,omitempty" yaml:"dir"`
+}
+
+// CacheSpecs returns the specs to pass to 'docker buildx build --cache-from' and
+// '--cache-to' for a cache, filling in the defaults from config and the project directory
+func (b *BuildCache) CacheSpecs(config *Config, projectDir string) (from string, to string, err error) {
+	switch b.Type {
+	case CacheTypeRegistry:
+		ref := b.Ref
+		if ref == "" {
+			if config.Image == "" {
+				return "", "", fmt.Errorf("A registry build cache needs a ref, or 'image' to be set in %s so the cache can be pushed to the same repository", global.ConfigFilename)
+			}
+			ref = imageRepository(config.Image) + ":" + defaultCacheTag
+		}
+		return "type=registry,ref=" + ref, "type=registry,ref=" + ref + ",mode=max", nil
+	case CacheTypeLocal:
+		dir := b.Dir
+		if dir == "" {
+			cacheDir, err := os.UserCacheDir()
+			if err != nil {
+				return "", "", fmt.Errorf("Failed to find the cache directory for a local build cache: %w", err)
+			}
+			dir = filepath.Join(cacheDir, "cog", "build-cache", DockerImageName(projectDir))
+		}
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(projectDir, dir)
+		}
+		return "type=local,src=" + dir, "type=local,dest=" + dir + ",mode=max", nil
+	}
+	return "", "", fmt.Errorf("Unknown build cache type '%s', must be %s or %s", b.Type, CacheTypeRegistry, CacheTypeLocal)
+}
+
+// imageRepository returns an image name without its tag or digest
+func imageRepository(image string) string {
+	if i := strings.Index(image, "@"); i != -1 {
+		image = image[:i]
+	}
+	// A colon before the last slash is a registry port, not a tag
+	if i := strings.LastIndex(image, ":"); i != -1 && !strings.Contains(image[i:], "/") {
+		image = image[:i]
+	}
+	return image
+}
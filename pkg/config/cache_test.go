@@ -0,0 +1,39 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheSpecs(t *testing.T) {
+	config := &Config{Image: "r8.im/user/model:v1"}
+
+	from, to, err := (&BuildCache{Type: CacheTypeRegistry}).CacheSpecs(config, "/src")
+	require.NoError(t, err)
+	require.Equal(t, "type=registry,ref=r8.im/user/model:buildcache", from)
+	require.Equal(t, "type=registry,ref=r8.im/user/model:buildcache,mode=max", to)
+
+	from, _, err = (&BuildCache{Type: CacheTypeRegistry, Ref: "localhost:5000/cache"}).CacheSpecs(&Config{}, "/src")
+	require.NoError(t, err)
+	require.Equal(t, "type=registry,ref=localhost:5000/cache", from)
+
+	_, _, err = (&BuildCache{Type: CacheTypeRegistry}).CacheSpecs(&Config{}, "/src")
+	require.ErrorContains(t, err, "A registry build cache needs a ref")
+
+	t.Setenv("XDG_CACHE_HOME", "/home/user/.cache")
+	from, to, err = (&BuildCache{Type: CacheTypeLocal}).CacheSpecs(config, "/src/my-model")
+	require.NoError(t, err)
+	require.Equal(t, "type=local,src=/home/user/.cache/cog/build-cache/cog-my-model", from)
+	require.Equal(t, "type=local,dest=/home/user/.cache/cog/build-cache/cog-my-model,mode=max", to)
+
+	from, _, err = (&BuildCache{Type: CacheTypeLocal, Dir: "../cache"}).CacheSpecs(config, "/src/my-model")
+	require.NoError(t, err)
+	require.Equal(t, "type=local,src=/src/cache", from)
+}
+
+func TestImageRepository(t *testing.T) {
+	require.Equal(t, "r8.im/user/model", imageRepository("r8.im/user/model:v1"))
+	require.Equal(t, "localhost:5000/model", imageRepository("localhost:5000/model"))
+	require.Equal(t, "python", imageRepository("python:3.8@sha256:1111"))
+}
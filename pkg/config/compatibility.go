@@ -144,7 +144,7 @@ func cudaFromTF(ver string) (cuda string, cuDNN string, err error) {
 func compatibleCuDNNsForCUDA(cuda string) []string {
 	cuDNNs := []string{}
 	for _, image := range CUDABaseImages {
-		if image.CUDA == cuda {
+		if image.CUDA == cuda && image.IsDevel {
 			cuDNNs = append(cuDNNs, image.CuDNN)
 		}
 	}
@@ -194,7 +194,7 @@ func resolveMinorToPatch(minor string) (string, error) {
 func latestCuDNNForCUDA(cuda string) (string, error) {
 	cuDNNs := []string{}
 	for _, image := range CUDABaseImages {
-		if version.Equal(image.CUDA, cuda) {
+		if version.Equal(image.CUDA, cuda) && image.IsDevel {
 			cuDNNs = append(cuDNNs, image.CuDNN)
 		}
 	}
@@ -242,12 +242,26 @@ func versionGreater(a string, b string) (bool, error) {
 }
 
 func CUDABaseImageFor(cuda string, cuDNN string) (string, error) {
+	return cudaImageFor(cuda, cuDNN, true)
+}
+
+// CUDARuntimeImageFor returns the CUDA runtime image for a CUDA and CuDNN version, which
+// has the CUDA libraries but not the compilers and headers in the devel base image
+func CUDARuntimeImageFor(cuda string, cuDNN string) (string, error) {
+	return cudaImageFor(cuda, cuDNN, false)
+}
+
+func cudaImageFor(cuda string, cuDNN string, devel bool) (string, error) {
 	for _, image := range CUDABaseImages {
-		if version.Equal(image.CUDA, cuda) && image.CuDNN == cuDNN {
+		if version.Equal(image.CUDA, cuda) && image.CuDNN == cuDNN && image.IsDevel == devel {
 			return image.ImageTag(), nil
 		}
 	}
-	return "", fmt.Errorf("No matching base image for CUDA %s and CuDNN %s", cuda, cuDNN)
+	kind := "base"
+	if !devel {
+		kind = "runtime"
+	}
+	return "", fmt.Errorf("No matching %s image for CUDA %s and CuDNN %s", kind, cuda, cuDNN)
 }
 
 func tfGPUPackage(ver string, cuda string) (name string, cpuVersion string, err error) {
@@ -22,3 +22,12 @@ func TestResolveMinorToPatch(t *testing.T) {
 	_, err = resolveMinorToPatch("1214348324.432879432")
 	require.Error(t, err)
 }
+
+func TestCUDAImageFor(t *testing.T) {
+	devel, err := CUDABaseImageFor("11.2.0", "8")
+	require.NoError(t, err)
+	require.Equal(t, "nvidia/cuda:11.2.0-cudnn8-devel-ubuntu20.04", devel)
+	runtime, err := CUDARuntimeImageFor("11.2.0", "8")
+	require.NoError(t, err)
+	require.Equal(t, "nvidia/cuda:11.2.0-cudnn8-runtime-ubuntu20.04", runtime)
+}
@@ -2,16 +2,16 @@ package config
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 
 	"gopkg.in/yaml.v2"
 
+	"github.com/replicate/cog/pkg/global"
 	"github.com/replicate/cog/pkg/util/console"
 	"github.com/replicate/cog/pkg/util/slices"
 )
 
-// TODO(andreas): support conda packages
-// TODO(andreas): support dockerfiles
 // TODO(andreas): custom cpu/gpu installs
 // TODO(andreas): validate python_requirements
 // TODO(andreas): suggest valid torchvision versions (e.g. if the user wants to use 0.8.0, suggest 0.8.1)
@@ -28,17 +28,62 @@ type Build struct {
 	PreInstall           []string `json:"pre_install,omitempty" yaml:"pre_install"` // Deprecated, but included for backwards compatibility
 	CUDA                 string   `json:"cuda,omitempty" yaml:"cuda"`
 	CuDNN                string   `json:"cudnn,omitempty" yaml:"cudnn"`
+	CondaPackages        []string `json:"conda_packages,omitempty" yaml:"conda_packages"`
+	CondaChannels        []string `json:"conda_channels,omitempty" yaml:"conda_channels"`
+	CondaEnvironment     string   `json:"conda_environment,omitempty" yaml:"conda_environment"`
+	BaseImage            string   `json:"base_image,omitempty" yaml:"base_image"`
+	// Slim builds the model in a separate stage, so compilers and headers aren't in the final image
+	Slim bool `json:"slim,omitempty" yaml:"slim"`
+	// DockerfileSnippets are inserted into the generated Dockerfile
+	DockerfileSnippets *DockerfileSnippets `json:"dockerfile_snippets,omitempty" yaml:"dockerfile_snippets"`
+	Secrets            []Secret            `json:"secrets,omitempty" yaml:"secrets"`
+	// SSH are SSH agent sockets or keys to forward to pip, for git+ssh packages, in the same
+	// form as `docker build --ssh`
+	SSH []string `json:"ssh,omitempty" yaml:"ssh"`
+	// Cache is where the layers of the image are cached between builds
+	Cache *BuildCache `json:"cache,omitempty" yaml:"cache"`
 }
 
+// Secret is a file or environment variable that is available to the commands that install
+// packages while the image is built, without being saved in the image
+type Secret struct {
+	ID string `json:"id" yaml:"id"`
+	// Src is the path to a file with the secret in it, relative to the project directory
+	Src string `json:"src,omitempty" yaml:"src"`
+	// Env is the name of an environment variable with the secret in it
+	Env string `json:"env,omitempty" yaml:"env"`
+	// Target is where the secret is mounted while packages are installed. Defaults to /run/secrets/<id>
+	Target string `json:"target,omitempty" yaml:"target"`
+}
+
+type DockerfileSnippets struct {
+	// BeforeInstall is inserted before Python and the model's dependencies are installed
+	BeforeInstall string `json:"before_install,omitempty" yaml:"before_install"`
+	// AfterInstall is inserted after the model's dependencies are installed and 'run' commands have run
+	AfterInstall string `json:"after_install,omitempty" yaml:"after_install"`
+}
+
+// Example is an input to the model and the output it should return, which 'cog test' checks
 type Example struct {
-	Input  map[string]string `json:"input" yaml:"input"`
-	Output string            `json:"output" yaml:"output"`
+	// Name identifies the example in test results. It defaults to its position in the list.
+	Name  string            `json:"name,omitempty" yaml:"name"`
+	Input map[string]string `json:"input" yaml:"input"`
+	// Output is the expected output. It is a string, a JSON value, a file in the project
+	// prefixed with @, or the SHA-256 hash of an output file in the form sha256:<hex>.
+	// If it's empty, the prediction only has to succeed.
+	Output string `json:"output,omitempty" yaml:"output"`
+	// Tolerance is how far numbers in the output can be from the ones in Output
+	Tolerance float64 `json:"tolerance,omitempty" yaml:"tolerance"`
 }
 
 type Config struct {
+	// Version is the version of the cog.yaml format, which is defaultVersion if it isn't set
+	Version string `json:"version,omitempty" yaml:"version"`
 	Build   *Build `json:"build" yaml:"build"`
 	Image   string `json:"image,omitempty" yaml:"image"`
 	Predict string `json:"predict,omitempty" yaml:"predict"`
+	// Examples are run by 'cog test'
+	Examples []*Example `json:"examples,omitempty" yaml:"examples"`
 }
 
 func DefaultConfig() *Config {
@@ -53,12 +98,22 @@ func DefaultConfig() *Config {
 func FromYAML(contents []byte) (*Config, error) {
 	config := DefaultConfig()
 	if err := yaml.Unmarshal(contents, config); err != nil {
+		// Options with the wrong type fail to unmarshal, but the schema explains what's wrong better
+		if schemaErr := Validate(string(contents), versionOf(contents)); schemaErr != nil {
+			if _, ok := schemaErr.(*ValidationErrors); ok {
+				return nil, schemaErr
+			}
+		}
 		return nil, fmt.Errorf("Failed to parse config yaml: %w", err)
 	}
 	// Everything assumes Build is not nil
 	if len(contents) != 0 && config.Build != nil {
-		err := Validate(string(contents), "")
+		err := Validate(string(contents), config.Version)
 		if err != nil {
+			// Check the rest of the options too, so all the problems can be fixed at once
+			if errs, ok := err.(*ValidationErrors); ok {
+				config.validateOptions(errs)
+			}
 			return nil, err
 		}
 	} else {
@@ -67,10 +122,24 @@ func FromYAML(contents []byte) (*Config, error) {
 	return config, nil
 }
 
+// versionOf returns the version in a cog.yaml that can't be parsed into a Config, so the
+// right schema can be used to explain what's wrong with it
+func versionOf(contents []byte) string {
+	var versioned struct {
+		Version string `yaml:"version"`
+	}
+	_ = yaml.Unmarshal(contents, &versioned)
+	return versioned.Version
+}
+
 func (c *Config) CUDABaseImageTag() (string, error) {
 	return CUDABaseImageFor(c.Build.CUDA, c.Build.CuDNN)
 }
 
+func (c *Config) CUDARuntimeImageTag() (string, error) {
+	return CUDARuntimeImageFor(c.Build.CUDA, c.Build.CuDNN)
+}
+
 func (c *Config) cudasFromTorch() (torchVersion string, torchCUDAs []string, err error) {
 	if version, ok := c.pythonPackageVersion("torch"); ok {
 		cudas, err := cudasFromTorch(version)
@@ -93,6 +162,16 @@ func (c *Config) cudaFromTF() (tfVersion string, tfCUDA string, tfCuDNN string,
 	return "", "", "", nil
 }
 
+// pythonPackageField returns the path in cog.yaml to a Python package, for validation errors
+func (c *Config) pythonPackageField(name string) string {
+	for i, pkg := range c.Build.PythonPackages {
+		if pkgName, _, err := splitPythonPackage(pkg); err == nil && pkgName == name {
+			return fmt.Sprintf("build.python_packages.%d", i)
+		}
+	}
+	return "build.python_packages"
+}
+
 func (c *Config) pythonPackageVersion(name string) (version string, ok bool) {
 	for _, pkg := range c.Build.PythonPackages {
 		pkgName, version, err := splitPythonPackage(pkg)
@@ -108,38 +187,135 @@ func (c *Config) pythonPackageVersion(name string) (version string, ok bool) {
 	return "", false
 }
 
+// ValidateAndCompleteConfig checks the config is valid, returning ValidationErrors with
+// all the problems it finds. CUDA and CuDNN versions are filled in if they're not set.
 func (c *Config) ValidateAndCompleteConfig() error {
-	// TODO(andreas): return all errors at once, rather than
-	// whack-a-mole one at a time with errs := []error{}, etc.
-
 	// TODO(andreas): validate that torch/torchvision/torchaudio are compatible
 	// TODO(andreas): warn if user specifies tensorflow-gpu instead of tensorflow
 	// TODO(andreas): use pypi api to validate that all python versions exist
 
-	err := ValidateConfig(c, "")
-	if err != nil {
-		return err
+	errs := &ValidationErrors{}
+	if err := ValidateConfig(c, c.Version); err != nil {
+		errs.addError("", err)
 	}
+	c.validateOptions(errs)
+	if len(c.Build.PreInstall) > 0 {
+		console.Warnf("pre_install in %s is deprecated. Run 'cog migrate-config' to move the commands into run.", global.ConfigFilename)
+	}
+	return errs.errOrNil()
+}
+
+// validateOptions adds problems that the schema can't catch to errs
+func (c *Config) validateOptions(errs *ValidationErrors) {
 	if c.Predict != "" {
 		if len(strings.Split(c.Predict, ".py:")) != 2 {
-			return fmt.Errorf("'predict' in cog.yaml must be in the form 'predict.py:Predictor")
+			errs.add("predict", "'predict' in cog.yaml must be in the form 'predict.py:Predictor'")
 		}
 	}
 
-	if err := c.validatePythonPackagesHaveVersions(); err != nil {
-		return err
-	}
+	c.validatePythonPackagesHaveVersions(errs)
 
 	if c.Build.GPU {
 		if err := c.validateAndCompleteCUDA(); err != nil {
-			return err
+			errs.addError("build.cuda", err)
+		}
+	}
+
+	c.validateDockerfileSnippets(errs)
+	c.validateSecrets(errs)
+	for i, ssh := range c.Build.SSH {
+		if err := ValidateSSH(ssh); err != nil {
+			errs.addError(fmt.Sprintf("build.ssh.%d", i), err)
+		}
+	}
+
+	// The schema checks the type
+	if c.Build.Cache != nil && c.Build.Cache.Type == CacheTypeRegistry {
+		if _, _, err := c.Build.Cache.CacheSpecs(c, ""); err != nil {
+			errs.addError("build.cache", err)
 		}
 	}
 
+	if c.Build.Slim && c.Build.BaseImage != "" {
+		errs.add("build.slim", "slim can't be used with base_image, because Cog doesn't know what image to run the model in")
+	}
+
 	if len(c.Build.PythonPackages) > 0 && c.Build.PythonRequirements != "" {
-		return fmt.Errorf("Only one of python_packages or python_requirements can be set in your cog.yaml, not both")
+		errs.add("build.python_requirements", "Only one of python_packages or python_requirements can be set in your cog.yaml, not both")
 	}
+}
+
+// UsesConda returns true if a conda environment needs to be created for the model
+func (c *Config) UsesConda() bool {
+	return len(c.Build.CondaPackages) > 0 || c.Build.CondaEnvironment != ""
+}
 
+func (c *Config) validateDockerfileSnippets(errs *ValidationErrors) {
+	snippets := c.Build.DockerfileSnippets
+	if snippets == nil {
+		return
+	}
+	for field, snippet := range map[string]string{
+		"build.dockerfile_snippets.before_install": snippets.BeforeInstall,
+		"build.dockerfile_snippets.after_install":  snippets.AfterInstall,
+	} {
+		for _, line := range strings.Split(snippet, "\n") {
+			fields := strings.Fields(line)
+			if len(fields) > 0 && strings.EqualFold(fields[0], "FROM") {
+				errs.add(field, "Dockerfile snippets can't contain FROM instructions. Use 'base_image' to set the image to build from")
+				break
+			}
+		}
+	}
+}
+
+var secretIDRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+func (c *Config) validateSecrets(errs *ValidationErrors) {
+	ids := map[string]bool{}
+	for i, secret := range c.Build.Secrets {
+		field := fmt.Sprintf("build.secrets.%d", i)
+		if !secretIDRegexp.MatchString(secret.ID) {
+			errs.add(field+".id", "Secret IDs can only contain letters, numbers, '_', '.' and '-'")
+		} else if ids[secret.ID] {
+			errs.add(field+".id", "There is more than one secret with the ID %s", secret.ID)
+		}
+		ids[secret.ID] = true
+		if (secret.Src == "") == (secret.Env == "") {
+			errs.add(field, "Secret %s must have one of src or env", secret.ID)
+		}
+	}
+}
+
+// ValidateSSH checks an SSH agent socket or key is in the form default, default=/path/to/key
+// or myid=/path/to/agent.sock
+func ValidateSSH(ssh string) error {
+	id := SSHID(ssh)
+	if !secretIDRegexp.MatchString(id) {
+		return fmt.Errorf("'%s' isn't a valid SSH agent or key. It must be in the form 'default' or 'id=/path/to/key', and IDs can only contain letters, numbers, '_', '.' and '-'", ssh)
+	}
+	return nil
+}
+
+// SSHID returns the ID of an SSH agent socket or key in the form id=/path/to/key
+func SSHID(ssh string) string {
+	return strings.SplitN(ssh, "=", 2)[0]
+}
+
+// ValidateBaseImagePython checks that the version of Python in the base image is
+// compatible with python_version. version is empty if the base image doesn't have
+// Python, in which case Cog installs it.
+func (c *Config) ValidateBaseImagePython(version string) error {
+	if version == "" || c.UsesConda() {
+		return nil
+	}
+	want := c.Build.PythonVersion
+	// python_version can be a minor version like 3.8, which matches any 3.8.x
+	wantParts := strings.Split(want, ".")
+	gotParts := strings.Split(version, ".")
+	if len(gotParts) < len(wantParts) || strings.Join(gotParts[:len(wantParts)], ".") != want {
+		return fmt.Errorf("The base image %s has Python %s, but python_version in cog.yaml is %s. Set python_version to match the base image, or use a base image without Python so Cog can install it", c.Build.BaseImage, version, want)
+	}
 	return nil
 }
 
@@ -212,7 +388,7 @@ func (c *Config) validateAndCompleteCUDA() error {
 	if c.Build.CUDA != "" && c.Build.CuDNN != "" {
 		compatibleCuDNNs := compatibleCuDNNsForCUDA(c.Build.CUDA)
 		if !sliceContains(compatibleCuDNNs, c.Build.CuDNN) {
-			return fmt.Errorf(`The specified CUDA version %s is not compatible with CuDNN %s.
+			return fieldErrorf("build.cudnn", `The specified CUDA version %s is not compatible with CuDNN %s.
 Compatible CuDNN versions are: %s`, c.Build.CUDA, c.Build.CuDNN, strings.Join(compatibleCuDNNs, ","))
 		}
 	}
@@ -231,7 +407,7 @@ Compatible CuDNN versions are: %s`, c.Build.CUDA, c.Build.CuDNN, strings.Join(co
 	if tfVersion != "" {
 		if c.Build.CUDA == "" {
 			if tfCuDNN == "" {
-				return fmt.Errorf("Cog doesn't know what CUDA version is compatible with tensorflow==%s. You might need to upgrade Cog: https://github.com/replicate/cog#upgrade\n\nIf that doesn't work, you need to set the 'cuda' option in cog.yaml to set what version to use. You might be able to find this out from https://www.tensorflow.org/", tfVersion)
+				return fieldErrorf(c.pythonPackageField("tensorflow"), "Cog doesn't know what CUDA version is compatible with tensorflow==%s. You might need to upgrade Cog: https://github.com/replicate/cog#upgrade\n\nIf that doesn't work, you need to set the 'cuda' option in cog.yaml to set what version to use. You might be able to find this out from https://www.tensorflow.org/", tfVersion)
 			}
 			console.Debugf("Setting CUDA to version %s from Tensorflow version", tfCUDA)
 			c.Build.CUDA = tfCUDA
@@ -250,14 +426,14 @@ Compatible CuDNN versions are: %s`, c.Build.CUDA, c.Build.CuDNN, strings.Join(co
 			console.Debugf("Setting CuDNN to version %s", c.Build.CUDA)
 		} else if tfCuDNN != c.Build.CuDNN {
 			console.Warnf("Cog doesn't know if cuDNN %s is compatible with Tensorflow %s. This might cause CUDA problems.", c.Build.CuDNN, tfVersion)
-			return fmt.Errorf(`The specified cuDNN version %s is not compatible with tensorflow==%s.
+			return fieldErrorf("build.cudnn", `The specified cuDNN version %s is not compatible with tensorflow==%s.
 Compatible cuDNN version is: %s`,
 				c.Build.CuDNN, tfVersion, tfCuDNN)
 		}
 	} else if torchVersion != "" {
 		if c.Build.CUDA == "" {
 			if len(torchCUDAs) == 0 {
-				return fmt.Errorf("Cog doesn't know what CUDA version is compatible with torch==%s. You might need to upgrade Cog: https://github.com/replicate/cog#upgrade\n\nIf that doesn't work, you need to set the 'cuda' option in cog.yaml to set what version to use. You might be able to find this out from https://pytorch.org/", torchVersion)
+				return fieldErrorf(c.pythonPackageField("torch"), "Cog doesn't know what CUDA version is compatible with torch==%s. You might need to upgrade Cog: https://github.com/replicate/cog#upgrade\n\nIf that doesn't work, you need to set the 'cuda' option in cog.yaml to set what version to use. You might be able to find this out from https://pytorch.org/", torchVersion)
 			}
 			c.Build.CUDA = latestCUDAFrom(torchCUDAs)
 			c.Build.CUDA, err = resolveMinorToPatch(c.Build.CUDA)
@@ -294,19 +470,12 @@ Compatible cuDNN version is: %s`,
 	return nil
 }
 
-func (c *Config) validatePythonPackagesHaveVersions() error {
-	packagesWithoutVersions := []string{}
-	for _, pkg := range c.Build.PythonPackages {
-		_, _, err := splitPythonPackage(pkg)
-		if err != nil {
-			packagesWithoutVersions = append(packagesWithoutVersions, pkg)
+func (c *Config) validatePythonPackagesHaveVersions(errs *ValidationErrors) {
+	for i, pkg := range c.Build.PythonPackages {
+		if _, _, err := splitPythonPackage(pkg); err != nil {
+			errs.add(fmt.Sprintf("build.python_packages.%d", i), "Python packages must have pinned versions, e.g. mypkg==1.0.0. %s is missing a pinned version", pkg)
 		}
 	}
-	if len(packagesWithoutVersions) > 0 {
-		return fmt.Errorf(`All Python packages must have pinned versions, e.g. mypkg==1.0.0.
-The following packages are missing pinned versions: %s`, strings.Join(packagesWithoutVersions, ","))
-	}
-	return nil
 }
 
 func splitPythonPackage(pkg string) (name string, version string, err error) {
@@ -38,18 +38,25 @@ func GetConfig(customDir string) (*Config, string, error) {
 	configPath := path.Join(rootDir, global.ConfigFilename)
 
 	// Then try to load the config file from there
-	config, err := loadConfigFromFile(configPath)
+	contents, err := readConfigFile(configPath)
 	if err != nil {
 		return nil, "", err
 	}
-
-	err = config.ValidateAndCompleteConfig()
+	config, err := FromYAML(contents)
+	if err == nil {
+		err = config.ValidateAndCompleteConfig()
+	}
+	if errs, ok := err.(*ValidationErrors); ok {
+		errs.SetSource(global.ConfigFilename, contents)
+	}
+	if config == nil {
+		return nil, "", err
+	}
 
 	return config, rootDir, err
 }
 
-// Given a file path, attempt to load a config from that file
-func loadConfigFromFile(file string) (*Config, error) {
+func readConfigFile(file string) ([]byte, error) {
 	exists, err := files.Exists(file)
 	if err != nil {
 		return nil, err
@@ -59,18 +66,7 @@ func loadConfigFromFile(file string) (*Config, error) {
 		return nil, fmt.Errorf("%s does not exist in %s. Are you in the right directory?", global.ConfigFilename, filepath.Dir(file))
 	}
 
-	contents, err := ioutil.ReadFile(file)
-	if err != nil {
-		return nil, err
-	}
-
-	config, err := FromYAML(contents)
-	if err != nil {
-		return nil, err
-	}
-
-	return config, nil
-
+	return ioutil.ReadFile(file)
 }
 
 // Given a directory, find the cog config file in that directory
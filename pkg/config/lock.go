@@ -0,0 +1,104 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/replicate/cog/pkg/global"
+)
+
+const lockHeader = `# This file is generated by 'cog lock'. Don't edit it by hand.
+# It pins the exact versions of the packages installed when the image was built, so
+# rebuilding the image installs the same versions.
+`
+
+// Lock is the fully resolved versions of the packages installed in an image, which is
+// saved in cog.lock next to cog.yaml
+type Lock struct {
+	// ConfigHash is the hash of the build options in cog.yaml the lock was made from
+	ConfigHash string `yaml:"config_hash"`
+	// PythonPackages are every Python package installed by pip, as output by pip freeze
+	PythonPackages []string `yaml:"python_packages"`
+	// SystemPackages are the APT packages installed on top of the base image, in the form
+	// name=version: the ones in system_packages, and the packages they depend on
+	SystemPackages []string `yaml:"system_packages"`
+	// CondaPackages are the packages in the conda environment, if there is one, as URLs
+	// in the format of an explicit environment file
+	CondaPackages []string `yaml:"conda_packages,omitempty"`
+	// BaseImages are the images the image was built from, pinned to their digests, like
+	// python:3.8@sha256:...
+	BaseImages []string `yaml:"base_images,omitempty"`
+}
+
+// BuildHash returns a hash of the build options, so a lock can be checked against them.
+// The requirements and conda environment files in projectDir are part of it too, because
+// changing them changes what is installed.
+func (c *Config) BuildHash(projectDir string) (string, error) {
+	// Where the build is cached doesn't change what's in the image
+	build := *c.Build
+	build.Cache = nil
+	data, err := json.Marshal(build)
+	if err != nil {
+		return "", fmt.Errorf("Failed to convert config to JSON: %w", err)
+	}
+	hash := sha256.New()
+	hash.Write(data)
+	for _, filename := range []string{build.PythonRequirements, build.CondaEnvironment} {
+		if filename == "" {
+			continue
+		}
+		contents, err := ioutil.ReadFile(filepath.Join(projectDir, filename))
+		if err != nil {
+			return "", fmt.Errorf("Failed to read %s: %w", filename, err)
+		}
+		hash.Write([]byte{0})
+		hash.Write(contents)
+	}
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// IsUpToDate returns true if the lock was made from the build options in config and the
+// files they refer to in projectDir
+func (l *Lock) IsUpToDate(config *Config, projectDir string) (bool, error) {
+	hash, err := config.BuildHash(projectDir)
+	if err != nil {
+		return false, err
+	}
+	return l.ConfigHash == hash, nil
+}
+
+// ReadLock reads cog.lock from the project directory, returning nil if it doesn't exist
+func ReadLock(projectDir string) (*Lock, error) {
+	contents, err := ioutil.ReadFile(filepath.Join(projectDir, global.LockFilename))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %s: %w", global.LockFilename, err)
+	}
+	lock := new(Lock)
+	if err := yaml.Unmarshal(contents, lock); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %w", global.LockFilename, err)
+	}
+	return lock, nil
+}
+
+// Write writes the lock to cog.lock in the project directory
+func (l *Lock) Write(projectDir string) error {
+	data, err := yaml.Marshal(l)
+	if err != nil {
+		return fmt.Errorf("Failed to convert lock to YAML: %w", err)
+	}
+	path := filepath.Join(projectDir, global.LockFilename)
+	if err := ioutil.WriteFile(path, append([]byte(lockHeader), data...), 0o644); err != nil {
+		return fmt.Errorf("Failed to write %s: %w", path, err)
+	}
+	return nil
+}
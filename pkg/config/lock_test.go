@@ -0,0 +1,63 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockReadWrite(t *testing.T) {
+	dir := t.TempDir()
+
+	lock, err := ReadLock(dir)
+	require.NoError(t, err)
+	require.Nil(t, lock)
+
+	config := DefaultConfig()
+	config.Build.PythonPackages = []string{"torch==1.12.1"}
+	hash, err := config.BuildHash(dir)
+	require.NoError(t, err)
+
+	lock = &Lock{
+		ConfigHash:     hash,
+		PythonPackages: []string{"numpy==1.23.2", "torch==1.12.1", "typing_extensions==4.3.0"},
+		SystemPackages: []string{"ffmpeg=7:4.2.7-0ubuntu0.1"},
+	}
+	require.NoError(t, lock.Write(dir))
+
+	read, err := ReadLock(dir)
+	require.NoError(t, err)
+	require.Equal(t, lock, read)
+
+	upToDate, err := read.IsUpToDate(config, dir)
+	require.NoError(t, err)
+	require.True(t, upToDate)
+
+	config.Build.PythonPackages = append(config.Build.PythonPackages, "pandas==1.4.3")
+	upToDate, err = read.IsUpToDate(config, dir)
+	require.NoError(t, err)
+	require.False(t, upToDate)
+}
+
+func TestLockRequirementsFile(t *testing.T) {
+	dir := t.TempDir()
+	requirementsPath := filepath.Join(dir, "requirements.txt")
+	require.NoError(t, os.WriteFile(requirementsPath, []byte("torch==1.12.1\n"), 0o644))
+
+	config := DefaultConfig()
+	config.Build.PythonRequirements = "requirements.txt"
+	hash, err := config.BuildHash(dir)
+	require.NoError(t, err)
+	lock := &Lock{ConfigHash: hash}
+
+	upToDate, err := lock.IsUpToDate(config, dir)
+	require.NoError(t, err)
+	require.True(t, upToDate)
+
+	require.NoError(t, os.WriteFile(requirementsPath, []byte("torch==1.12.1\npandas==1.4.3\n"), 0o644))
+	upToDate, err = lock.IsUpToDate(config, dir)
+	require.NoError(t, err)
+	require.False(t, upToDate)
+}
@@ -0,0 +1,339 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/replicate/cog/pkg/global"
+)
+
+// migration updates a cog.yaml document from one version to the next, returning a
+// description of each change it made
+type migration struct {
+	from  string
+	to    string
+	apply func(doc *document) ([]string, error)
+}
+
+// migrations are applied in order, starting from the one for the config's version
+var migrations = []migration{
+	{from: "1.0", to: "1.1", apply: migratePreInstall},
+}
+
+// document is the contents of cog.yaml, as lines of text, and the YAML parsed from them.
+// Migrations edit the lines, using the positions of the nodes to find what to change, so
+// the rest of the file is kept exactly as it was, including comments and blank lines.
+type document struct {
+	// lines each end with their line ending, apart from the last one
+	lines []string
+	// root is the mapping at the top of the file, or nil if the file is empty
+	root *yaml.Node
+}
+
+func parseDocument(contents string) (*document, error) {
+	doc := new(yaml.Node)
+	if err := yaml.Unmarshal([]byte(contents), doc); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %w", global.ConfigFilename, err)
+	}
+	d := &document{lines: strings.SplitAfter(contents, "\n")}
+	if doc.Kind == 0 {
+		// An empty file
+		return d, nil
+	}
+	d.root = doc.Content[0]
+	if d.root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s must be a mapping", global.ConfigFilename)
+	}
+	if d.root.Style&yaml.FlowStyle != 0 {
+		return nil, fmt.Errorf("Cog can only migrate %s if it's written in block style, not as {...}", global.ConfigFilename)
+	}
+	return d, nil
+}
+
+func (d *document) String() string {
+	return strings.Join(d.lines, "")
+}
+
+// Migrate rewrites the contents of cog.yaml in the latest version of the format,
+// replacing deprecated options with their equivalents. Only the lines that need to change
+// are rewritten, so comments and formatting are kept. It returns the new contents and a
+// description of each change, which is empty if the config is already the latest version.
+func Migrate(contents []byte) ([]byte, []string, error) {
+	doc, err := parseDocument(string(contents))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	version := defaultVersion
+	if doc.root != nil {
+		if versionNode := mappingValue(doc.root, "version"); versionNode != nil {
+			version = versionNode.Value
+		}
+	}
+	if version == LatestVersion {
+		return contents, []string{}, nil
+	}
+
+	changes := []string{}
+	start := -1
+	for i, m := range migrations {
+		if m.from == version {
+			start = i
+			break
+		}
+	}
+	if start == -1 {
+		return nil, nil, fmt.Errorf("Cog doesn't know how to migrate version %s of %s", version, global.ConfigFilename)
+	}
+	for _, m := range migrations[start:] {
+		migrationChanges, err := m.apply(doc)
+		if err != nil {
+			return nil, nil, err
+		}
+		changes = append(changes, migrationChanges...)
+		version = m.to
+		// Parse the edited lines, so the next migration has the new positions of the nodes
+		if doc, err = parseDocument(doc.String()); err != nil {
+			return nil, nil, fmt.Errorf("Failed to migrate %s: %w", global.ConfigFilename, err)
+		}
+	}
+
+	doc.setVersion(version)
+	changes = append(changes, fmt.Sprintf("Set version to %s", version))
+	return []byte(doc.String()), changes, nil
+}
+
+// setVersion sets the version key, adding it at the top of the file if there isn't one
+func (d *document) setVersion(version string) {
+	// Quoted, so it isn't read as a number
+	value := fmt.Sprintf("%q", version)
+	if d.root == nil {
+		at := len(d.lines)
+		if d.lines[at-1] == "" {
+			// After the last line ending
+			at--
+		}
+		d.insertLines(at, []string{"version: " + value + "\n"})
+		return
+	}
+	if i := mappingKeyIndex(d.root, "version"); i != -1 {
+		key, node := d.root.Content[i], d.root.Content[i+1]
+		if node.Line == key.Line {
+			line := d.lines[node.Line-1]
+			newLine := line[:node.Column-1] + value
+			if node.LineComment != "" {
+				newLine += " " + node.LineComment
+			}
+			d.lines[node.Line-1] = newLine + lineEnding(line)
+			return
+		}
+		// The value is on a line of its own, so replace the whole entry
+		d.replaceLines(key.Line-1, d.entryEnd(key), []string{indentation(d.lines[key.Line-1]) + "version: " + value + "\n"})
+		return
+	}
+	// Above the first key, so comments at the top of the file stay at the top
+	first := d.root.Content[0]
+	d.insertLines(first.Line-1, []string{strings.Repeat(" ", first.Column-1) + "version: " + value + "\n"})
+}
+
+// migratePreInstall moves the commands in build.pre_install to the end of build.run,
+// which is where they were run
+func migratePreInstall(doc *document) ([]string, error) {
+	if doc.root == nil {
+		return nil, nil
+	}
+	build := mappingValue(doc.root, "build")
+	if build == nil || build.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	keyIndex := mappingKeyIndex(build, "pre_install")
+	if keyIndex == -1 {
+		return nil, nil
+	}
+	if build.Style&yaml.FlowStyle != 0 {
+		return nil, fmt.Errorf("Cog can only migrate build.pre_install if build is written in block style, not as {...}")
+	}
+	preInstallKey := build.Content[keyIndex]
+	preInstall := build.Content[keyIndex+1]
+
+	runIndex := mappingKeyIndex(build, "run")
+	var runKey, run *yaml.Node
+	if runIndex != -1 {
+		runKey, run = build.Content[runIndex], build.Content[runIndex+1]
+	}
+	if run == nil || run.Kind != yaml.SequenceNode {
+		if run != nil && run.Tag != "!!null" {
+			// Not something Cog can build from, so leave it for validation to report
+			return nil, nil
+		}
+		// There's nothing in run, so pre_install can just be renamed. The rename doesn't
+		// change the number of lines, so it's done before removing run.
+		if err := doc.renameKey(preInstallKey, "run"); err != nil {
+			return nil, err
+		}
+		if run != nil {
+			doc.removeEntry(runKey)
+		}
+		return []string{"Renamed build.pre_install to build.run"}, nil
+	}
+
+	var moved []string
+	insertStart, insertEnd := doc.entryEnd(runKey), doc.entryEnd(runKey)
+	switch {
+	case preInstall.Kind != yaml.SequenceNode || len(preInstall.Content) == 0:
+		// Nothing to move
+	case run.Style&yaml.FlowStyle == 0 && preInstall.Style&yaml.FlowStyle == 0:
+		// Move the lines of the commands, and comments above pre_install, to the end of run
+		runIndent := indentation(doc.lines[run.Content[0].Line-1])
+		preInstallIndent := indentation(doc.lines[preInstall.Content[0].Line-1])
+		for i := doc.commentStart(preInstallKey); i < preInstallKey.Line-1; i++ {
+			moved = append(moved, runIndent+strings.TrimLeft(doc.lines[i], " \t"))
+		}
+		for _, line := range doc.lines[preInstallKey.Line:doc.entryEnd(preInstallKey)] {
+			if strings.TrimSpace(line) != "" {
+				line = runIndent + strings.TrimPrefix(line, preInstallIndent)
+			}
+			moved = append(moved, line)
+		}
+	default:
+		// One of them is a list in flow style, like [...], so write run out again in block style
+		items := &yaml.Node{Kind: yaml.SequenceNode, Content: append(append([]*yaml.Node{}, run.Content...), preInstall.Content...)}
+		var buf bytes.Buffer
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(items); err != nil {
+			return nil, fmt.Errorf("Failed to write build.run: %w", err)
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, fmt.Errorf("Failed to write build.run: %w", err)
+		}
+		keyIndent := indentation(doc.lines[runKey.Line-1])
+		moved = []string{keyIndent + "run:\n"}
+		for _, line := range strings.SplitAfter(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+			moved = append(moved, keyIndent+"  "+strings.TrimSuffix(line, "\n")+"\n")
+		}
+		insertStart = runKey.Line - 1
+	}
+
+	// Edit the lines further down the file first, so the line numbers of the other edit
+	// stay the same
+	removeStart := doc.commentStart(preInstallKey)
+	if removeStart >= insertEnd {
+		doc.removeEntry(preInstallKey)
+		doc.replaceLines(insertStart, insertEnd, moved)
+	} else {
+		doc.replaceLines(insertStart, insertEnd, moved)
+		doc.removeEntry(preInstallKey)
+	}
+	return []string{"Moved the commands in build.pre_install to the end of build.run"}, nil
+}
+
+// entryEnd returns the index of the line after the value of the mapping key, not counting
+// blank lines and comments after it, which belong to whatever comes next
+func (d *document) entryEnd(key *yaml.Node) int {
+	keyLine := key.Line - 1
+	indent := len(indentation(d.lines[keyLine]))
+	end := len(d.lines)
+	for i := keyLine + 1; i < len(d.lines); i++ {
+		if isBlankOrComment(d.lines[i]) {
+			continue
+		}
+		// The value is indented more than the key, apart from lists, which can be indented
+		// the same
+		lineIndent := len(indentation(d.lines[i]))
+		trimmed := strings.TrimSpace(d.lines[i])
+		if lineIndent < indent || (lineIndent == indent && trimmed != "-" && !strings.HasPrefix(trimmed, "- ")) {
+			end = i
+			break
+		}
+	}
+	for end > keyLine+1 && isBlankOrComment(d.lines[end-1]) {
+		end--
+	}
+	return end
+}
+
+// commentStart returns the index of the first line of the comments directly above the key
+func (d *document) commentStart(key *yaml.Node) int {
+	start := key.Line - 1
+	for start > 0 && strings.HasPrefix(strings.TrimSpace(d.lines[start-1]), "#") {
+		start--
+	}
+	return start
+}
+
+// removeEntry removes a mapping key, its value, and the comments above it. If it's
+// between blank lines, one of them is removed too, so there aren't two in a row.
+func (d *document) removeEntry(key *yaml.Node) {
+	start, end := d.commentStart(key), d.entryEnd(key)
+	if start > 0 && strings.TrimSpace(d.lines[start-1]) == "" && (end == len(d.lines) || strings.TrimSpace(d.lines[end]) == "") {
+		start--
+	}
+	d.replaceLines(start, end, nil)
+}
+
+// renameKey replaces the name of a mapping key, keeping the rest of its line
+func (d *document) renameKey(key *yaml.Node, name string) error {
+	line := d.lines[key.Line-1]
+	start := key.Column - 1
+	length := len(key.Value)
+	if key.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0 {
+		length += 2
+	}
+	if start+length > len(line) || !strings.Contains(line[start:start+length], key.Value) {
+		return fmt.Errorf("Failed to find %s on line %d of %s", key.Value, key.Line, global.ConfigFilename)
+	}
+	d.lines[key.Line-1] = line[:start] + name + line[start+length:]
+	return nil
+}
+
+// replaceLines replaces the lines from start up to end with lines
+func (d *document) replaceLines(start int, end int, lines []string) {
+	if len(lines) > 0 && start > 0 && !strings.HasSuffix(d.lines[start-1], "\n") {
+		// Adding lines after the last line, which doesn't have a line ending
+		d.lines[start-1] += "\n"
+	}
+	d.lines = append(d.lines[:start], append(append([]string{}, lines...), d.lines[end:]...)...)
+}
+
+func (d *document) insertLines(at int, lines []string) {
+	d.replaceLines(at, at, lines)
+}
+
+func isBlankOrComment(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed == "" || strings.HasPrefix(trimmed, "#")
+}
+
+func indentation(line string) string {
+	return line[:len(line)-len(strings.TrimLeft(line, " "))]
+}
+
+func lineEnding(line string) string {
+	if strings.HasSuffix(line, "\r\n") {
+		return "\r\n"
+	}
+	if strings.HasSuffix(line, "\n") {
+		return "\n"
+	}
+	return ""
+}
+
+func mappingKeyIndex(mapping *yaml.Node, key string) int {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if i := mappingKeyIndex(mapping, key); i != -1 {
+		return mapping.Content[i+1]
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigratePreInstall(t *testing.T) {
+	contents := `# Configuration for Cog
+build:
+  gpu: true # needs a GPU
+  run:
+    - echo hello
+  # install things
+  pre_install:
+    - apt-get install foo
+predict: "predict.py:Predictor"
+`
+	migrated, changes, err := Migrate([]byte(contents))
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"Moved the commands in build.pre_install to the end of build.run",
+		"Set version to 1.1",
+	}, changes)
+	require.Equal(t, `# Configuration for Cog
+version: "1.1"
+build:
+  gpu: true # needs a GPU
+  run:
+    - echo hello
+    # install things
+    - apt-get install foo
+predict: "predict.py:Predictor"
+`, string(migrated))
+
+	config, err := FromYAML(migrated)
+	require.NoError(t, err)
+	require.Equal(t, "1.1", config.Version)
+	require.Equal(t, []string{"echo hello", "apt-get install foo"}, config.Build.Run)
+}
+
+func TestMigrateRenamesPreInstall(t *testing.T) {
+	migrated, changes, err := Migrate([]byte(`build:
+  pre_install:
+    - echo hello
+`))
+	require.NoError(t, err)
+	require.Equal(t, []string{"Renamed build.pre_install to build.run", "Set version to 1.1"}, changes)
+	require.Equal(t, `version: "1.1"
+build:
+  run:
+    - echo hello
+`, string(migrated))
+}
+
+func TestMigrateLatestVersion(t *testing.T) {
+	contents := "version: \"1.1\"\nbuild:\n  gpu: true\n"
+	migrated, changes, err := Migrate([]byte(contents))
+	require.NoError(t, err)
+	require.Empty(t, changes)
+	require.Equal(t, contents, string(migrated))
+
+	_, _, err = Migrate([]byte("version: \"0.9\"\n"))
+	require.ErrorContains(t, err, "Cog doesn't know how to migrate version 0.9 of cog.yaml")
+}
+
+func TestMigrateKeepsFormatting(t *testing.T) {
+	// Everything apart from pre_install, like blank lines, quoting and the spacing before
+	// comments, is kept exactly as it was
+	unchanged := `  python_version:   '3.8'   # pinned
+
+  python_packages:
+    - "torch==1.12.1"
+
+    - pillow
+`
+	contents := `version: '1.0'  # old
+# Configuration for Cog
+
+build:
+  gpu: true
+  run:
+    - echo hello
+
+  pre_install:
+    - apt-get install foo
+    - |
+      echo multiple
+      echo lines
+
+` + unchanged + `
+predict: predict.py:Predictor
+`
+	migrated, _, err := Migrate([]byte(contents))
+	require.NoError(t, err)
+	require.Contains(t, string(migrated), unchanged)
+	require.Equal(t, `version: "1.1" # old
+# Configuration for Cog
+
+build:
+  gpu: true
+  run:
+    - echo hello
+    - apt-get install foo
+    - |
+      echo multiple
+      echo lines
+
+`+unchanged+`
+predict: predict.py:Predictor
+`, string(migrated))
+
+	config, err := FromYAML(migrated)
+	require.NoError(t, err)
+	require.Equal(t, []string{"echo hello", "apt-get install foo", "echo multiple\necho lines\n"}, config.Build.Run)
+}
+
+func TestMigratePreInstallBeforeRun(t *testing.T) {
+	migrated, _, err := Migrate([]byte(`build:
+  pre_install:
+  - apt-get install foo
+  run: ["echo hello"] # flow style
+
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.Equal(t, `version: "1.1"
+build:
+  run:
+    - "echo hello"
+    - apt-get install foo
+
+predict: predict.py:Predictor
+`, string(migrated))
+}
+
+func TestMigrateEmptyRun(t *testing.T) {
+	migrated, changes, err := Migrate([]byte(`build:
+  run:
+  pre_install:
+    - echo hello
+`))
+	require.NoError(t, err)
+	require.Equal(t, []string{"Renamed build.pre_install to build.run", "Set version to 1.1"}, changes)
+	require.Equal(t, `version: "1.1"
+build:
+  run:
+    - echo hello
+`, string(migrated))
+
+	migrated, _, err = Migrate([]byte("# empty\n"))
+	require.NoError(t, err)
+	require.Equal(t, "# empty\nversion: \"1.1\"\n", string(migrated))
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/replicate/cog/pkg/util/files"
+)
+
+// ValidateProjectFiles checks that the files cog.yaml refers to exist in projectDir, and
+// that the predictor class is defined in the file 'predict' points to. Python isn't run,
+// so the predictor file is only checked for a top-level definition or import of the class.
+func (c *Config) ValidateProjectFiles(projectDir string) error {
+	errs := &ValidationErrors{}
+
+	if c.Build != nil && c.Build.PythonRequirements != "" {
+		if err := checkProjectFileExists(projectDir, c.Build.PythonRequirements); err != nil {
+			errs.add("build.python_requirements", "%s", err)
+		}
+	}
+
+	if c.Build != nil && c.Build.CondaEnvironment != "" {
+		if err := checkProjectFileExists(projectDir, c.Build.CondaEnvironment); err != nil {
+			errs.add("build.conda_environment", "%s", err)
+		}
+	}
+
+	if c.Predict != "" {
+		parts := strings.SplitN(c.Predict, ":", 2)
+		if len(parts) == 2 {
+			if err := checkPredictorDefined(projectDir, parts[0], parts[1]); err != nil {
+				errs.add("predict", "%s", err)
+			}
+		}
+	}
+
+	return errs.errOrNil()
+}
+
+func checkProjectFileExists(projectDir string, filename string) error {
+	exists, err := files.Exists(filepath.Join(projectDir, filename))
+	if err != nil {
+		return fmt.Errorf("Failed to check if %s exists: %w", filename, err)
+	}
+	if !exists {
+		return fmt.Errorf("%s does not exist in %s", filename, projectDir)
+	}
+	return nil
+}
+
+func checkPredictorDefined(projectDir string, filename string, className string) error {
+	if err := checkProjectFileExists(projectDir, filename); err != nil {
+		return err
+	}
+	f, err := os.Open(filepath.Join(projectDir, filename))
+	if err != nil {
+		return fmt.Errorf("Failed to open %s: %w", filename, err)
+	}
+	defer f.Close()
+
+	defined, err := pythonDefinesName(f, className)
+	if err != nil {
+		return fmt.Errorf("Failed to read %s: %w", filename, err)
+	}
+	if !defined {
+		return fmt.Errorf("%s does not define a class called %s", filename, className)
+	}
+	return nil
+}
+
+// pythonDefinesName returns true if a Python module defines name at the top level, with a
+// class or function definition, an assignment, or an import
+func pythonDefinesName(r io.Reader, name string) (bool, error) {
+	quoted := regexp.QuoteMeta(name)
+	definition := regexp.MustCompile(`^(class|def)\s+` + quoted + `\b`)
+	assignment := regexp.MustCompile(`^` + quoted + `\s*(:[^=]*)?=[^=]`)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// Join imports split over several lines in parentheses
+		for strings.HasPrefix(line, "from ") && strings.Contains(line, "(") && !strings.Contains(line, ")") && scanner.Scan() {
+			line += " " + strings.TrimSpace(scanner.Text())
+		}
+		if definition.MatchString(line) || assignment.MatchString(line) {
+			return true, nil
+		}
+		if (strings.HasPrefix(line, "import ") || strings.HasPrefix(line, "from ")) && importedName(line, name) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// importedName returns true if an import statement binds name, i.e. it is imported
+// directly or with "as name", rather than just being part of a module path
+func importedName(line string, name string) bool {
+	if i := strings.Index(line, "#"); i >= 0 {
+		line = line[:i]
+	}
+	if strings.HasPrefix(line, "from") {
+		i := strings.Index(line, " import ")
+		if i < 0 {
+			return false
+		}
+		line = line[i+len(" import "):]
+	} else {
+		line = strings.TrimPrefix(line, "import")
+	}
+	line = strings.Trim(strings.TrimSpace(line), "()\\")
+	for _, item := range strings.Split(line, ",") {
+		fields := strings.Fields(item)
+		switch {
+		case len(fields) == 1 && fields[0] == name:
+			return true
+		case len(fields) == 3 && fields[1] == "as" && fields[2] == name:
+			return true
+		}
+	}
+	return false
+}
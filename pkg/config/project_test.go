@@ -0,0 +1,65 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateProjectFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cog-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config := &Config{
+		Build:   &Build{PythonRequirements: "requirements.txt"},
+		Predict: "predict.py:Predictor",
+	}
+	err = config.ValidateProjectFiles(dir)
+	require.Error(t, err)
+	errs := err.(*ValidationErrors)
+	require.Len(t, errs.Errors, 2)
+	require.Equal(t, "build.python_requirements", errs.Errors[0].Field)
+	require.Equal(t, "predict", errs.Errors[1].Field)
+	require.Contains(t, errs.Errors[1].Message, "predict.py does not exist")
+
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, "requirements.txt"), []byte("torch==1.12.1\n"), 0o644))
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, "predict.py"), []byte("class Other:\n    pass\n"), 0o644))
+	err = config.ValidateProjectFiles(dir)
+	require.Error(t, err)
+	errs = err.(*ValidationErrors)
+	require.Len(t, errs.Errors, 1)
+	require.Equal(t, "predict.py does not define a class called Predictor", errs.Errors[0].Message)
+
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, "predict.py"), []byte("from cog import BasePredictor\n\nclass Predictor(BasePredictor):\n    pass\n"), 0o644))
+	require.NoError(t, config.ValidateProjectFiles(dir))
+}
+
+func TestPythonDefinesName(t *testing.T) {
+	for _, tt := range []struct {
+		source  string
+		defined bool
+	}{
+		{"class Predictor(BasePredictor):\n", true},
+		{"class Predictor:\n", true},
+		{"Predictor = OtherPredictor\n", true},
+		{"from models import Predictor\n", true},
+		{"from models import Foo, Predictor  # noqa\n", true},
+		{"from models import (\n    Foo,\n    Predictor,\n)\n", true},
+		{"from models import OtherPredictor as Predictor\n", true},
+		{"import Predictor\n", true},
+		{"class PredictorBase:\n", false},
+		{"class Foo:\n    class Predictor:\n", false},
+		{"from Predictor import Foo\n", false},
+		{"# class Predictor:\n", false},
+		{"Predictor == 1\n", false},
+	} {
+		defined, err := pythonDefinesName(strings.NewReader(tt.source), "Predictor")
+		require.NoError(t, err)
+		require.Equal(t, tt.defined, defined, tt.source)
+	}
+}
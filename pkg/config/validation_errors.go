@@ -0,0 +1,196 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/replicate/cog/pkg/errors"
+	"github.com/replicate/cog/pkg/global"
+)
+
+const docsMessage = `To see what options you can use, take a look at the docs:
+https://github.com/replicate/cog/blob/main/docs/yaml.md`
+
+const upgradeMessage = `You might also need to upgrade Cog, if this option was added in a
+later version of Cog.`
+
+// ValidationError is a problem with an option in cog.yaml
+type ValidationError struct {
+	// Field is the path to the option, e.g. build.python_packages.0
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+	// Line and Column are the position of the option in cog.yaml, starting at 1, or 0 if
+	// they aren't known
+	Line   int `json:"line,omitempty"`
+	Column int `json:"column,omitempty"`
+
+	// fromSchema is true if the error came from the JSON schema, which might mean the
+	// option is from a newer version of Cog
+	fromSchema bool
+	// atKey is true if the error is about the key of the option rather than its value
+	atKey bool
+	// sourceLine is the line of cog.yaml the error is on
+	sourceLine string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// ValidationErrors is every problem found in cog.yaml. Error renders them like a
+// compiler's diagnostics, with the position of each problem if SetSource has been called.
+type ValidationErrors struct {
+	Filename string
+	Errors   []*ValidationError
+}
+
+func (e *ValidationErrors) Error() string {
+	filename := e.Filename
+	if filename == "" {
+		filename = global.ConfigFilename
+	}
+
+	var b strings.Builder
+	if len(e.Errors) == 1 {
+		fmt.Fprintf(&b, "There is a problem in your %s file:\n\n", filename)
+	} else {
+		fmt.Fprintf(&b, "There are %d problems in your %s file:\n\n", len(e.Errors), filename)
+	}
+
+	fromSchema := false
+	for _, err := range e.Errors {
+		fromSchema = fromSchema || err.fromSchema
+		if err.Line == 0 {
+			fmt.Fprintf(&b, "%s: %s\n", filename, err.Message)
+			continue
+		}
+		fmt.Fprintf(&b, "%s:%d:%d: %s\n", filename, err.Line, err.Column, err.Message)
+		if err.sourceLine != "" {
+			gutter := strconv.Itoa(err.Line)
+			fmt.Fprintf(&b, "  %s | %s\n", gutter, err.sourceLine)
+			fmt.Fprintf(&b, "  %s | %s^\n", strings.Repeat(" ", len(gutter)), caretIndent(err.sourceLine, err.Column))
+		}
+	}
+
+	b.WriteString("\n" + docsMessage)
+	if fromSchema {
+		b.WriteString("\n\n" + upgradeMessage)
+	}
+	return b.String()
+}
+
+// Code makes validation errors a coded error for machine-readable output
+func (e *ValidationErrors) Code() string {
+	return errors.CodeConfigInvalid
+}
+
+// SetSource sets the file the config was loaded from, and finds the line and column
+// of each error in its contents
+func (e *ValidationErrors) SetSource(filename string, contents []byte) {
+	e.Filename = filename
+
+	root := &yaml.Node{}
+	if err := yaml.Unmarshal(contents, root); err != nil || len(root.Content) == 0 {
+		return
+	}
+	lines := strings.Split(string(contents), "\n")
+	for _, err := range e.Errors {
+		node := findYAMLNode(root.Content[0], err.Field, err.atKey)
+		if node == nil {
+			continue
+		}
+		err.Line = node.Line
+		err.Column = node.Column
+		if node.Line <= len(lines) {
+			err.sourceLine = strings.TrimRight(lines[node.Line-1], "\r")
+		}
+	}
+}
+
+func (e *ValidationErrors) add(field string, format string, v ...interface{}) {
+	e.Errors = append(e.Errors, &ValidationError{Field: field, Message: fmt.Sprintf(format, v...)})
+}
+
+// addError adds err to the list. field is used as the error's field if it doesn't have
+// one of its own.
+func (e *ValidationErrors) addError(field string, err error) {
+	switch err := err.(type) {
+	case *ValidationErrors:
+		e.Errors = append(e.Errors, err.Errors...)
+	case *ValidationError:
+		if err.Field == "" {
+			err.Field = field
+		}
+		e.Errors = append(e.Errors, err)
+	default:
+		e.add(field, "%s", err)
+	}
+}
+
+func (e *ValidationErrors) errOrNil() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+func fieldErrorf(field string, format string, v ...interface{}) *ValidationError {
+	return &ValidationError{Field: field, Message: fmt.Sprintf(format, v...)}
+}
+
+// findYAMLNode returns the node for a field path like build.python_packages.0, or the
+// closest parent that exists if it isn't in the document
+func findYAMLNode(node *yaml.Node, field string, atKey bool) *yaml.Node {
+	if field == "" {
+		return node
+	}
+	parts := strings.Split(field, ".")
+	for n, part := range parts {
+		switch node.Kind {
+		case yaml.MappingNode:
+			var next *yaml.Node
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == part {
+					next = node.Content[i+1]
+					if atKey && n == len(parts)-1 {
+						next = node.Content[i]
+					}
+					break
+				}
+			}
+			if next == nil {
+				return node
+			}
+			node = next
+		case yaml.SequenceNode:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(node.Content) {
+				return node
+			}
+			node = node.Content[i]
+		default:
+			return node
+		}
+	}
+	return node
+}
+
+// caretIndent returns the whitespace to put before a caret pointing at column in line,
+// keeping tabs so it lines up
+func caretIndent(line string, column int) string {
+	indent := []rune{}
+	for i, r := range []rune(line) {
+		if i >= column-1 {
+			break
+		}
+		if r == '\t' {
+			indent = append(indent, '\t')
+		} else {
+			indent = append(indent, ' ')
+		}
+	}
+	return string(indent)
+}
@@ -11,30 +11,33 @@ import (
 )
 
 const (
-	defaultVersion  = "1.0"
+	// defaultVersion is the version of configs without a 'version' key
+	defaultVersion = "1.0"
+	// LatestVersion is the version 'cog migrate-config' updates configs to
+	LatestVersion   = "1.1"
 	jsonschemaOneOf = "number_one_of"
 	jsonschemaAnyOf = "number_any_of"
-	errorString     = `There is a problem in your cog.yaml file. 
-%s.
-
-To see what options you can use, take a look at the docs:
-https://github.com/replicate/cog/blob/main/docs/yaml.md
-
-You might also need to upgrade Cog, if this option was added in a
-later version of Cog.`
 )
 
 //go:embed data/config_schema_v1.0.json
 var schemaV1 []byte
 
-func getSchema(version string) (gojsonschema.JSONLoader, error) {
-
-	// Default schema
-	currentSchema := schemaV1
+//go:embed data/config_schema_v1.1.json
+var schemaV1_1 []byte
 
+// getSchema returns the schema for a version of cog.yaml. An empty version is the
+// default version, for configs without a 'version' key.
+func getSchema(version string) (gojsonschema.JSONLoader, error) {
+	var currentSchema []byte
 	switch version {
-	case defaultVersion:
+	case "", defaultVersion:
 		currentSchema = schemaV1
+	case "1.1":
+		currentSchema = schemaV1_1
+	default:
+		errs := &ValidationErrors{}
+		errs.add("version", "version %s isn't supported. The latest version this version of Cog supports is %s. You might need to upgrade Cog", version, LatestVersion)
+		return nil, errs
 	}
 
 	return gojsonschema.NewStringLoader(string(currentSchema)), nil
@@ -82,22 +85,42 @@ https://github.com/docker/docker-ce/blob/f76280404059080d79fcda620caf8cef5a4a22f
 Which is available under Apache v2 license: https://github.com/docker/docker-ce/blob/master/LICENSE
 */
 
+// toError converts all the errors in result to ValidationErrors. The errors for the
+// alternatives in a oneOf or anyOf are combined into one, because only the closest
+// matching alternative is reported.
 func toError(result *gojsonschema.Result) error {
-	err := getMostSpecificError(result.Errors())
-	return err
+	errs := &ValidationErrors{}
+	resultErrors := result.Errors()
+	for i := 0; i < len(resultErrors); i++ {
+		err := schemaError{parent: resultErrors[i]}
+		if t := err.parent.Type(); t == jsonschemaOneOf || t == jsonschemaAnyOf {
+			for i+1 < len(resultErrors) && isFieldOrChild(resultErrors[i+1].Field(), err.parent.Field()) {
+				if err.child == nil {
+					err.child = resultErrors[i+1]
+				}
+				i++
+			}
+		}
+		errs.Errors = append(errs.Errors, err.toValidationError())
+	}
+	return errs
+}
+
+func isFieldOrChild(field string, parent string) bool {
+	return field == parent || strings.HasPrefix(field, parent+".")
 }
 
-func getDescription(err validationError) string {
+func getDescription(err schemaError) string {
 	switch err.parent.Type() {
 	case "invalid_type":
 		if expectedType, ok := err.parent.Details()["expected"].(string); ok {
-			return fmt.Sprintf("must be a %s", humanReadableType(expectedType))
+			return fmt.Sprintf("%s must be a %s", err.parent.Field(), humanReadableType(expectedType))
 		}
 	case jsonschemaOneOf, jsonschemaAnyOf:
 		if err.child == nil {
 			return err.parent.Description()
 		}
-		return err.child.Description()
+		return getDescription(schemaError{parent: err.child})
 	}
 	return err.parent.Description()
 }
@@ -123,47 +146,27 @@ func humanReadableType(definition string) string {
 	return definition
 }
 
-type validationError struct {
+type schemaError struct {
 	parent gojsonschema.ResultError
 	child  gojsonschema.ResultError
 }
 
-func (err validationError) Error() string {
-	errorDesc := getDescription(err)
-	return fmt.Sprintf(errorString, errorDesc)
-}
-
-func getMostSpecificError(errors []gojsonschema.ResultError) validationError {
-	mostSpecificError := 0
-	for i, err := range errors {
-		if specificity(err) > specificity(errors[mostSpecificError]) {
-			mostSpecificError = i
-			continue
-		}
-
-		if specificity(err) == specificity(errors[mostSpecificError]) {
-			// Invalid type errors win in a tie-breaker for most specific field name
-			if err.Type() == "invalid_type" && errors[mostSpecificError].Type() != "invalid_type" {
-				mostSpecificError = i
-			}
-		}
+func (err schemaError) toValidationError() *ValidationError {
+	validationError := &ValidationError{
+		Field:      err.parent.Field(),
+		Message:    getDescription(err),
+		fromSchema: true,
 	}
-
-	if mostSpecificError+1 == len(errors) {
-		return validationError{parent: errors[mostSpecificError]}
+	if validationError.Field == "(root)" {
+		validationError.Field = ""
 	}
-
-	switch errors[mostSpecificError].Type() {
-	case "number_one_of", "number_any_of":
-		return validationError{
-			parent: errors[mostSpecificError],
-			child:  errors[mostSpecificError+1],
+	// Point at the property that isn't allowed, rather than the object it's in
+	if property, ok := err.parent.Details()["property"].(string); ok && err.parent.Type() == "additional_property_not_allowed" {
+		if validationError.Field != "" {
+			validationError.Field += "."
 		}
-	default:
-		return validationError{parent: errors[mostSpecificError]}
+		validationError.Field += property
+		validationError.atKey = true
 	}
-}
-
-func specificity(err gojsonschema.ResultError) int {
-	return len(strings.Split(err.Field(), "."))
+	return validationError
 }
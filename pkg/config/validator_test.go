@@ -79,3 +79,78 @@ func TestValidatePythonVersionIsRequired(t *testing.T) {
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "Additional property python_versions is not allowed")
 }
+
+func TestValidateReturnsAllErrors(t *testing.T) {
+	contents := `build:
+  gpu: "yes"
+  python_version: "3.8"
+  python_packages:
+    - "torch==1.8.1"
+    - 1
+  foo: bar
+`
+
+	err := Validate(contents, "1.0")
+	require.Error(t, err)
+	errs, ok := err.(*ValidationErrors)
+	require.True(t, ok)
+	errs.SetSource("cog.yaml", []byte(contents))
+	require.Len(t, errs.Errors, 3)
+
+	fields := map[string]*ValidationError{}
+	for _, e := range errs.Errors {
+		fields[e.Field] = e
+	}
+	require.Equal(t, 2, fields["build.gpu"].Line)
+	require.Equal(t, 8, fields["build.gpu"].Column)
+	require.Equal(t, "build.gpu must be a boolean", fields["build.gpu"].Message)
+	require.Equal(t, 6, fields["build.python_packages.1"].Line)
+	require.Equal(t, 7, fields["build.python_packages.1"].Column)
+	require.Equal(t, 7, fields["build.foo"].Line)
+	require.Equal(t, 3, fields["build.foo"].Column)
+
+	require.Contains(t, err.Error(), "There are 3 problems in your cog.yaml file")
+	require.Contains(t, err.Error(), `cog.yaml:7:3: Additional property foo is not allowed
+  7 |   foo: bar
+    |   ^`)
+}
+
+func TestFromYAMLReturnsSchemaAndOptionErrors(t *testing.T) {
+	contents := `build:
+  python_version: "3.8"
+  python_packages:
+    - "torch"
+  python_requirements: "requirements.txt"
+  foo: bar
+predict: "predict.py"
+`
+
+	_, err := FromYAML([]byte(contents))
+	require.Error(t, err)
+	errs, ok := err.(*ValidationErrors)
+	require.True(t, ok)
+	errs.SetSource("cog.yaml", []byte(contents))
+	require.Len(t, errs.Errors, 4)
+	require.Contains(t, err.Error(), "cog.yaml:6:3: Additional property foo is not allowed")
+	require.Contains(t, err.Error(), "cog.yaml:7:10: 'predict' in cog.yaml must be in the form 'predict.py:Predictor'")
+	require.Contains(t, err.Error(), "cog.yaml:4:7: Python packages must have pinned versions")
+	require.Contains(t, err.Error(), "cog.yaml:5:24: Only one of python_packages or python_requirements can be set")
+}
+
+func TestValidateVersions(t *testing.T) {
+	config := `build:
+  pre_install:
+    - "echo hello"`
+	require.NoError(t, Validate(config, ""))
+
+	err := Validate("version: \"1.1\"\n"+config, "1.1")
+	require.ErrorContains(t, err, "Additional property pre_install is not allowed")
+
+	err = Validate("version: \"2.0\"\n", "2.0")
+	require.ErrorContains(t, err, "version 2.0 isn't supported")
+
+	// Versions can be written as numbers, like python_version
+	parsed, err := FromYAML([]byte("version: 1.1\nbuild:\n  gpu: true\n"))
+	require.NoError(t, err)
+	require.Equal(t, "1.1", parsed.Version)
+}
@@ -0,0 +1,489 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/docker/cli/cli/config"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-connections/nat"
+
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// APIError is an error response from the Docker Engine API
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// IsNotFound returns true if err is an API error for a missing object
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// APIClient implements Client using the Docker Engine API over a unix socket.
+//
+// Builds and interactive runs are delegated to the docker CLI: BuildKit features like
+// cache mounts need a build session, and attaching a TTY needs a hijacked connection,
+// neither of which are worth reimplementing here.
+type APIClient struct {
+	socketPath string
+	httpClient *http.Client
+	fallback   *CLIClient
+}
+
+func NewAPIClient(socketPath string) *APIClient {
+	dialer := &net.Dialer{}
+	return &APIClient{
+		socketPath: socketPath,
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+		fallback: NewCLIClient(RuntimeDocker),
+	}
+}
+
+func (c *APIClient) Build(ctx context.Context, options BuildOptions) error {
+	return c.fallback.Build(ctx, options)
+}
+
+func (c *APIClient) BuildAddLabelsToImage(ctx context.Context, image string, labels map[string]string) error {
+	return c.fallback.BuildAddLabelsToImage(ctx, image, labels)
+}
+
+func (c *APIClient) ContainerInspect(ctx context.Context, id string) (*types.ContainerJSON, error) {
+	cont := new(types.ContainerJSON)
+	if err := c.getJSON(ctx, "/containers/"+id+"/json", nil, cont); err != nil {
+		return nil, err
+	}
+	return cont, nil
+}
+
+func (c *APIClient) ContainerList(ctx context.Context, label string) ([]types.Container, error) {
+	filters, err := json.Marshal(map[string][]string{"label": {label}})
+	if err != nil {
+		return nil, err
+	}
+	containers := []types.Container{}
+	if err := c.getJSON(ctx, "/containers/json", url.Values{"filters": {string(filters)}}, &containers); err != nil {
+		return nil, err
+	}
+	return containers, nil
+}
+
+func (c *APIClient) ContainerLogsFollow(ctx context.Context, containerID string, out io.Writer) error {
+	return c.containerLogs(ctx, containerID, out, out)
+}
+
+func (c *APIClient) containerLogs(ctx context.Context, containerID string, stdout, stderr io.Writer) error {
+	query := url.Values{"follow": {"1"}, "stdout": {"1"}, "stderr": {"1"}}
+	resp, err := c.do(ctx, http.MethodGet, "/containers/"+containerID+"/logs", query, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// Containers are created without a TTY, so stdout and stderr are multiplexed
+	_, err = stdcopy.StdCopy(stdout, stderr, resp.Body)
+	return err
+}
+
+func (c *APIClient) ImageInspect(ctx context.Context, id string) (*types.ImageInspect, error) {
+	image := new(types.ImageInspect)
+	if err := c.getJSON(ctx, "/images/"+id+"/json", nil, image); err != nil {
+		if IsNotFound(err) {
+			return nil, ErrNoSuchImage
+		}
+		return nil, err
+	}
+	return image, nil
+}
+
+func (c *APIClient) ImageList(ctx context.Context, label string) ([]types.ImageSummary, error) {
+	filters, err := json.Marshal(map[string][]string{"label": {label}})
+	if err != nil {
+		return nil, err
+	}
+	images := []types.ImageSummary{}
+	if err := c.getJSON(ctx, "/images/json", url.Values{"filters": {string(filters)}}, &images); err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+func (c *APIClient) ImageRemove(ctx context.Context, image string) error {
+	resp, err := c.do(ctx, http.MethodDelete, "/images/"+image, nil, nil, nil)
+	if err != nil {
+		if IsNotFound(err) {
+			return ErrNoSuchImage
+		}
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *APIClient) Kill(ctx context.Context, id string) error {
+	resp, err := c.do(ctx, http.MethodPost, "/containers/"+id+"/kill", nil, nil, nil)
+	if err != nil {
+		if IsNotFound(err) {
+			return ErrNoSuchContainer
+		}
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *APIClient) Pull(ctx context.Context, image string) error {
+	repository, tag := splitImageTag(image)
+	if tag == "" {
+		tag = "latest"
+	}
+	header, err := registryAuthHeader(image)
+	if err != nil {
+		return err
+	}
+	query := url.Values{"fromImage": {repository}, "tag": {tag}}
+	resp, err := c.do(ctx, http.MethodPost, "/images/create", query, nil, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	out, done := console.LogWriter(console.InfoLevel)
+	defer done()
+	return displayProgress(resp.Body, out)
+}
+
+func (c *APIClient) Push(ctx context.Context, image string) error {
+	repository, tag := splitImageTag(image)
+	header, err := registryAuthHeader(image)
+	if err != nil {
+		return err
+	}
+	query := url.Values{}
+	if tag != "" {
+		query.Set("tag", tag)
+	}
+	resp, err := c.do(ctx, http.MethodPost, "/images/"+repository+"/push", query, nil, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	out, done := console.LogWriter(console.InfoLevel)
+	defer done()
+	return displayProgress(resp.Body, out)
+}
+
+func (c *APIClient) RunDaemon(ctx context.Context, options RunOptions) (string, error) {
+	containerID, err := c.createContainer(ctx, options, true)
+	if err != nil {
+		return "", err
+	}
+	if err := c.startContainer(ctx, containerID); err != nil {
+		return "", err
+	}
+	return containerID, nil
+}
+
+func (c *APIClient) RunWithIO(ctx context.Context, options RunOptions, stdin io.Reader, stdout, stderr io.Writer) error {
+	if stdin != nil {
+		return c.fallback.RunWithIO(ctx, options, stdin, stdout, stderr)
+	}
+
+	// Not auto-removed, so the logs and exit code are still around if the container exits quickly
+	containerID, err := c.createContainer(ctx, options, false)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := c.removeContainer(context.Background(), containerID); err != nil {
+			console.Debugf("Failed to remove container %s: %s", containerID, err)
+		}
+	}()
+	if err := c.startContainer(ctx, containerID); err != nil {
+		return err
+	}
+	if err := c.containerLogs(ctx, containerID, stdout, stderr); err != nil {
+		return err
+	}
+
+	result := struct {
+		StatusCode int `json:"StatusCode"`
+	}{}
+	resp, err := c.do(ctx, http.MethodPost, "/containers/"+containerID+"/wait", nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("Failed to decode container wait response: %w", err)
+	}
+	if result.StatusCode != 0 {
+		return fmt.Errorf("Container exited with status %d", result.StatusCode)
+	}
+	return nil
+}
+
+func (c *APIClient) Stop(ctx context.Context, id string) error {
+	resp, err := c.do(ctx, http.MethodPost, "/containers/"+id+"/stop", url.Values{"t": {"3"}}, nil, nil)
+	if err != nil {
+		if IsNotFound(err) {
+			return ErrNoSuchContainer
+		}
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *APIClient) createContainer(ctx context.Context, options RunOptions, autoRemove bool) (string, error) {
+	containerConfig, hostConfig, err := containerConfigs(withContainerLabels(options))
+	if err != nil {
+		return "", err
+	}
+	hostConfig.AutoRemove = autoRemove
+	body := struct {
+		*container.Config
+		HostConfig *container.HostConfig
+	}{containerConfig, hostConfig}
+
+	created := struct {
+		ID string `json:"Id"`
+	}{}
+	var query url.Values
+	if options.Name != "" {
+		query = url.Values{"name": {options.Name}}
+	}
+	resp, err := c.do(ctx, http.MethodPost, "/containers/create", query, body, nil)
+	if err != nil {
+		if !IsNotFound(err) {
+			return "", err
+		}
+		// Like `docker run`, pull the image if it doesn't exist locally
+		console.Infof("Unable to find image '%s' locally", options.Image)
+		if err := c.Pull(ctx, options.Image); err != nil {
+			return "", err
+		}
+		resp, err = c.do(ctx, http.MethodPost, "/containers/create", query, body, nil)
+		if err != nil {
+			return "", err
+		}
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return "", fmt.Errorf("Failed to decode container create response: %w", err)
+	}
+	console.Debugf("Created container %s from %s", created.ID, options.Image)
+	return created.ID, nil
+}
+
+func (c *APIClient) startContainer(ctx context.Context, containerID string) error {
+	resp, err := c.do(ctx, http.MethodPost, "/containers/"+containerID+"/start", nil, nil, nil)
+	if err != nil {
+		// Start failed, so the container won't be auto-removed
+		if rmErr := c.removeContainer(context.Background(), containerID); rmErr != nil {
+			console.Debugf("Failed to remove container %s: %s", containerID, rmErr)
+		}
+		if strings.Contains(err.Error(), "could not select device driver") {
+			return ErrMissingDeviceDriver
+		}
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *APIClient) removeContainer(ctx context.Context, containerID string) error {
+	resp, err := c.do(ctx, http.MethodDelete, "/containers/"+containerID, url.Values{"force": {"1"}}, nil, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *APIClient) getJSON(ctx context.Context, path string, query url.Values, v interface{}) error {
+	resp, err := c.do(ctx, http.MethodGet, path, query, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("Failed to decode response from %s: %w", path, err)
+	}
+	return nil
+}
+
+// do makes a request to the Engine API, returning an *APIError if the response is an error
+func (c *APIClient) do(ctx context.Context, method string, path string, query url.Values, body interface{}, header http.Header) (*http.Response, error) {
+	var bodyReader io.Reader
+	if body != nil {
+		bodyJSON, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		bodyReader = bytes.NewReader(bodyJSON)
+	}
+	u := "http://docker" + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, bodyReader)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	console.Debugf("Docker API: %s %s", method, path)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to connect to Docker at %s: %w", c.socketPath, err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		return nil, decodeAPIError(resp)
+	}
+	return resp, nil
+}
+
+func decodeAPIError(resp *http.Response) error {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return &APIError{StatusCode: resp.StatusCode, Message: resp.Status}
+	}
+	errorResponse := struct {
+		Message string `json:"message"`
+	}{}
+	if err := json.Unmarshal(body, &errorResponse); err != nil || errorResponse.Message == "" {
+		errorResponse.Message = strings.TrimSpace(string(body))
+	}
+	return &APIError{StatusCode: resp.StatusCode, Message: errorResponse.Message}
+}
+
+// containerConfigs is the API equivalent of generateDockerArgs
+func containerConfigs(options RunOptions) (*container.Config, *container.HostConfig, error) {
+	containerConfig := &container.Config{
+		Image:        options.Image,
+		Cmd:          options.Args,
+		Env:          options.Env,
+		WorkingDir:   options.Workdir,
+		Labels:       options.Labels,
+		ExposedPorts: nat.PortSet{},
+	}
+	hostConfig := &container.HostConfig{
+		ShmSize:      8 * 1024 * 1024 * 1024, // https://github.com/pytorch/pytorch/issues/2244
+		PortBindings: nat.PortMap{},
+	}
+	for _, port := range options.Ports {
+		containerPort := nat.Port(fmt.Sprintf("%d/tcp", port.ContainerPort))
+		containerConfig.ExposedPorts[containerPort] = struct{}{}
+		hostConfig.PortBindings[containerPort] = append(hostConfig.PortBindings[containerPort], nat.PortBinding{HostPort: strconv.Itoa(port.HostPort)})
+	}
+	for _, volume := range options.Volumes {
+		hostConfig.Mounts = append(hostConfig.Mounts, mount.Mount{
+			Type:   mount.TypeBind,
+			Source: volume.Source,
+			Target: volume.Destination,
+		})
+	}
+	deviceRequests, err := gpuDeviceRequests(options.GPUs)
+	if err != nil {
+		return nil, nil, err
+	}
+	hostConfig.DeviceRequests = deviceRequests
+	return containerConfig, hostConfig, nil
+}
+
+// gpuDeviceRequests parses the value of `docker run --gpus`
+func gpuDeviceRequests(gpus string) ([]container.DeviceRequest, error) {
+	if gpus == "" {
+		return nil, nil
+	}
+	request := container.DeviceRequest{Capabilities: [][]string{{"gpu"}}}
+	switch {
+	case gpus == "all":
+		request.Count = -1
+	case strings.HasPrefix(gpus, "device="):
+		request.DeviceIDs = strings.Split(strings.TrimPrefix(gpus, "device="), ",")
+	default:
+		count, err := strconv.Atoi(gpus)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid GPUs value %q, must be 'all', a number, or 'device=<ids>'", gpus)
+		}
+		request.Count = count
+	}
+	return []container.DeviceRequest{request}, nil
+}
+
+func registryAuthHeader(image string) (http.Header, error) {
+	conf := config.LoadDefaultConfigFile(os.Stderr)
+	auth, err := conf.GetAuthConfig(registryHost(image))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get credentials for %s: %w", registryHost(image), err)
+	}
+	authJSON, err := json.Marshal(auth)
+	if err != nil {
+		return nil, err
+	}
+	return http.Header{"X-Registry-Auth": {base64.URLEncoding.EncodeToString(authJSON)}}, nil
+}
+
+type progressMessage struct {
+	ID          string `json:"id"`
+	Status      string `json:"status"`
+	Progress    string `json:"progress"`
+	ErrorDetail *struct {
+		Message string `json:"message"`
+	} `json:"errorDetail"`
+}
+
+// displayProgress prints the JSON progress stream returned by pull and push, returning
+// any error that is reported in the stream
+func displayProgress(r io.Reader, out io.Writer) error {
+	decoder := json.NewDecoder(r)
+	for {
+		msg := progressMessage{}
+		if err := decoder.Decode(&msg); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("Failed to decode progress: %w", err)
+		}
+		if msg.ErrorDetail != nil {
+			return errors.New(msg.ErrorDetail.Message)
+		}
+		// Skip the download/upload progress bars, only print status changes
+		if msg.Progress != "" {
+			continue
+		}
+		if msg.ID != "" {
+			fmt.Fprintf(out, "%s: %s\n", msg.ID, msg.Status)
+		} else {
+			fmt.Fprintln(out, msg.Status)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAPIClient(t *testing.T, handler http.Handler) *APIClient {
+	socketPath := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	server := httptest.NewUnstartedServer(handler)
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+	return NewAPIClient(socketPath)
+}
+
+func TestAPIClientImageInspect(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/images/r8.im/user/model:latest/json", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"Id": "sha256:abc", "Config": {"Labels": {"run.cog.version": "0.1.0"}}}`))
+	})
+	mux.HandleFunc("/images/missing/json", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"message": "No such image: missing"}`))
+	})
+	client := newTestAPIClient(t, mux)
+
+	image, err := client.ImageInspect(context.Background(), "r8.im/user/model:latest")
+	require.NoError(t, err)
+	require.Equal(t, "sha256:abc", image.ID)
+	require.Equal(t, "0.1.0", image.Config.Labels["run.cog.version"])
+
+	_, err = client.ImageInspect(context.Background(), "missing")
+	require.Equal(t, ErrNoSuchImage, err)
+}
+
+func TestAPIClientRunDaemon(t *testing.T) {
+	var created struct {
+		*container.Config
+		HostConfig *container.HostConfig
+	}
+	started := false
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/create", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&created))
+		_, _ = w.Write([]byte(`{"Id": "abc123"}`))
+	})
+	mux.HandleFunc("/containers/abc123/start", func(w http.ResponseWriter, r *http.Request) {
+		started = true
+		w.WriteHeader(http.StatusNoContent)
+	})
+	client := newTestAPIClient(t, mux)
+
+	id, err := client.RunDaemon(context.Background(), RunOptions{
+		Image:   "cog-test",
+		GPUs:    "all",
+		Ports:   []Port{{HostPort: 5001, ContainerPort: 5000}},
+		Volumes: []Volume{{Source: "/home/user/project", Destination: "/src"}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "abc123", id)
+	require.True(t, started)
+
+	require.Equal(t, "cog-test", created.Image)
+	require.True(t, created.HostConfig.AutoRemove)
+	require.Equal(t, int64(8*1024*1024*1024), created.HostConfig.ShmSize)
+	require.Equal(t, "5001", created.HostConfig.PortBindings["5000/tcp"][0].HostPort)
+	require.Equal(t, "/src", created.HostConfig.Mounts[0].Target)
+	require.Equal(t, -1, created.HostConfig.DeviceRequests[0].Count)
+}
+
+func TestAPIClientMissingDeviceDriver(t *testing.T) {
+	removed := false
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/create", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"Id": "abc123"}`))
+	})
+	mux.HandleFunc("/containers/abc123/start", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"message": "could not select device driver \"\" with capabilities: [[gpu]]"}`))
+	})
+	mux.HandleFunc("/containers/abc123", func(w http.ResponseWriter, r *http.Request) {
+		removed = r.Method == http.MethodDelete
+		w.WriteHeader(http.StatusNoContent)
+	})
+	client := newTestAPIClient(t, mux)
+
+	_, err := client.RunDaemon(context.Background(), RunOptions{Image: "cog-test", GPUs: "all"})
+	require.Equal(t, ErrMissingDeviceDriver, err)
+	require.True(t, removed)
+}
+
+func TestSplitImageTag(t *testing.T) {
+	for _, tt := range []struct {
+		image      string
+		repository string
+		tag        string
+	}{
+		{"cog-test", "cog-test", ""},
+		{"cog-test:latest", "cog-test", "latest"},
+		{"localhost:5000/cog-test", "localhost:5000/cog-test", ""},
+		{"localhost:5000/cog-test:v1", "localhost:5000/cog-test", "v1"},
+		{"r8.im/user/model@sha256:abc", "r8.im/user/model", "sha256:abc"},
+	} {
+		repository, tag := splitImageTag(tt.image)
+		require.Equal(t, tt.repository, repository, tt.image)
+		require.Equal(t, tt.tag, tag, tt.image)
+	}
+}
+
+func TestRegistryHost(t *testing.T) {
+	require.Equal(t, "r8.im", registryHost("r8.im/user/model"))
+	require.Equal(t, "localhost:5000", registryHost("localhost:5000/model"))
+	require.Equal(t, dockerHubAuthKey, registryHost("user/model"))
+	require.Equal(t, dockerHubAuthKey, registryHost("python:3.8"))
+}
+
+func TestAPIClientImageListAndRemove(t *testing.T) {
+	removed := []string{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/images/json", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, `{"label":["run.cog.version"]}`, r.URL.Query().Get("filters"))
+		_, _ = w.Write([]byte(`[{"Id": "sha256:abc", "RepoTags": ["cog-model:latest"], "Size": 1000, "Labels": {"run.cog.version": "0.1.0"}}]`))
+	})
+	mux.HandleFunc("/images/", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodDelete, r.Method)
+		if r.URL.Path == "/images/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message": "No such image: missing"}`))
+			return
+		}
+		removed = append(removed, r.URL.Path)
+		_, _ = w.Write([]byte(`[]`))
+	})
+	client := newTestAPIClient(t, mux)
+
+	images, err := client.ImageList(context.Background(), "run.cog.version")
+	require.NoError(t, err)
+	require.Len(t, images, 1)
+	require.Equal(t, []string{"cog-model:latest"}, images[0].RepoTags)
+	require.Equal(t, int64(1000), images[0].Size)
+
+	require.NoError(t, client.ImageRemove(context.Background(), "cog-model:latest"))
+	require.Equal(t, []string{"/images/cog-model:latest"}, removed)
+	require.Equal(t, ErrNoSuchImage, client.ImageRemove(context.Background(), "missing"))
+}
+
+func TestAPIClientStopMissingContainer(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/gone/stop", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"message": "No such container: gone"}`))
+	})
+	mux.HandleFunc("/containers/gone/kill", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"message": "No such container: gone"}`))
+	})
+	client := newTestAPIClient(t, mux)
+
+	require.Equal(t, ErrNoSuchContainer, client.Stop(context.Background(), "gone"))
+	require.Equal(t, ErrNoSuchContainer, client.Kill(context.Background(), "gone"))
+}
@@ -1,50 +1,184 @@
 package docker
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"runtime"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/replicate/cog/pkg/util"
 	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/shell"
 )
 
-func Build(dir, dockerfile, imageName string, progressOutput string) error {
-	var args []string
-	if util.IsM1Mac(runtime.GOOS, runtime.GOARCH) {
-		args = m1BuildxBuildArgs()
-	} else {
-		args = buildKitBuildArgs()
+// buildInterruptTimeout is how long an interrupted build has to exit before it is killed
+const buildInterruptTimeout = 10 * time.Second
+
+type BuildOptions struct {
+	Dir            string
+	Dockerfile     string
+	ImageName      string
+	ProgressOutput string
+	// Secrets are passed to the build with --secret, in the form id=mysecret,src=/path/to/file
+	// or id=mysecret,env=MY_SECRET
+	Secrets []string
+	// SSH are SSH agent sockets or keys passed to the build with --ssh, in the form default,
+	// default=/path/to/key or myid=/path/to/agent.sock
+	SSH []string
+	// CacheFrom and CacheTo are where to import and export the build cache, in the form
+	// buildx takes, like type=registry,ref=r8.im/user/model:buildcache or type=local,src=/path
+	CacheFrom []string
+	CacheTo   []string
+	// Labels are added to the image
+	Labels map[string]string
+}
+
+func (c *CLIClient) Build(ctx context.Context, options BuildOptions) error {
+	args, err := c.generateBuildArgs(options)
+	if err != nil {
+		return err
 	}
-	args = append(args,
-		"--file", "-",
-		"--build-arg", "BUILDKIT_INLINE_CACHE=1",
-		"--tag", imageName,
-		"--progress", progressOutput,
-		".",
-	)
-	cmd := exec.Command("docker", args...)
-	cmd.Env = append(os.Environ(), "DOCKER_BUILDKIT=1")
-	cmd.Dir = dir
-	cmd.Stdout = os.Stderr // redirect stdout to stderr - build output is all messaging
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = strings.NewReader(dockerfile)
+	if c.runtime == RuntimeDocker && exportsCache(options.CacheTo) {
+		if err := c.checkBuilderCanExportCache(ctx); err != nil {
+			return err
+		}
+	}
+	// Not CommandContext, because that kills the build without giving it a chance to clean up
+	cmd := exec.Command(c.runtime.Binary(), args...)
+	cmd.Env = os.Environ()
+	if c.runtime == RuntimeDocker {
+		cmd.Env = append(cmd.Env, "DOCKER_BUILDKIT=1")
+	}
+	cmd.Dir = options.Dir
+	out, done := console.LogWriter(console.InfoLevel)
+	defer done()
+	cmd.Stdout = out // redirect stdout to stderr - build output is all messaging
+	cmd.Stderr = out
+	cmd.Stdin = strings.NewReader(options.Dockerfile)
 
 	console.Debug("$ " + strings.Join(cmd.Args, " "))
-	return cmd.Run()
+	return shell.RunInterruptible(ctx, cmd, buildInterruptTimeout)
 }
 
-func BuildAddLabelsToImage(image string, labels map[string]string) error {
-	dockerfile := "FROM " + image
-	var args []string
-	if util.IsM1Mac(runtime.GOOS, runtime.GOARCH) {
-		args = m1BuildxBuildArgs()
-	} else {
-		args = buildKitBuildArgs()
+func (c *CLIClient) generateBuildArgs(options BuildOptions) ([]string, error) {
+	args := c.buildArgs()
+	usesCache := len(options.CacheFrom) > 0 || len(options.CacheTo) > 0
+	if c.runtime == RuntimeDocker && usesCache {
+		// The classic builder can't import or export caches, so use buildx. Builders
+		// other than the default one don't put the image in the local image store
+		// unless they are told to with --load.
+		if args[0] != "buildx" {
+			args = append([]string{"buildx"}, args...)
+		}
+		args = append(args, "--load")
+	}
+	args = append(args, "--file", "-")
+	if c.runtime == RuntimeDocker {
+		args = append(args, "--build-arg", "BUILDKIT_INLINE_CACHE=1")
+	}
+	args = append(args, "--tag", options.ImageName)
+	// Podman prints plain output and doesn't have a --progress flag
+	if c.runtime != RuntimePodman {
+		args = append(args, "--progress", options.ProgressOutput)
+	}
+	for _, secret := range options.Secrets {
+		args = append(args, "--secret", secret)
+	}
+	for _, ssh := range options.SSH {
+		args = append(args, "--ssh", ssh)
 	}
+	labelKeys := make([]string, 0, len(options.Labels))
+	for k := range options.Labels {
+		labelKeys = append(labelKeys, k)
+	}
+	sort.Strings(labelKeys)
+	for _, k := range labelKeys {
+		args = append(args, "--label", k+"="+options.Labels[k])
+	}
+	for _, flag := range []struct {
+		name  string
+		specs []string
+	}{{"--cache-from", options.CacheFrom}, {"--cache-to", options.CacheTo}} {
+		for _, spec := range flag.specs {
+			if c.runtime == RuntimePodman {
+				ref, err := podmanCacheRef(spec)
+				if err != nil {
+					return nil, err
+				}
+				spec = ref
+			}
+			args = append(args, flag.name, spec)
+		}
+	}
+	return append(args, "."), nil
+}
 
+// exportsCache returns true if any of the --cache-to specs export the cache somewhere
+// other than inline in the image, which the default buildx builder can't do
+func exportsCache(specs []string) bool {
+	for _, spec := range specs {
+		if spec != "type=inline" && !strings.HasPrefix(spec, "type=inline,") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkBuilderCanExportCache returns an error if the current buildx builder uses the
+// docker driver, which can't export the build cache, so the build fails before it starts
+// rather than after the image has been built
+func (c *CLIClient) checkBuilderCanExportCache(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, c.runtime.Binary(), "buildx", "inspect")
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Failed to inspect the buildx builder: %s", strings.TrimSpace(string(out)))
+	}
+	if buildxDriver(string(out)) == "docker" {
+		return fmt.Errorf("The current buildx builder uses the docker driver, which can't export the build cache. Create a builder that can with 'docker buildx create --use --driver docker-container', or pass --cache-to none")
+	}
+	return nil
+}
+
+// buildxDriver returns the driver in the output of 'docker buildx inspect'
+func buildxDriver(inspect string) string {
+	for _, line := range strings.Split(inspect, "\n") {
+		if driver := strings.TrimPrefix(line, "Driver:"); driver != line {
+			return strings.TrimSpace(driver)
+		}
+	}
+	return ""
+}
+
+// podmanCacheRef converts a buildx cache spec to the repository Podman takes for
+// --cache-from and --cache-to. Podman can only cache layers in a registry.
+func podmanCacheRef(spec string) (string, error) {
+	if !strings.Contains(spec, "=") {
+		// Already a repository
+		return spec, nil
+	}
+	attrs := map[string]string{}
+	for _, attr := range strings.Split(spec, ",") {
+		parts := strings.SplitN(attr, "=", 2)
+		if len(parts) == 2 {
+			attrs[parts[0]] = parts[1]
+		}
+	}
+	if attrs["type"] != "registry" || attrs["ref"] == "" {
+		return "", fmt.Errorf("Podman can only cache builds in a registry, so the build cache '%s' can't be used", spec)
+	}
+	// Podman caches layers in a repository, so it can't have a tag
+	repository, _ := splitImageTag(attrs["ref"])
+	return repository, nil
+}
+
+func (c *CLIClient) BuildAddLabelsToImage(ctx context.Context, image string, labels map[string]string) error {
+	dockerfile := "FROM " + image
+	args := c.buildArgs()
 	args = append(args,
 		"--file", "-",
 		"--tag", image,
@@ -56,7 +190,7 @@ func BuildAddLabelsToImage(image string, labels map[string]string) error {
 	}
 	// We're not using context, but Docker requires we pass a context
 	args = append(args, ".")
-	cmd := exec.Command("docker", args...)
+	cmd := exec.CommandContext(ctx, c.runtime.Binary(), args...)
 	cmd.Stdin = strings.NewReader(dockerfile)
 
 	console.Debug("$ " + strings.Join(cmd.Args, " "))
@@ -68,10 +202,12 @@ func BuildAddLabelsToImage(image string, labels map[string]string) error {
 	return nil
 }
 
-func m1BuildxBuildArgs() []string {
-	return []string{"buildx", "build", "--platform", "linux/amd64"}
-}
-
-func buildKitBuildArgs() []string {
+func (c *CLIClient) buildArgs() []string {
+	if util.IsM1Mac(runtime.GOOS, runtime.GOARCH) {
+		if c.runtime == RuntimeDocker {
+			return []string{"buildx", "build", "--platform", "linux/amd64"}
+		}
+		return []string{"build", "--platform", "linux/amd64"}
+	}
 	return []string{"build"}
 }
@@ -0,0 +1,103 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateBuildArgs(t *testing.T) {
+	options := BuildOptions{
+		ImageName:      "cog-test",
+		ProgressOutput: "plain",
+		Secrets:        []string{"id=netrc,src=/home/user/.netrc", "id=token,env=TOKEN"},
+		SSH:            []string{"default"},
+		Labels:         map[string]string{"run.cog.version": "0.5.0", "run.cog.project_dir": "/src"},
+	}
+
+	args, err := NewCLIClient(RuntimeDocker).generateBuildArgs(options)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"build", "--file", "-",
+		"--build-arg", "BUILDKIT_INLINE_CACHE=1",
+		"--tag", "cog-test",
+		"--progress", "plain",
+		"--secret", "id=netrc,src=/home/user/.netrc",
+		"--secret", "id=token,env=TOKEN",
+		"--ssh", "default",
+		"--label", "run.cog.project_dir=/src",
+		"--label", "run.cog.version=0.5.0",
+		".",
+	}, args)
+
+	args, err = NewCLIClient(RuntimePodman).generateBuildArgs(options)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"build", "--file", "-",
+		"--tag", "cog-test",
+		"--secret", "id=netrc,src=/home/user/.netrc",
+		"--secret", "id=token,env=TOKEN",
+		"--ssh", "default",
+		"--label", "run.cog.project_dir=/src",
+		"--label", "run.cog.version=0.5.0",
+		".",
+	}, args)
+}
+
+func TestGenerateBuildArgsCache(t *testing.T) {
+	options := BuildOptions{
+		ImageName:      "cog-test",
+		ProgressOutput: "plain",
+		CacheFrom:      []string{"type=registry,ref=r8.im/user/model:buildcache"},
+		CacheTo:        []string{"type=registry,ref=r8.im/user/model:buildcache,mode=max"},
+	}
+
+	args, err := NewCLIClient(RuntimeDocker).generateBuildArgs(options)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"buildx", "build", "--load", "--file", "-",
+		"--build-arg", "BUILDKIT_INLINE_CACHE=1",
+		"--tag", "cog-test",
+		"--progress", "plain",
+		"--cache-from", "type=registry,ref=r8.im/user/model:buildcache",
+		"--cache-to", "type=registry,ref=r8.im/user/model:buildcache,mode=max",
+		".",
+	}, args)
+
+	args, err = NewCLIClient(RuntimePodman).generateBuildArgs(options)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"build", "--file", "-",
+		"--tag", "cog-test",
+		"--cache-from", "r8.im/user/model",
+		"--cache-to", "r8.im/user/model",
+		".",
+	}, args)
+
+	options.CacheTo = []string{"type=local,dest=/tmp/cache"}
+	_, err = NewCLIClient(RuntimePodman).generateBuildArgs(options)
+	require.ErrorContains(t, err, "Podman can only cache builds in a registry")
+}
+
+func TestExportsCache(t *testing.T) {
+	require.False(t, exportsCache(nil))
+	require.False(t, exportsCache([]string{"type=inline"}))
+	require.True(t, exportsCache([]string{"type=inline", "type=local,dest=/tmp/cache,mode=max"}))
+	require.True(t, exportsCache([]string{"type=registry,ref=r8.im/user/model:buildcache,mode=max"}))
+}
+
+func TestBuildxDriver(t *testing.T) {
+	require.Equal(t, "docker", buildxDriver(`Name:   default
+Driver: docker
+
+Nodes:
+Name:      default
+Endpoint:  default
+Status:    running
+Platforms: linux/amd64, linux/386
+`))
+	require.Equal(t, "docker-container", buildxDriver(`Name:   cog
+Driver: docker-container
+`))
+	require.Equal(t, "", buildxDriver(""))
+}
@@ -0,0 +1,10 @@
+package docker
+
+// CLIClient implements Client by running the command-line tool of a container runtime
+type CLIClient struct {
+	runtime Runtime
+}
+
+func NewCLIClient(runtime Runtime) *CLIClient {
+	return &CLIClient{runtime: runtime}
+}
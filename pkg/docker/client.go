@@ -0,0 +1,157 @@
+package docker
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/files"
+)
+
+const defaultSocketPath = "/var/run/docker.sock"
+
+// Client talks to a container engine.
+//
+// There are two implementations: APIClient, which speaks the Docker Engine API over
+// its unix socket, and CLIClient, which shells out to the docker binary. The CLI
+// client is used as a fallback when the socket isn't reachable.
+type Client interface {
+	Build(ctx context.Context, options BuildOptions) error
+	BuildAddLabelsToImage(ctx context.Context, image string, labels map[string]string) error
+	ContainerInspect(ctx context.Context, id string) (*types.ContainerJSON, error)
+	ContainerList(ctx context.Context, label string) ([]types.Container, error)
+	ContainerLogsFollow(ctx context.Context, containerID string, out io.Writer) error
+	ImageInspect(ctx context.Context, id string) (*types.ImageInspect, error)
+	ImageList(ctx context.Context, label string) ([]types.ImageSummary, error)
+	ImageRemove(ctx context.Context, image string) error
+	Kill(ctx context.Context, id string) error
+	Pull(ctx context.Context, image string) error
+	Push(ctx context.Context, image string) error
+	RunDaemon(ctx context.Context, options RunOptions) (string, error)
+	RunWithIO(ctx context.Context, options RunOptions, stdin io.Reader, stdout, stderr io.Writer) error
+	Stop(ctx context.Context, id string) error
+}
+
+var (
+	defaultClient     Client
+	defaultClientOnce sync.Once
+)
+
+// NewClient returns a client for the current runtime. For Docker, this is an API client
+// if the Docker socket is available, otherwise it falls back to the CLI client. Set
+// COG_DOCKER_CLIENT=cli to always use the CLI.
+func NewClient() Client {
+	runtime := CurrentRuntime()
+	if runtime != RuntimeDocker {
+		console.Debugf("Using %s CLI", runtime)
+		return NewCLIClient(runtime)
+	}
+	if os.Getenv("COG_DOCKER_CLIENT") == "cli" {
+		return NewCLIClient(runtime)
+	}
+	socketPath, ok := socketPathFromEnv()
+	if !ok {
+		console.Debug("DOCKER_HOST is not a unix socket, using docker CLI")
+		return NewCLIClient(runtime)
+	}
+	exists, err := files.Exists(socketPath)
+	if err != nil || !exists {
+		console.Debugf("Docker socket %s not found, using docker CLI", socketPath)
+		return NewCLIClient(runtime)
+	}
+	return NewAPIClient(socketPath)
+}
+
+// DefaultClient returns the client used by the package-level functions
+func DefaultClient() Client {
+	defaultClientOnce.Do(func() {
+		if defaultClient == nil {
+			defaultClient = NewClient()
+		}
+	})
+	return defaultClient
+}
+
+// SetDefaultClient replaces the client used by the package-level functions, e.g. with a fake in tests
+func SetDefaultClient(client Client) {
+	defaultClientOnce.Do(func() {})
+	defaultClient = client
+}
+
+func socketPathFromEnv() (string, bool) {
+	host := os.Getenv("DOCKER_HOST")
+	if host == "" {
+		return defaultSocketPath, true
+	}
+	if strings.HasPrefix(host, "unix://") {
+		return strings.TrimPrefix(host, "unix://"), true
+	}
+	return "", false
+}
+
+func Build(options BuildOptions) error {
+	return DefaultClient().Build(context.Background(), options)
+}
+
+func BuildAddLabelsToImage(image string, labels map[string]string) error {
+	return DefaultClient().BuildAddLabelsToImage(context.Background(), image, labels)
+}
+
+func ContainerInspect(id string) (*types.ContainerJSON, error) {
+	return DefaultClient().ContainerInspect(context.Background(), id)
+}
+
+// ContainerList returns the running containers that have the label
+func ContainerList(label string) ([]types.Container, error) {
+	return DefaultClient().ContainerList(context.Background(), label)
+}
+
+func ContainerLogsFollow(containerID string, out io.Writer) error {
+	return DefaultClient().ContainerLogsFollow(context.Background(), containerID, out)
+}
+
+func ImageInspect(id string) (*types.ImageInspect, error) {
+	return DefaultClient().ImageInspect(context.Background(), id)
+}
+
+// ImageList returns the images that have the label
+func ImageList(label string) ([]types.ImageSummary, error) {
+	return DefaultClient().ImageList(context.Background(), label)
+}
+
+func ImageRemove(image string) error {
+	return DefaultClient().ImageRemove(context.Background(), image)
+}
+
+func Kill(id string) error {
+	return DefaultClient().Kill(context.Background(), id)
+}
+
+func Pull(image string) error {
+	return DefaultClient().Pull(context.Background(), image)
+}
+
+func Push(image string) error {
+	return DefaultClient().Push(context.Background(), image)
+}
+
+func Run(options RunOptions) error {
+	return RunWithIO(options, os.Stdin, os.Stdout, os.Stderr)
+}
+
+func RunWithIO(options RunOptions, stdin io.Reader, stdout, stderr io.Writer) error {
+	return DefaultClient().RunWithIO(context.Background(), options, stdin, stdout, stderr)
+}
+
+func RunDaemon(options RunOptions) (string, error) {
+	return DefaultClient().RunDaemon(context.Background(), options)
+}
+
+func Stop(id string) error {
+	return DefaultClient().Stop(context.Background(), id)
+}
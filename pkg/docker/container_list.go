@@ -0,0 +1,84 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// ContainerList returns the running containers that have the label. The CLI's `ps`
+// output differs between runtimes, so the containers are inspected instead.
+func (c *CLIClient) ContainerList(ctx context.Context, label string) ([]types.Container, error) {
+	cmd := exec.CommandContext(ctx, c.runtime.Binary(), "container", "ls", "--quiet", "--no-trunc", "--filter", "label="+label)
+	cmd.Env = os.Environ()
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	ids := strings.Fields(string(out))
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	cmd = exec.CommandContext(ctx, c.runtime.Binary(), append([]string{"container", "inspect"}, ids...)...)
+	cmd.Env = os.Environ()
+	cmd.Stderr = os.Stderr
+	out, err = cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	var inspected []types.ContainerJSON
+	if err := json.Unmarshal(out, &inspected); err != nil {
+		return nil, err
+	}
+	containers := []types.Container{}
+	for _, cont := range inspected {
+		containers = append(containers, containerFromInspect(cont))
+	}
+	return containers, nil
+}
+
+// containerFromInspect converts the output of `docker container inspect` to the summary
+// returned by the API's container list endpoint
+func containerFromInspect(cont types.ContainerJSON) types.Container {
+	summary := types.Container{}
+	if cont.ContainerJSONBase != nil {
+		summary.ID = cont.ID
+		summary.Names = []string{"/" + strings.TrimPrefix(cont.Name, "/")}
+		summary.ImageID = cont.Image
+		if created, err := time.Parse(time.RFC3339Nano, cont.Created); err == nil {
+			summary.Created = created.Unix()
+		}
+		if cont.State != nil {
+			summary.State = cont.State.Status
+		}
+	}
+	if cont.Config != nil {
+		summary.Image = cont.Config.Image
+		summary.Labels = cont.Config.Labels
+	}
+	if cont.NetworkSettings != nil {
+		for port, bindings := range cont.NetworkSettings.Ports {
+			if len(bindings) == 0 {
+				summary.Ports = append(summary.Ports, types.Port{PrivatePort: uint16(port.Int()), Type: port.Proto()})
+			}
+			for _, binding := range bindings {
+				publicPort, _ := strconv.Atoi(binding.HostPort)
+				summary.Ports = append(summary.Ports, types.Port{
+					IP:          binding.HostIP,
+					PrivatePort: uint16(port.Int()),
+					PublicPort:  uint16(publicPort),
+					Type:        port.Proto(),
+				})
+			}
+		}
+	}
+	return summary
+}
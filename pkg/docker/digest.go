@@ -0,0 +1,64 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// ResolveDigest returns image pinned to the digest its tag currently refers to in its
+// registry, in the form repository:tag@sha256:.... Only the manifest is fetched, so the
+// image isn't pulled. If the registry doesn't have the image, e.g. because it was built
+// locally and never pushed, or can't be reached, the digest of the local copy is used. It
+// returns an empty string if the local copy doesn't have a digest either.
+func ResolveDigest(ctx context.Context, image string) (string, error) {
+	if strings.Contains(image, "@") {
+		return image, nil
+	}
+	digest, err := DefaultRegistry().ImageDigest(ctx, image)
+	if err == nil {
+		return image + "@" + digest, nil
+	}
+
+	inspect, inspectErr := DefaultClient().ImageInspect(ctx, image)
+	if inspectErr == ErrNoSuchImage {
+		if err == ErrNoSuchImage {
+			return "", fmt.Errorf("%s doesn't exist in its registry or locally", image)
+		}
+		return "", fmt.Errorf("Failed to resolve the digest of %s: %w", image, err)
+	}
+	if inspectErr != nil {
+		return "", fmt.Errorf("Failed to inspect %s: %w", image, inspectErr)
+	}
+	pinned := pinnedReference(image, inspect.RepoDigests)
+	if pinned != "" && err != ErrNoSuchImage {
+		// The local copy came from the registry, so it might be out of date
+		console.Warnf("Failed to get the current digest of %s from its registry, so the local copy is used: %s", image, err)
+	} else {
+		console.Debugf("Failed to get the digest of %s from its registry: %s", image, err)
+	}
+	return pinned, nil
+}
+
+// pinnedReference returns image with the digest from repoDigests for the same repository
+// added to it, or an empty string if there isn't one
+func pinnedReference(image string, repoDigests []string) string {
+	repository, _ := splitImageTag(image)
+	for _, repoDigest := range repoDigests {
+		digestRepository, digest := splitImageTag(repoDigest)
+		if normalizeRepository(digestRepository) == normalizeRepository(repository) && digest != "" {
+			return image + "@" + digest
+		}
+	}
+	return ""
+}
+
+// normalizeRepository removes the parts of a repository name that Docker Hub names can
+// be written with or without, so python, library/python and docker.io/library/python match
+func normalizeRepository(repository string) string {
+	repository = strings.TrimPrefix(repository, "docker.io/")
+	repository = strings.TrimPrefix(repository, "index.docker.io/")
+	return strings.TrimPrefix(repository, "library/")
+}
@@ -0,0 +1,20 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPinnedReference(t *testing.T) {
+	digest := "sha256:4a5a0a4b1c6e2a8f0e8f2f2b8a3b0c6f1f5d2e3c4b5a69788796a5b4c3d2e1f0"
+
+	require.Equal(t, "python:3.8@"+digest, pinnedReference("python:3.8", []string{"python@" + digest}))
+	// Podman records Docker Hub images with the full name
+	require.Equal(t, "python:3.8@"+digest, pinnedReference("python:3.8", []string{"docker.io/library/python@" + digest}))
+	require.Equal(t, "nvidia/cuda:11.2.0-cudnn8-devel-ubuntu20.04@"+digest, pinnedReference("nvidia/cuda:11.2.0-cudnn8-devel-ubuntu20.04", []string{"other/image@sha256:0000", "nvidia/cuda@" + digest}))
+	require.Equal(t, "localhost:5000/base@"+digest, pinnedReference("localhost:5000/base", []string{"localhost:5000/base@" + digest}))
+
+	// Images built locally don't have a digest
+	require.Equal(t, "", pinnedReference("my-base-image", []string{}))
+}
@@ -0,0 +1,227 @@
+// Package dockertest provides a fake docker.Client so tests don't need a Docker daemon
+package dockertest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+
+	"github.com/replicate/cog/pkg/docker"
+)
+
+// FakeClient is an in-memory docker.Client. Images and containers are looked up by
+// name or ID, and calls that change state are recorded so tests can assert on them.
+type FakeClient struct {
+	Images     map[string]*types.ImageInspect
+	Containers map[string]*types.ContainerJSON
+
+	Builds  []docker.BuildOptions
+	Runs    []docker.RunOptions
+	Pulled  []string
+	Pushed  []string
+	Stopped []string
+	Killed  []string
+	Removed []string
+
+	// RunOutputs is what RunWithIO writes to stdout, by image
+	RunOutputs map[string]string
+
+	mu sync.Mutex
+}
+
+func NewFakeClient() *FakeClient {
+	return &FakeClient{
+		Images:     map[string]*types.ImageInspect{},
+		Containers: map[string]*types.ContainerJSON{},
+		RunOutputs: map[string]string{},
+	}
+}
+
+func (c *FakeClient) Build(ctx context.Context, options docker.BuildOptions) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Builds = append(c.Builds, options)
+	c.Images[options.ImageName] = &types.ImageInspect{
+		ID:       "sha256:" + options.ImageName,
+		RepoTags: []string{options.ImageName},
+		Config:   &container.Config{Labels: map[string]string{}},
+	}
+	return nil
+}
+
+func (c *FakeClient) BuildAddLabelsToImage(ctx context.Context, image string, labels map[string]string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	img, ok := c.Images[image]
+	if !ok {
+		return docker.ErrNoSuchImage
+	}
+	for k, v := range labels {
+		img.Config.Labels[k] = v
+	}
+	return nil
+}
+
+func (c *FakeClient) ContainerInspect(ctx context.Context, id string) (*types.ContainerJSON, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cont, ok := c.Containers[id]
+	if !ok {
+		return nil, fmt.Errorf("No such container: %s", id)
+	}
+	return cont, nil
+}
+
+func (c *FakeClient) ContainerList(ctx context.Context, label string) ([]types.Container, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	containers := []types.Container{}
+	for _, cont := range c.Containers {
+		if cont.State == nil || !cont.State.Running || cont.Config == nil {
+			continue
+		}
+		if _, ok := cont.Config.Labels[label]; ok {
+			containers = append(containers, types.Container{
+				ID:     cont.ID,
+				Image:  cont.Config.Image,
+				Labels: cont.Config.Labels,
+				State:  cont.State.Status,
+			})
+		}
+	}
+	return containers, nil
+}
+
+func (c *FakeClient) ContainerLogsFollow(ctx context.Context, containerID string, out io.Writer) error {
+	return nil
+}
+
+func (c *FakeClient) ImageInspect(ctx context.Context, id string) (*types.ImageInspect, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	img, ok := c.Images[id]
+	if !ok {
+		return nil, docker.ErrNoSuchImage
+	}
+	return img, nil
+}
+
+// ImageList returns the images with the label. Images stored under more than one name
+// are only returned once.
+func (c *FakeClient) ImageList(ctx context.Context, label string) ([]types.ImageSummary, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	images := []types.ImageSummary{}
+	seen := map[*types.ImageInspect]bool{}
+	for _, img := range c.Images {
+		if seen[img] || img.Config == nil {
+			continue
+		}
+		if _, ok := img.Config.Labels[label]; !ok {
+			continue
+		}
+		seen[img] = true
+		summary := types.ImageSummary{
+			ID:       img.ID,
+			RepoTags: img.RepoTags,
+			Size:     img.Size,
+			Labels:   img.Config.Labels,
+		}
+		if created, err := time.Parse(time.RFC3339Nano, img.Created); err == nil {
+			summary.Created = created.Unix()
+		}
+		images = append(images, summary)
+	}
+	sort.Slice(images, func(i, j int) bool { return images[i].ID < images[j].ID })
+	return images, nil
+}
+
+func (c *FakeClient) ImageRemove(ctx context.Context, image string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.Images[image]; !ok {
+		return docker.ErrNoSuchImage
+	}
+	delete(c.Images, image)
+	c.Removed = append(c.Removed, image)
+	return nil
+}
+
+func (c *FakeClient) Kill(ctx context.Context, id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cont, ok := c.Containers[id]
+	if !ok {
+		return docker.ErrNoSuchContainer
+	}
+	cont.State = &types.ContainerState{Status: "exited"}
+	c.Killed = append(c.Killed, id)
+	return nil
+}
+
+func (c *FakeClient) Pull(ctx context.Context, image string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Pulled = append(c.Pulled, image)
+	if _, ok := c.Images[image]; !ok {
+		c.Images[image] = &types.ImageInspect{
+			ID:       "sha256:" + image,
+			RepoTags: []string{image},
+			Config:   &container.Config{Labels: map[string]string{}},
+		}
+	}
+	return nil
+}
+
+func (c *FakeClient) Push(ctx context.Context, image string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Pushed = append(c.Pushed, image)
+	return nil
+}
+
+func (c *FakeClient) RunDaemon(ctx context.Context, options docker.RunOptions) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Runs = append(c.Runs, options)
+	id := fmt.Sprintf("container-%d", len(c.Runs))
+	c.Containers[id] = &types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:    id,
+			Image: options.Image,
+			State: &types.ContainerState{Status: "running", Running: true},
+		},
+		Config: &container.Config{Image: options.Image, Labels: options.Labels},
+	}
+	return id, nil
+}
+
+func (c *FakeClient) RunWithIO(ctx context.Context, options docker.RunOptions, stdin io.Reader, stdout, stderr io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Runs = append(c.Runs, options)
+	if stdout != nil {
+		if _, err := io.WriteString(stdout, c.RunOutputs[options.Image]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *FakeClient) Stop(ctx context.Context, id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cont, ok := c.Containers[id]
+	if !ok {
+		return docker.ErrNoSuchContainer
+	}
+	cont.State = &types.ContainerState{Status: "exited"}
+	c.Stopped = append(c.Stopped, id)
+	return nil
+}
@@ -0,0 +1,50 @@
+package dockertest
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+
+	"github.com/replicate/cog/pkg/docker"
+)
+
+// FakeRegistry is an in-memory docker.Registry. Images are looked up by name.
+type FakeRegistry struct {
+	Images map[string]*types.ImageInspect
+
+	// Inspected are the images that have been read from the registry
+	Inspected []string
+
+	mu sync.Mutex
+}
+
+func NewFakeRegistry() *FakeRegistry {
+	return &FakeRegistry{Images: map[string]*types.ImageInspect{}}
+}
+
+func (r *FakeRegistry) ImageInspect(ctx context.Context, image string) (*types.ImageInspect, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Inspected = append(r.Inspected, image)
+	img, ok := r.Images[image]
+	if !ok {
+		return nil, docker.ErrNoSuchImage
+	}
+	return img, nil
+}
+
+// ImageDigest returns the digest in the image's RepoDigests
+func (r *FakeRegistry) ImageDigest(ctx context.Context, image string) (string, error) {
+	img, err := r.ImageInspect(ctx, image)
+	if err != nil {
+		return "", err
+	}
+	for _, repoDigest := range img.RepoDigests {
+		if i := strings.Index(repoDigest, "@"); i != -1 {
+			return repoDigest[i+1:], nil
+		}
+	}
+	return "", docker.ErrNoSuchImage
+}
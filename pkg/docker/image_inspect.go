@@ -1,6 +1,7 @@
 package docker
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"os"
@@ -13,8 +14,8 @@ import (
 
 var ErrNoSuchImage = errors.New("No image returned")
 
-func ImageInspect(id string) (*types.ImageInspect, error) {
-	cmd := exec.Command("docker", "image", "inspect", id)
+func (c *CLIClient) ImageInspect(ctx context.Context, id string) (*types.ImageInspect, error) {
+	cmd := exec.CommandContext(ctx, c.runtime.Binary(), "image", "inspect", id)
 	cmd.Env = os.Environ()
 	console.Debug("$ " + strings.Join(cmd.Args, " "))
 	out, err := cmd.Output()
@@ -0,0 +1,90 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// ImageList returns the images that have the label. The CLI's `images` output differs
+// between runtimes and doesn't include labels, so the images are inspected instead.
+func (c *CLIClient) ImageList(ctx context.Context, label string) ([]types.ImageSummary, error) {
+	cmd := exec.CommandContext(ctx, c.runtime.Binary(), "image", "ls", "--quiet", "--no-trunc", "--filter", "label="+label)
+	cmd.Env = os.Environ()
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	// Images with more than one tag are listed once for each tag
+	ids := []string{}
+	seen := map[string]bool{}
+	for _, id := range strings.Fields(string(out)) {
+		if !seen[id] {
+			ids = append(ids, id)
+			seen[id] = true
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	cmd = exec.CommandContext(ctx, c.runtime.Binary(), append([]string{"image", "inspect"}, ids...)...)
+	cmd.Env = os.Environ()
+	cmd.Stderr = os.Stderr
+	out, err = cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	var inspected []types.ImageInspect
+	if err := json.Unmarshal(out, &inspected); err != nil {
+		return nil, err
+	}
+	images := []types.ImageSummary{}
+	for _, image := range inspected {
+		images = append(images, imageFromInspect(image))
+	}
+	return images, nil
+}
+
+// ImageRemove removes an image by name or ID. Removing a name removes the image if
+// it doesn't have any other names.
+func (c *CLIClient) ImageRemove(ctx context.Context, image string) error {
+	cmd := exec.CommandContext(ctx, c.runtime.Binary(), "image", "rm", image)
+	cmd.Env = os.Environ()
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if strings.Contains(string(out), "No such image") || strings.Contains(string(out), "image not known") {
+			return ErrNoSuchImage
+		}
+		return errors.New(strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// imageFromInspect converts the output of `docker image inspect` to the summary
+// returned by the API's image list endpoint
+func imageFromInspect(image types.ImageInspect) types.ImageSummary {
+	summary := types.ImageSummary{
+		ID:          image.ID,
+		ParentID:    image.Parent,
+		RepoTags:    image.RepoTags,
+		RepoDigests: image.RepoDigests,
+		Size:        image.Size,
+	}
+	if created, err := time.Parse(time.RFC3339Nano, image.Created); err == nil {
+		summary.Created = created.Unix()
+	}
+	if image.Config != nil {
+		summary.Labels = image.Config.Labels
+	}
+	return summary
+}
@@ -0,0 +1,15 @@
+package docker
+
+import (
+	"context"
+	"os"
+	"os/exec"
+)
+
+func (c *CLIClient) Kill(ctx context.Context, id string) error {
+	cmd := exec.CommandContext(ctx, c.runtime.Binary(), "container", "kill", id)
+	cmd.Env = os.Environ()
+
+	_, err := cmd.Output()
+	return containerCommandError(err)
+}
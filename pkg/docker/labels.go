@@ -0,0 +1,28 @@
+package docker
+
+import (
+	"time"
+
+	"github.com/replicate/cog/pkg/global"
+)
+
+// Labels Cog puts on the containers it starts, so they can be listed with `cog ps`
+var (
+	LabelProjectDir = global.LabelNamespace + "project_dir"
+	LabelCommand    = global.LabelNamespace + "command"
+	LabelImage      = global.LabelNamespace + "image"
+	LabelStartedAt  = global.LabelNamespace + "started_at"
+)
+
+// withContainerLabels returns options with the image and start time added to its labels
+func withContainerLabels(options RunOptions) RunOptions {
+	labels := map[string]string{
+		LabelImage:     options.Image,
+		LabelStartedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	for k, v := range options.Labels {
+		labels[k] = v
+	}
+	options.Labels = labels
+	return options
+}
@@ -1,13 +1,14 @@
 package docker
 
 import (
+	"context"
 	"io"
 	"os"
 	"os/exec"
 )
 
-func ContainerLogsFollow(containerID string, out io.Writer) error {
-	cmd := exec.Command("docker", "container", "logs", "--follow", containerID)
+func (c *CLIClient) ContainerLogsFollow(ctx context.Context, containerID string, out io.Writer) error {
+	cmd := exec.CommandContext(ctx, c.runtime.Binary(), "container", "logs", "--follow", containerID)
 	cmd.Env = os.Environ()
 	cmd.Stdout = out
 	cmd.Stderr = out
@@ -1,17 +1,19 @@
 package docker
 
 import (
-	"os"
+	"context"
 	"os/exec"
 	"strings"
 
 	"github.com/replicate/cog/pkg/util/console"
 )
 
-func Pull(image string) error {
-	cmd := exec.Command("docker", "pull", image)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+func (c *CLIClient) Pull(ctx context.Context, image string) error {
+	cmd := exec.CommandContext(ctx, c.runtime.Binary(), "pull", image)
+	out, done := console.LogWriter(console.InfoLevel)
+	defer done()
+	cmd.Stdout = out
+	cmd.Stderr = out
 
 	console.Debug("$ " + strings.Join(cmd.Args, " "))
 	return cmd.Run()
@@ -1,18 +1,20 @@
 package docker
 
 import (
-	"os"
+	"context"
 	"os/exec"
 	"strings"
 
 	"github.com/replicate/cog/pkg/util/console"
 )
 
-func Push(image string) error {
-	cmd := exec.Command(
-		"docker", "push", image)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+func (c *CLIClient) Push(ctx context.Context, image string) error {
+	cmd := exec.CommandContext(ctx,
+		c.runtime.Binary(), "push", image)
+	out, done := console.LogWriter(console.InfoLevel)
+	defer done()
+	cmd.Stdout = out
+	cmd.Stderr = out
 
 	console.Debug("$ " + strings.Join(cmd.Args, " "))
 	return cmd.Run()
@@ -0,0 +1,38 @@
+package docker
+
+import (
+	"strings"
+)
+
+// dockerHubAuthKey is the key Docker uses for Docker Hub credentials in config.json
+const dockerHubAuthKey = "https://index.docker.io/v1/"
+
+// registryHost returns the registry an image name refers to, in the form used as a key
+// in Docker's config.json
+func registryHost(image string) string {
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return parts[0]
+	}
+	return dockerHubAuthKey
+}
+
+// splitImageTag splits an image name into the repository and the tag or digest.
+// The tag is empty if the name doesn't have one.
+func splitImageTag(image string) (repository string, tag string) {
+	if i := strings.Index(image, "@"); i != -1 {
+		return image[:i], image[i+1:]
+	}
+	// A colon before the last slash is a registry port, not a tag
+	i := strings.LastIndex(image, ":")
+	if i == -1 || strings.Contains(image[i:], "/") {
+		return image, ""
+	}
+	return image[:i], image[i+1:]
+}
+
+// ImageRepository returns an image name without its tag or digest
+func ImageRepository(image string) string {
+	repository, _ := splitImageTag(image)
+	return repository
+}
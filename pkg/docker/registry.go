@@ -0,0 +1,446 @@
+package docker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/cli/cli/config"
+	clitypes "github.com/docker/cli/cli/config/types"
+	"github.com/docker/docker/api/types"
+	containertypes "github.com/docker/docker/api/types/container"
+
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+const (
+	// dockerHubRegistry is where the Registry API for Docker Hub is served
+	dockerHubRegistry = "registry-1.docker.io"
+
+	// remoteOS and remoteArchitecture are the platform Cog builds images for, which is
+	// used when an image in a registry has several
+	remoteOS           = "linux"
+	remoteArchitecture = "amd64"
+
+	mediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+)
+
+// RegistryClient reads images from registries with the Docker Registry HTTP API. It only
+// fetches manifests and configs, so labels can be read without pulling an image's layers.
+type RegistryClient struct {
+	httpClient *http.Client
+	// credentials returns the credentials for a registry, keyed as in Docker's config.json
+	credentials func(host string) (clitypes.AuthConfig, error)
+
+	mu sync.Mutex
+	// tokens are the Authorization headers for each repository, so tokens are only
+	// requested once
+	tokens map[string]string
+}
+
+// NewRegistryClient returns a client that authenticates with the credentials saved by
+// `cog login` or `docker login`, including ones in credential helpers
+func NewRegistryClient() *RegistryClient {
+	return &RegistryClient{
+		httpClient: newRegistryHTTPClient(),
+		credentials: func(host string) (clitypes.AuthConfig, error) {
+			return config.LoadDefaultConfigFile(os.Stderr).GetAuthConfig(host)
+		},
+		tokens: map[string]string{},
+	}
+}
+
+// newRegistryHTTPClient returns an HTTP client that gives up on registries that don't
+// respond. There's no timeout for the whole request, so large configs can still be read
+// over slow connections, and requests are cancelled with the command's context instead.
+func newRegistryHTTPClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 30 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
+	}
+}
+
+// Registry reads images from registries. RegistryClient is the implementation that
+// talks to real registries.
+type Registry interface {
+	ImageInspect(ctx context.Context, image string) (*types.ImageInspect, error)
+	ImageDigest(ctx context.Context, image string) (string, error)
+}
+
+var (
+	defaultRegistry     Registry
+	defaultRegistryOnce sync.Once
+)
+
+// DefaultRegistry returns the registry client used by RemoteImageInspect
+func DefaultRegistry() Registry {
+	defaultRegistryOnce.Do(func() {
+		if defaultRegistry == nil {
+			defaultRegistry = NewRegistryClient()
+		}
+	})
+	return defaultRegistry
+}
+
+// SetDefaultRegistry replaces the registry client used by RemoteImageInspect, e.g. with a fake in tests
+func SetDefaultRegistry(registry Registry) {
+	defaultRegistryOnce.Do(func() {})
+	defaultRegistry = registry
+}
+
+// RemoteImageInspect returns the config of an image in a registry, like ImageInspect
+// does for local images, without pulling its layers
+func RemoteImageInspect(ctx context.Context, image string) (*types.ImageInspect, error) {
+	return DefaultRegistry().ImageInspect(ctx, image)
+}
+
+// remoteReference is an image name split into the parts the Registry API uses
+type remoteReference struct {
+	// authKey is the key for the registry's credentials in Docker's config.json
+	authKey    string
+	registry   string
+	repository string
+	// reference is a tag or digest
+	reference string
+}
+
+func parseRemoteReference(image string) remoteReference {
+	name, reference := splitImageTag(image)
+	if reference == "" {
+		reference = "latest"
+	}
+	ref := remoteReference{authKey: registryHost(image), reference: reference}
+	if ref.authKey == "docker.io" || ref.authKey == "index.docker.io" {
+		name = strings.TrimPrefix(name, ref.authKey+"/")
+		ref.authKey = dockerHubAuthKey
+	}
+	if ref.authKey == dockerHubAuthKey {
+		ref.registry = dockerHubRegistry
+		ref.repository = name
+		if !strings.Contains(ref.repository, "/") {
+			ref.repository = "library/" + ref.repository
+		}
+	} else {
+		ref.registry = ref.authKey
+		ref.repository = strings.TrimPrefix(name, ref.authKey+"/")
+	}
+	return ref
+}
+
+// baseURL returns the URL of the registry. Like Docker, registries on localhost are
+// accessed over plain HTTP.
+func (r remoteReference) baseURL() string {
+	host := r.registry
+	if i := strings.LastIndex(host, ":"); i != -1 {
+		host = host[:i]
+	}
+	if host == "localhost" || strings.HasPrefix(host, "127.") {
+		return "http://" + r.registry
+	}
+	return "https://" + r.registry
+}
+
+type remoteDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Platform  *struct {
+		Architecture string `json:"architecture"`
+		OS           string `json:"os"`
+	} `json:"platform,omitempty"`
+}
+
+// remoteManifest is an image manifest or a list of manifests for several platforms
+type remoteManifest struct {
+	MediaType string             `json:"mediaType"`
+	Config    *remoteDescriptor  `json:"config,omitempty"`
+	Manifests []remoteDescriptor `json:"manifests,omitempty"`
+}
+
+// remoteImageConfig is the part of an image config that Cog uses
+type remoteImageConfig struct {
+	Created      string `json:"created"`
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Config       struct {
+		Labels map[string]string `json:"Labels"`
+	} `json:"config"`
+}
+
+// ImageInspect returns the config of an image in a registry. The ID is the digest of
+// the config, which is the ID the image has when it is pulled.
+func (c *RegistryClient) ImageInspect(ctx context.Context, image string) (*types.ImageInspect, error) {
+	ref := parseRemoteReference(image)
+	manifest, manifestDigest, err := c.manifest(ctx, ref, ref.reference)
+	if err != nil {
+		return nil, err
+	}
+	if len(manifest.Manifests) > 0 {
+		platformDigest := manifest.Manifests[0].Digest
+		for _, m := range manifest.Manifests {
+			if m.Platform != nil && m.Platform.OS == remoteOS && m.Platform.Architecture == remoteArchitecture {
+				platformDigest = m.Digest
+				break
+			}
+		}
+		if manifest, _, err = c.manifest(ctx, ref, platformDigest); err != nil {
+			return nil, err
+		}
+	}
+	if manifest.Config == nil {
+		return nil, fmt.Errorf("The manifest of %s doesn't have a config", image)
+	}
+
+	resp, err := c.get(ctx, ref, "/blobs/"+manifest.Config.Digest, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var imageConfig remoteImageConfig
+	if err := json.NewDecoder(resp.Body).Decode(&imageConfig); err != nil {
+		return nil, fmt.Errorf("Failed to parse the config of %s: %w", image, err)
+	}
+
+	inspect := &types.ImageInspect{
+		ID:           manifest.Config.Digest,
+		Created:      imageConfig.Created,
+		Architecture: imageConfig.Architecture,
+		Os:           imageConfig.OS,
+		Config:       &containertypes.Config{Labels: imageConfig.Config.Labels},
+	}
+	if manifestDigest != "" {
+		name, _ := splitImageTag(image)
+		inspect.RepoDigests = []string{name + "@" + manifestDigest}
+	}
+	return inspect, nil
+}
+
+// ImageDigest returns the digest of the manifest an image's tag currently refers to. For
+// images with several platforms, it's the digest of the list of their manifests.
+func (c *RegistryClient) ImageDigest(ctx context.Context, image string) (string, error) {
+	ref := parseRemoteReference(image)
+	_, digest, err := c.manifest(ctx, ref, ref.reference)
+	if err != nil {
+		return "", err
+	}
+	return digest, nil
+}
+
+// manifest fetches a manifest by tag or digest, returning it and its digest
+func (c *RegistryClient) manifest(ctx context.Context, ref remoteReference, reference string) (*remoteManifest, string, error) {
+	header := http.Header{"Accept": {strings.Join([]string{
+		mediaTypeDockerManifest, mediaTypeDockerManifestList, mediaTypeOCIManifest, mediaTypeOCIIndex,
+	}, ", ")}}
+	resp, err := c.get(ctx, ref, "/manifests/"+reference, header)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("Failed to read manifest: %w", err)
+	}
+	manifest := new(remoteManifest)
+	if err := json.Unmarshal(body, manifest); err != nil {
+		return nil, "", fmt.Errorf("Failed to parse manifest: %w", err)
+	}
+	// Registries should send the digest, but it's the hash of the manifest if they don't
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		sum := sha256.Sum256(body)
+		digest = "sha256:" + hex.EncodeToString(sum[:])
+	}
+	return manifest, digest, nil
+}
+
+// get makes a request to the repository's part of the Registry API, authenticating if
+// the registry asks for it
+func (c *RegistryClient) get(ctx context.Context, ref remoteReference, path string, header http.Header) (*http.Response, error) {
+	u := ref.baseURL() + "/v2/" + ref.repository + path
+	resp, err := c.do(ctx, u, header, c.token(ref))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		authorization, err := c.authenticate(ctx, ref, challenge)
+		if err != nil {
+			return nil, err
+		}
+		if resp, err = c.do(ctx, u, header, authorization); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrNoSuchImage
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		resp.Body.Close()
+		return nil, fmt.Errorf("Failed to authenticate with %s. Run 'cog login' or 'docker login' with an account that can read %s", ref.registry, ref.repository)
+	case resp.StatusCode >= http.StatusBadRequest:
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("%s returned %s: %s", ref.registry, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+func (c *RegistryClient) do(ctx context.Context, u string, header http.Header, authorization string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	console.Debugf("Registry API: GET %s", u)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to connect to %s: %w", req.URL.Host, err)
+	}
+	return resp, nil
+}
+
+func (c *RegistryClient) token(ref remoteReference) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tokens[ref.registry+"/"+ref.repository]
+}
+
+func (c *RegistryClient) saveToken(ref remoteReference, authorization string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tokens[ref.registry+"/"+ref.repository] = authorization
+	return authorization
+}
+
+// authenticate returns the Authorization header to use for a repository, given the
+// WWW-Authenticate challenge the registry responded with. Registries either ask for
+// credentials directly, or for a token from an authorization service.
+func (c *RegistryClient) authenticate(ctx context.Context, ref remoteReference, challenge string) (string, error) {
+	auth, err := c.credentials(ref.authKey)
+	if err != nil {
+		return "", fmt.Errorf("Failed to get credentials for %s: %w", ref.authKey, err)
+	}
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if auth.Username == "" {
+			return "", fmt.Errorf("%s requires you to log in. Run 'cog login' or 'docker login'", ref.registry)
+		}
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth(auth.Username, auth.Password)
+		return c.saveToken(ref, req.Header.Get("Authorization")), nil
+
+	case "bearer":
+		realm, err := url.Parse(params["realm"])
+		if err != nil || params["realm"] == "" {
+			return "", fmt.Errorf("%s asked for a token, but didn't say where to get it from", ref.registry)
+		}
+		query := realm.Query()
+		if params["service"] != "" {
+			query.Set("service", params["service"])
+		}
+		scope := params["scope"]
+		if scope == "" {
+			scope = "repository:" + ref.repository + ":pull"
+		}
+		query.Set("scope", scope)
+		realm.RawQuery = query.Encode()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+		if err != nil {
+			return "", err
+		}
+		// Without credentials, this gets an anonymous token for public images
+		if auth.Username != "" {
+			req.SetBasicAuth(auth.Username, auth.Password)
+		}
+		console.Debugf("Registry API: GET %s", realm.String())
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return "", fmt.Errorf("Failed to get a token for %s: %w", ref.registry, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("Failed to authenticate with %s: %s. Run 'cog login' or 'docker login' with an account that can read %s", ref.registry, resp.Status, ref.repository)
+		}
+		var token struct {
+			Token       string `json:"token"`
+			AccessToken string `json:"access_token"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+			return "", fmt.Errorf("Failed to parse token from %s: %w", ref.registry, err)
+		}
+		if token.Token == "" {
+			token.Token = token.AccessToken
+		}
+		return c.saveToken(ref, "Bearer "+token.Token), nil
+	}
+	return "", fmt.Errorf("%s asked for an unsupported type of authentication: %q", ref.registry, challenge)
+}
+
+// parseChallenge parses a WWW-Authenticate header like
+// Bearer realm="https://auth.docker.io/token",service="registry.docker.io"
+func parseChallenge(challenge string) (scheme string, params map[string]string) {
+	params = map[string]string{}
+	challenge = strings.TrimSpace(challenge)
+	i := strings.Index(challenge, " ")
+	if i == -1 {
+		return challenge, params
+	}
+	scheme, rest := challenge[:i], challenge[i+1:]
+	for rest != "" {
+		rest = strings.TrimLeft(rest, " ,")
+		eq := strings.Index(rest, "=")
+		if eq == -1 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = rest[eq+1:]
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end == -1 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else if comma := strings.Index(rest, ","); comma != -1 {
+			value, rest = rest[:comma], rest[comma+1:]
+		} else {
+			value, rest = rest, ""
+		}
+		params[key] = value
+	}
+	return scheme, params
+}
@@ -0,0 +1,120 @@
+package docker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	clitypes "github.com/docker/cli/cli/config/types"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRegistry starts a registry with one image, which has a manifest for each of
+// two platforms. It requires a token from its authorization service, which is only given
+// to the user "user" with the password "secret".
+func newTestRegistry(t *testing.T) *httptest.Server {
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "user" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		require.Equal(t, "repository:user/model:pull", r.URL.Query().Get("scope"))
+		_, _ = w.Write([]byte(`{"token": "abc123"}`))
+	})
+	mux.HandleFunc("/v2/user/model/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer abc123" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="test",scope="repository:user/model:pull"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch strings.TrimPrefix(r.URL.Path, "/v2/user/model") {
+		case "/manifests/latest":
+			w.Header().Set("Docker-Content-Digest", "sha256:index")
+			_, _ = w.Write([]byte(`{"mediaType": "application/vnd.oci.image.index.v1+json", "manifests": [
+				{"digest": "sha256:arm64", "platform": {"architecture": "arm64", "os": "linux"}},
+				{"digest": "sha256:amd64", "platform": {"architecture": "amd64", "os": "linux"}}
+			]}`))
+		case "/manifests/sha256:amd64":
+			_, _ = w.Write([]byte(`{"mediaType": "application/vnd.oci.image.manifest.v1+json", "config": {"digest": "sha256:config"}}`))
+		case "/blobs/sha256:config":
+			_, _ = w.Write([]byte(`{"created": "2022-09-01T12:00:00Z", "architecture": "amd64", "os": "linux", "config": {"Labels": {"run.cog.version": "0.5.0"}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRegistryClientImageInspect(t *testing.T) {
+	server := newTestRegistry(t)
+	host := strings.TrimPrefix(server.URL, "http://")
+	credentials := map[string]clitypes.AuthConfig{host: {Username: "user", Password: "secret"}}
+	client := NewRegistryClient()
+	client.credentials = func(host string) (clitypes.AuthConfig, error) {
+		return credentials[host], nil
+	}
+
+	image, err := client.ImageInspect(context.Background(), host+"/user/model")
+	require.NoError(t, err)
+	require.Equal(t, "sha256:config", image.ID)
+	require.Equal(t, "amd64", image.Architecture)
+	require.Equal(t, "0.5.0", image.Config.Labels["run.cog.version"])
+	require.Equal(t, []string{host + "/user/model@sha256:index"}, image.RepoDigests)
+
+	digest, err := client.ImageDigest(context.Background(), host+"/user/model")
+	require.NoError(t, err)
+	require.Equal(t, "sha256:index", digest)
+
+	_, err = client.ImageInspect(context.Background(), host+"/user/model:missing")
+	require.ErrorIs(t, err, ErrNoSuchImage)
+
+	credentials[host] = clitypes.AuthConfig{Username: "user", Password: "wrong"}
+	client.tokens = map[string]string{}
+	_, err = client.ImageInspect(context.Background(), host+"/user/model")
+	require.ErrorContains(t, err, "Run 'cog login' or 'docker login'")
+}
+
+func TestRegistryClientCancel(t *testing.T) {
+	// A registry that never responds
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	t.Cleanup(server.Close)
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := NewRegistryClient().ImageInspect(ctx, host+"/user/model")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestParseRemoteReference(t *testing.T) {
+	require.Equal(t, remoteReference{authKey: dockerHubAuthKey, registry: dockerHubRegistry, repository: "library/python", reference: "3.8"}, parseRemoteReference("python:3.8"))
+	require.Equal(t, remoteReference{authKey: dockerHubAuthKey, registry: dockerHubRegistry, repository: "library/python", reference: "latest"}, parseRemoteReference("docker.io/python"))
+	require.Equal(t, remoteReference{authKey: "r8.im", registry: "r8.im", repository: "user/model", reference: "sha256:abc"}, parseRemoteReference("r8.im/user/model@sha256:abc"))
+
+	require.Equal(t, "https://r8.im", parseRemoteReference("r8.im/user/model").baseURL())
+	require.Equal(t, "http://localhost:5000", parseRemoteReference("localhost:5000/model").baseURL())
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/python:pull"`)
+	require.Equal(t, "Bearer", scheme)
+	require.Equal(t, map[string]string{
+		"realm":   "https://auth.docker.io/token",
+		"service": "registry.docker.io",
+		"scope":   "repository:library/python:pull",
+	}, params)
+
+	scheme, params = parseChallenge(`Basic realm="Registry"`)
+	require.Equal(t, "Basic", scheme)
+	require.Equal(t, "Registry", params["realm"])
+}
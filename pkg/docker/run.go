@@ -2,11 +2,13 @@ package docker
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"sort"
 	"strings"
 
 	"github.com/mattn/go-isatty"
@@ -28,6 +30,8 @@ type RunOptions struct {
 	Env     []string
 	GPUs    string
 	Image   string
+	Labels  map[string]string
+	Name    string
 	Ports   []Port
 	Volumes []Volume
 	Workdir string
@@ -43,7 +47,7 @@ type internalRunOptions struct {
 
 var ErrMissingDeviceDriver = errors.New("Docker is missing required device driver")
 
-func generateDockerArgs(options internalRunOptions) []string {
+func (c *CLIClient) generateDockerArgs(options internalRunOptions) []string {
 	// Use verbose options for clarity
 	dockerArgs := []string{
 		"run",
@@ -59,11 +63,22 @@ func generateDockerArgs(options internalRunOptions) []string {
 		dockerArgs = append(dockerArgs, "--env", env)
 	}
 	if options.GPUs != "" {
-		dockerArgs = append(dockerArgs, "--gpus", options.GPUs)
+		dockerArgs = append(dockerArgs, c.runtime.gpuArgs(options.GPUs)...)
 	}
 	if options.Interactive {
 		dockerArgs = append(dockerArgs, "--interactive")
 	}
+	labelKeys := make([]string, 0, len(options.Labels))
+	for k := range options.Labels {
+		labelKeys = append(labelKeys, k)
+	}
+	sort.Strings(labelKeys)
+	for _, k := range labelKeys {
+		dockerArgs = append(dockerArgs, "--label", k+"="+options.Labels[k])
+	}
+	if options.Name != "" {
+		dockerArgs = append(dockerArgs, "--name", options.Name)
+	}
 	for _, port := range options.Ports {
 		dockerArgs = append(dockerArgs, "--publish", fmt.Sprintf("%d:%d", port.HostPort, port.ContainerPort))
 	}
@@ -83,12 +98,8 @@ func generateDockerArgs(options internalRunOptions) []string {
 	return dockerArgs
 }
 
-func Run(options RunOptions) error {
-	return RunWithIO(options, os.Stdin, os.Stdout, os.Stderr)
-}
-
-func RunWithIO(options RunOptions, stdin io.Reader, stdout, stderr io.Writer) error {
-	internalOptions := internalRunOptions{RunOptions: options}
+func (c *CLIClient) RunWithIO(ctx context.Context, options RunOptions, stdin io.Reader, stdout, stderr io.Writer) error {
+	internalOptions := internalRunOptions{RunOptions: withContainerLabels(options)}
 	if stdin != nil {
 		internalOptions.Interactive = true
 		if f, ok := stdin.(*os.File); ok {
@@ -98,8 +109,8 @@ func RunWithIO(options RunOptions, stdin io.Reader, stdout, stderr io.Writer) er
 	stderrCopy := new(bytes.Buffer)
 	stderrMultiWriter := io.MultiWriter(stderr, stderrCopy)
 
-	dockerArgs := generateDockerArgs(internalOptions)
-	cmd := exec.Command("docker", dockerArgs...)
+	dockerArgs := c.generateDockerArgs(internalOptions)
+	cmd := exec.CommandContext(ctx, c.runtime.Binary(), dockerArgs...)
 	cmd.Env = os.Environ()
 	cmd.Stdout = stdout
 	cmd.Stdin = stdin
@@ -116,15 +127,17 @@ func RunWithIO(options RunOptions, stdin io.Reader, stdout, stderr io.Writer) er
 	return nil
 }
 
-func RunDaemon(options RunOptions) (string, error) {
-	internalOptions := internalRunOptions{RunOptions: options}
+func (c *CLIClient) RunDaemon(ctx context.Context, options RunOptions) (string, error) {
+	internalOptions := internalRunOptions{RunOptions: withContainerLabels(options)}
 	internalOptions.Detach = true
 
-	dockerArgs := generateDockerArgs(internalOptions)
-	cmd := exec.Command("docker", dockerArgs...)
+	dockerArgs := c.generateDockerArgs(internalOptions)
+	cmd := exec.CommandContext(ctx, c.runtime.Binary(), dockerArgs...)
 	cmd.Env = os.Environ()
 	// TODO: display errors more elegantly?
-	cmd.Stderr = os.Stderr
+	stderr, done := console.LogWriter(console.InfoLevel)
+	defer done()
+	cmd.Stderr = stderr
 
 	console.Debug("$ " + strings.Join(cmd.Args, " "))
 
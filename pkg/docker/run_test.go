@@ -0,0 +1,61 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateDockerArgs(t *testing.T) {
+	options := internalRunOptions{
+		RunOptions: RunOptions{
+			Args:    []string{"python", "predict.py"},
+			GPUs:    "all",
+			Image:   "cog-test",
+			Labels:  map[string]string{"run.cog.project_dir": "/project", "run.cog.command": "predict"},
+			Ports:   []Port{{HostPort: 5001, ContainerPort: 5000}},
+			Volumes: []Volume{{Source: "/project", Destination: "/src"}},
+			Workdir: "/src",
+		},
+		Detach: true,
+	}
+
+	require.Equal(t, []string{
+		"run", "--rm", "--shm-size", "8G",
+		"--detach",
+		"--gpus", "all",
+		"--label", "run.cog.command=predict",
+		"--label", "run.cog.project_dir=/project",
+		"--publish", "5001:5000",
+		"--mount", "type=bind,source=/project,destination=/src",
+		"--workdir", "/src",
+		"cog-test", "python", "predict.py",
+	}, NewCLIClient(RuntimeDocker).generateDockerArgs(options))
+
+	require.Equal(t, []string{
+		"run", "--rm", "--shm-size", "8G",
+		"--detach",
+		"--device", "nvidia.com/gpu=all",
+		"--label", "run.cog.command=predict",
+		"--label", "run.cog.project_dir=/project",
+		"--publish", "5001:5000",
+		"--mount", "type=bind,source=/project,destination=/src",
+		"--workdir", "/src",
+		"cog-test", "python", "predict.py",
+	}, NewCLIClient(RuntimePodman).generateDockerArgs(options))
+}
+
+func TestPodmanGPUArgs(t *testing.T) {
+	require.Equal(t, []string{"--device", "nvidia.com/gpu=0", "--device", "nvidia.com/gpu=1"}, RuntimePodman.gpuArgs("2"))
+	require.Equal(t, []string{"--device", "nvidia.com/gpu=3"}, RuntimePodman.gpuArgs("device=3"))
+	require.Equal(t, []string{"--gpus", "2"}, RuntimeNerdctl.gpuArgs("2"))
+}
+
+func TestParseRuntime(t *testing.T) {
+	r, err := ParseRuntime("podman")
+	require.NoError(t, err)
+	require.Equal(t, RuntimePodman, r)
+
+	_, err = ParseRuntime("rkt")
+	require.ErrorContains(t, err, "must be one of: docker, podman, nerdctl")
+}
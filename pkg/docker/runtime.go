@@ -0,0 +1,115 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/version"
+)
+
+// Runtime is a container engine with a Docker-compatible command-line interface
+type Runtime string
+
+const (
+	RuntimeDocker  Runtime = "docker"
+	RuntimePodman  Runtime = "podman"
+	RuntimeNerdctl Runtime = "nerdctl"
+)
+
+var runtimes = []Runtime{RuntimeDocker, RuntimePodman, RuntimeNerdctl}
+
+// Capabilities are the optional features of a runtime that Cog makes use of
+type Capabilities struct {
+	// CacheMounts is true if Dockerfiles can use `RUN --mount=type=cache`
+	CacheMounts bool
+}
+
+// ParseRuntime returns the runtime with the given name
+func ParseRuntime(name string) (Runtime, error) {
+	for _, r := range runtimes {
+		if string(r) == name {
+			return r, nil
+		}
+	}
+	names := []string{}
+	for _, r := range runtimes {
+		names = append(names, string(r))
+	}
+	return "", fmt.Errorf("Unknown container runtime '%s', must be one of: %s", name, strings.Join(names, ", "))
+}
+
+// CurrentRuntime returns the runtime selected with --runtime or COG_RUNTIME
+func CurrentRuntime() Runtime {
+	r, err := ParseRuntime(global.Runtime)
+	if err != nil {
+		console.Warnf("%s. Using docker.", err)
+		return RuntimeDocker
+	}
+	return r
+}
+
+func (r Runtime) Binary() string {
+	return string(r)
+}
+
+// Capabilities detects what the runtime supports
+func (r Runtime) Capabilities(ctx context.Context) (Capabilities, error) {
+	switch r {
+	case RuntimePodman:
+		// Buildah, which Podman uses to build images, supports cache mounts from Podman 4
+		out, err := exec.CommandContext(ctx, r.Binary(), "version", "--format", "{{.Client.Version}}").Output()
+		if err != nil {
+			return Capabilities{}, fmt.Errorf("Failed to get Podman version: %w", err)
+		}
+		v, err := version.NewVersion(strings.SplitN(strings.TrimSpace(string(out)), "-", 2)[0])
+		if err != nil {
+			return Capabilities{}, fmt.Errorf("Failed to parse Podman version: %w", err)
+		}
+		return Capabilities{CacheMounts: v.Major >= 4}, nil
+	default:
+		// Docker and nerdctl both build with BuildKit
+		return Capabilities{CacheMounts: true}, nil
+	}
+}
+
+// RuntimeCapabilities detects the capabilities of the current runtime, assuming the
+// capabilities of Docker if detection fails
+func RuntimeCapabilities() Capabilities {
+	r := CurrentRuntime()
+	caps, err := r.Capabilities(context.Background())
+	if err != nil {
+		console.Warnf("Failed to detect capabilities of %s: %s", r, err)
+		return Capabilities{CacheMounts: true}
+	}
+	console.Debugf("Capabilities of %s: %+v", r, caps)
+	return caps
+}
+
+// gpuArgs returns the arguments to expose GPUs to a container
+func (r Runtime) gpuArgs(gpus string) []string {
+	if r == RuntimePodman {
+		// Podman doesn't support --gpus, but exposes GPUs as CDI devices
+		// https://docs.nvidia.com/datacenter/cloud-native/container-toolkit/cdi-support.html
+		if gpus == "all" {
+			return []string{"--device", "nvidia.com/gpu=all"}
+		}
+		ids := strings.Split(strings.TrimPrefix(gpus, "device="), ",")
+		if count, err := strconv.Atoi(gpus); err == nil {
+			ids = []string{}
+			for i := 0; i < count; i++ {
+				ids = append(ids, strconv.Itoa(i))
+			}
+		}
+		args := []string{}
+		for _, id := range ids {
+			args = append(args, "--device", "nvidia.com/gpu="+id)
+		}
+		return args
+	}
+	return []string{"--gpus", gpus}
+}
@@ -1,15 +1,38 @@
 package docker
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"os/exec"
+	"strings"
 )
 
-func Stop(id string) error {
-	cmd := exec.Command("docker", "container", "stop", "--time", "3", id)
+// ErrNoSuchContainer is returned when stopping or killing a container that doesn't exist,
+// e.g. because it has already exited and been removed
+var ErrNoSuchContainer = errors.New("No such container")
+
+func (c *CLIClient) Stop(ctx context.Context, id string) error {
+	cmd := exec.CommandContext(ctx, c.runtime.Binary(), "container", "stop", "--time", "3", id)
 	cmd.Env = os.Environ()
-	cmd.Stderr = os.Stderr
 
 	_, err := cmd.Output()
+	return containerCommandError(err)
+}
+
+// containerCommandError converts the error from a command that stops or kills a container
+// to ErrNoSuchContainer if the container doesn't exist. Docker and Podman word this
+// differently, but both say "no such container".
+func containerCommandError(err error) error {
+	if ee, ok := err.(*exec.ExitError); ok {
+		stderr := strings.TrimSpace(string(ee.Stderr))
+		if strings.Contains(strings.ToLower(stderr), "no such container") {
+			return ErrNoSuchContainer
+		}
+		if stderr != "" {
+			return fmt.Errorf("%w: %s", err, stderr)
+		}
+	}
 	return err
 }
@@ -11,11 +11,22 @@ import (
 	"strings"
 
 	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/util/slices"
 )
 
 //go:embed embed/cog.whl
 var cogWheelEmbed []byte
 
+const micromambaVersion = "1.5.8-0"
+
+// CondaPrefix is where the conda environment is created. It is put first on the PATH, so
+// its Python is used for everything else, including Cog.
+const CondaPrefix = "/opt/conda"
+
+// sshKnownHosts are the hosts whose keys are added to known_hosts when SSH is forwarded to
+// the build, as well as the hosts of any git+ssh packages in cog.yaml
+var sshKnownHosts = []string{"github.com", "gitlab.com", "bitbucket.org"}
+
 type Generator struct {
 	Config *config.Config
 	Dir    string
@@ -24,6 +35,28 @@ type Generator struct {
 	GOOS   string
 	GOARCH string
 
+	// UseCacheMounts is false if the container runtime doesn't support `RUN --mount=type=cache`
+	UseCacheMounts bool
+
+	// SSHIDs are the IDs of the SSH agents or keys forwarded to the build, which are mounted
+	// when Python packages are installed
+	SSHIDs []string
+
+	// Lock is the locked versions of packages from cog.lock to install, instead of resolving
+	// the ones in cog.yaml, or nil if it isn't being used
+	Lock *config.Lock
+
+	// BaseImagePythonVersion is the version of Python in Config.Build.BaseImage, or empty
+	// if it doesn't have Python, in which case Cog installs it
+	BaseImagePythonVersion string
+	// BaseImagePython3Only is true if Python is only called python3 in the base image, so
+	// python and pip need to be linked to it
+	BaseImagePython3Only bool
+
+	// PinnedImages maps the images in FROM lines to the same images pinned to a digest,
+	// like python:3.8@sha256:..., so the build doesn't change if the tag is moved
+	PinnedImages map[string]string
+
 	// absolute path to tmpDir, a directory that will be cleaned up
 	tmpDir string
 	// tmpDir relative to Dir
@@ -51,6 +84,7 @@ func NewGenerator(config *config.Config, dir string) (*Generator, error) {
 		Dir:            dir,
 		GOOS:           runtime.GOOS,
 		GOARCH:         runtime.GOOS,
+		UseCacheMounts: true,
 		tmpDir:         tmpDir,
 		relativeTmpDir: relativeTmpDir,
 	}, nil
@@ -62,16 +96,21 @@ func (g *Generator) GenerateBase() (string, error) {
 		return "", err
 	}
 	installPython := ""
-	if g.Config.Build.GPU {
+	if g.installsPython() {
 		installPython, err = g.installPython()
 		if err != nil {
 			return "", err
 		}
 	}
+	condaInstalls, err := g.condaInstalls()
+	if err != nil {
+		return "", err
+	}
 	aptInstalls, err := g.aptInstalls()
 	if err != nil {
 		return "", err
 	}
+	sshSetup := g.sshSetup()
 	pythonRequirements, err := g.pythonRequirements()
 	if err != nil {
 		return "", err
@@ -89,17 +128,59 @@ func (g *Generator) GenerateBase() (string, error) {
 	if err != nil {
 		return "", err
 	}
+	beforeInstall, afterInstall := g.dockerfileSnippets()
 
+	if !g.Config.Build.Slim {
+		return strings.Join(filterEmpty([]string{
+			"# syntax = docker/dockerfile:1.2",
+			"FROM " + g.pinned(baseImage),
+			g.preamble(),
+			beforeInstall,
+			installPython,
+			g.linkPython(),
+			condaInstalls,
+			installCog,
+			aptInstalls,
+			sshSetup,
+			pythonRequirements,
+			pipInstalls,
+			run,
+			afterInstall,
+			`WORKDIR /src`,
+			`EXPOSE 5000`,
+			`CMD ["python", "-m", "cog.server.http"]`,
+		}), "\n"), nil
+	}
+
+	// Slim builds install Python and the model's dependencies in a builder stage, then copy
+	// them into a runtime stage without the compilers and headers needed to build them.
+	// System packages are installed in both, because they might be needed to build Python
+	// packages as well as to run the model. Commands in 'run' run in the runtime stage.
+	runtimeImage, err := g.runtimeImage()
+	if err != nil {
+		return "", err
+	}
 	return strings.Join(filterEmpty([]string{
 		"# syntax = docker/dockerfile:1.2",
-		"FROM " + baseImage,
+		"FROM " + g.pinned(baseImage) + " AS builder",
 		g.preamble(),
+		beforeInstall,
 		installPython,
+		g.linkPython(),
+		condaInstalls,
 		installCog,
 		aptInstalls,
+		sshSetup,
 		pythonRequirements,
 		pipInstalls,
+		"FROM " + g.pinned(runtimeImage),
+		g.preamble(),
+		beforeInstall,
+		g.runtimePythonLibraries(),
+		aptInstalls,
+		g.copyPythonFromBuilder(),
 		run,
+		afterInstall,
 		`WORKDIR /src`,
 		`EXPOSE 5000`,
 		`CMD ["python", "-m", "cog.server.http"]`,
@@ -124,20 +205,92 @@ func (g *Generator) Cleanup() error {
 	return nil
 }
 
+// BaseImages returns the images the Dockerfile is built from. The first is the base image,
+// and slim builds also have the image for the runtime stage.
+func (g *Generator) BaseImages() ([]string, error) {
+	baseImage, err := g.baseImage()
+	if err != nil {
+		return nil, err
+	}
+	if !g.Config.Build.Slim {
+		return []string{baseImage}, nil
+	}
+	runtimeImage, err := g.runtimeImage()
+	if err != nil {
+		return nil, err
+	}
+	return []string{baseImage, runtimeImage}, nil
+}
+
+// pinned returns image pinned to a digest, if it is in PinnedImages
+func (g *Generator) pinned(image string) string {
+	if pinned, ok := g.PinnedImages[image]; ok {
+		return pinned
+	}
+	return image
+}
+
 func (g *Generator) baseImage() (string, error) {
+	if g.Config.Build.BaseImage != "" {
+		return g.Config.Build.BaseImage, nil
+	}
 	if g.Config.Build.GPU {
 		return g.Config.CUDABaseImageTag()
 	}
 	return "python:" + g.Config.Build.PythonVersion, nil
 }
 
+// runtimeImage returns the image for the runtime stage of a slim build
+func (g *Generator) runtimeImage() (string, error) {
+	if g.Config.Build.GPU {
+		return g.Config.CUDARuntimeImageTag()
+	}
+	return "python:" + g.Config.Build.PythonVersion + "-slim", nil
+}
+
+// runtimePythonLibraries installs the shared libraries that Python installed by Cog links
+// to. The -dev packages are used because the library package names change between Ubuntu
+// versions, and the headers are small compared to the compilers left in the builder stage.
+func (g *Generator) runtimePythonLibraries() string {
+	if !g.installsPython() {
+		return ""
+	}
+	return g.runWithCache("/var/cache/apt") + `apt-get update -qq && apt-get install -qqy --no-install-recommends \
+	libssl-dev \
+	zlib1g-dev \
+	libbz2-dev \
+	libreadline-dev \
+	libsqlite3-dev \
+	libncursesw5-dev \
+	libffi-dev \
+	liblzma-dev \
+	ca-certificates \
+	&& rm -rf /var/lib/apt/lists/*`
+}
+
+// copyPythonFromBuilder copies Python and the installed packages from the builder stage
+// of a slim build
+func (g *Generator) copyPythonFromBuilder() string {
+	switch {
+	case g.Config.UsesConda():
+		return `ENV PATH="` + CondaPrefix + `/bin:$PATH"
+COPY --from=builder ` + CondaPrefix + " " + CondaPrefix
+	case g.installsPython():
+		return `ENV PATH="/root/.pyenv/shims:/root/.pyenv/bin:$PATH"
+COPY --from=builder /root/.pyenv /root/.pyenv`
+	default:
+		// The python images have Python in /usr/local
+		return "COPY --from=builder /usr/local /usr/local"
+	}
+}
+
 func (g *Generator) preamble() string {
 	lines := []string{
 		`ENV DEBIAN_FRONTEND=noninteractive
 ENV PYTHONUNBUFFERED=1
 ENV LD_LIBRARY_PATH=$LD_LIBRARY_PATH:/usr/lib/x86_64-linux-gnu:/usr/local/nvidia/lib64:/usr/local/nvidia/bin`,
 	}
-	if g.Config.Build.GPU {
+	if g.Config.Build.GPU && g.Config.Build.BaseImage == "" {
 		// Temporary hack until base images are updated
 		// https://github.com/NVIDIA/nvidia-docker/issues/1631
 		lines = append(lines, `RUN rm -f /etc/apt/sources.list.d/cuda.list && \
@@ -148,12 +301,46 @@ ENV LD_LIBRARY_PATH=$LD_LIBRARY_PATH:/usr/lib/x86_64-linux-gnu:/usr/local/nvidia
 	return strings.Join(lines, "\n")
 }
 
+// installsPython returns true if the base image doesn't have Python, so Cog needs to
+// install it. The python:<version> images have it, and conda environments have their own.
+func (g *Generator) installsPython() bool {
+	if g.Config.UsesConda() {
+		return false
+	}
+	if g.Config.Build.BaseImage != "" {
+		return g.BaseImagePythonVersion == ""
+	}
+	return g.Config.Build.GPU
+}
+
+// linkPython links python and pip to python3 and pip3 if the base image only has those,
+// because Cog runs them as python and pip
+func (g *Generator) linkPython() string {
+	if g.installsPython() || !g.BaseImagePython3Only {
+		return ""
+	}
+	return `RUN ln -s "$(command -v python3)" /usr/local/bin/python && (command -v pip >/dev/null || ln -s "$(command -v pip3)" /usr/local/bin/pip)`
+}
+
+// dockerfileSnippets returns the Dockerfile snippets from cog.yaml to insert before and
+// after dependencies are installed
+func (g *Generator) dockerfileSnippets() (before string, after string) {
+	snippets := g.Config.Build.DockerfileSnippets
+	if snippets == nil {
+		return "", ""
+	}
+	return strings.TrimSpace(snippets.BeforeInstall), strings.TrimSpace(snippets.AfterInstall)
+}
+
 func (g *Generator) aptInstalls() (string, error) {
 	packages := g.Config.Build.SystemPackages
+	if g.Lock != nil {
+		packages = g.Lock.SystemPackages
+	}
 	if len(packages) == 0 {
 		return "", nil
 	}
-	return "RUN --mount=type=cache,target=/var/cache/apt apt-get update -qq && apt-get install -qqy " +
+	return g.runWithCacheAndSecrets("/var/cache/apt") + "apt-get update -qq && apt-get install -qqy " +
 		strings.Join(packages, " ") +
 		" && rm -rf /var/lib/apt/lists/*", nil
 }
@@ -164,7 +351,7 @@ func (g *Generator) installPython() (string, error) {
 	py := g.Config.Build.PythonVersion
 
 	return `ENV PATH="/root/.pyenv/shims:/root/.pyenv/bin:$PATH"
-RUN --mount=type=cache,target=/var/cache/apt apt-get update -qq && apt-get install -qqy --no-install-recommends \
+` + g.runWithCache("/var/cache/apt") + `apt-get update -qq && apt-get install -qqy --no-install-recommends \
 	make \
 	build-essential \
 	libssl-dev \
@@ -192,6 +379,65 @@ RUN --mount=type=cache,target=/var/cache/apt apt-get update -qq && apt-get insta
 	pip install "wheel<1"`, py, py), nil
 }
 
+// condaInstalls installs micromamba and creates a conda environment with Python and the
+// conda packages in it
+func (g *Generator) condaInstalls() (string, error) {
+	if !g.Config.UsesConda() {
+		return "", nil
+	}
+
+	lines := []string{
+		"ENV MAMBA_ROOT_PREFIX=/opt/micromamba",
+		`ENV PATH="` + CondaPrefix + `/bin:$PATH"`,
+		// The CUDA base images don't have curl, and micromamba needs bzip2 to extract packages
+		g.runWithCache("/var/cache/apt") + "apt-get update -qq && apt-get install -qqy --no-install-recommends curl ca-certificates bzip2 && rm -rf /var/lib/apt/lists/*",
+		"RUN curl -fsSL -o /usr/local/bin/micromamba https://github.com/mamba-org/micromamba-releases/releases/download/" + micromambaVersion + "/micromamba-linux-$(uname -m | sed -e s/x86_64/64/) && chmod +x /usr/local/bin/micromamba",
+	}
+
+	args := []string{"micromamba", "create", "-y", "-p", CondaPrefix}
+	if g.Lock != nil && len(g.Lock.CondaPackages) > 0 {
+		// The locked environment is created from an explicit environment file, which
+		// lists the exact packages to install, so nothing is resolved
+		lockFilename := "conda.lock.txt"
+		contents := "@EXPLICIT\n" + strings.Join(g.Lock.CondaPackages, "\n") + "\n"
+		if err := os.WriteFile(filepath.Join(g.tmpDir, lockFilename), []byte(contents), 0o644); err != nil {
+			return "", fmt.Errorf("Failed to write %s: %w", lockFilename, err)
+		}
+		lines = append(lines, fmt.Sprintf("COPY %s /tmp/%s", path.Join(g.relativeTmpDir, lockFilename), lockFilename))
+		args = append(args, "-f", "/tmp/"+lockFilename)
+		return strings.Join(append(lines, g.condaCreate(args)), "\n"), nil
+	}
+	if env := g.Config.Build.CondaEnvironment; env != "" {
+		lines = append(lines, fmt.Sprintf("COPY %s /tmp/environment.yml", env))
+		args = append(args, "-f", "/tmp/environment.yml")
+	}
+	channels := g.Config.Build.CondaChannels
+	if len(channels) == 0 {
+		channels = []string{"conda-forge"}
+	}
+	for _, channel := range channels {
+		args = append(args, "-c", shellQuote(channel))
+	}
+	args = append(args, shellQuote("python="+g.Config.Build.PythonVersion), "pip")
+	for _, pkg := range g.Config.Build.CondaPackages {
+		args = append(args, shellQuote(pkg))
+	}
+
+	lines = append(lines, g.condaCreate(args))
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// condaCreate returns the RUN instruction to create the conda environment with args
+func (g *Generator) condaCreate(args []string) string {
+	create := strings.Join(args, " ")
+	if !g.UseCacheMounts {
+		// The package cache would otherwise end up in the image
+		create += " && micromamba clean -y --all"
+	}
+	return g.runWithCacheAndSecrets("/opt/micromamba/pkgs") + create
+}
+
 func (g *Generator) installCog() (string, error) {
 	// Wheel name needs to be full format otherwise pip refuses to install it
 	cogFilename := "cog-0.0.1.dev-py3-none-any.whl"
@@ -203,16 +449,17 @@ func (g *Generator) installCog() (string, error) {
 		return "", fmt.Errorf("Failed to write %s: %w", cogFilename, err)
 	}
 	return fmt.Sprintf(`COPY %s /tmp/%s
-RUN --mount=type=cache,target=/root/.cache/pip pip install /tmp/%s`, path.Join(g.relativeTmpDir, cogFilename), cogFilename, cogFilename), nil
+%spip install /tmp/%s`, path.Join(g.relativeTmpDir, cogFilename), cogFilename, g.runWithCache("/root/.cache/pip"), cogFilename), nil
 }
 
 func (g *Generator) pythonRequirements() (string, error) {
 	reqs := g.Config.Build.PythonRequirements
-	if reqs == "" {
+	// The resolved requirements are installed from the lock in pipInstalls
+	if reqs == "" || g.Lock != nil {
 		return "", nil
 	}
 	return fmt.Sprintf(`COPY %s /tmp/requirements.txt
-RUN --mount=type=cache,target=/root/.cache/pip pip install -r /tmp/requirements.txt && rm /tmp/requirements.txt`, reqs), nil
+%spip install -r /tmp/requirements.txt && rm /tmp/requirements.txt`, reqs, g.runWithCacheAndSecrets("/root/.cache/pip")+g.sshMounts()), nil
 }
 
 func (g *Generator) pipInstalls() (string, error) {
@@ -220,6 +467,9 @@ func (g *Generator) pipInstalls() (string, error) {
 	if err != nil {
 		return "", err
 	}
+	if g.Lock != nil {
+		packages = g.Lock.PythonPackages
+	}
 	if len(packages) == 0 {
 		return "", nil
 	}
@@ -236,7 +486,17 @@ func (g *Generator) pipInstalls() (string, error) {
 		extraIndexURLs += "--extra-index-url=" + indexURL
 	}
 
-	return "RUN --mount=type=cache,target=/root/.cache/pip pip install " + findLinks + " " + extraIndexURLs + " " + strings.Join(packages, " "), nil
+	if g.Lock != nil {
+		// There can be hundreds of locked packages, so install them from a file
+		lockFilename := "requirements.lock.txt"
+		if err := os.WriteFile(filepath.Join(g.tmpDir, lockFilename), []byte(strings.Join(packages, "\n")+"\n"), 0o644); err != nil {
+			return "", fmt.Errorf("Failed to write %s: %w", lockFilename, err)
+		}
+		return fmt.Sprintf(`COPY %s /tmp/%s
+%spip install %s %s -r /tmp/%s && rm /tmp/%s`, path.Join(g.relativeTmpDir, lockFilename), lockFilename, g.runWithCacheAndSecrets("/root/.cache/pip")+g.sshMounts(), findLinks, extraIndexURLs, lockFilename, lockFilename), nil
+	}
+
+	return g.runWithCacheAndSecrets("/root/.cache/pip") + g.sshMounts() + "pip install " + findLinks + " " + extraIndexURLs + " " + strings.Join(packages, " "), nil
 }
 
 func (g *Generator) run() (string, error) {
@@ -253,11 +513,103 @@ func (g *Generator) run() (string, error) {
 
 This is the offending line: %s`, run)
 		}
-		lines = append(lines, "RUN "+run)
+		lines = append(lines, "RUN "+g.secretMounts()+run)
 	}
 	return strings.Join(lines, "\n"), nil
 }
 
+// runWithCache returns the start of a RUN instruction that mounts a cache directory at target,
+// or a plain RUN if cache mounts aren't supported
+func (g *Generator) runWithCache(target string) string {
+	if !g.UseCacheMounts {
+		return "RUN "
+	}
+	return "RUN --mount=type=cache,target=" + target + " "
+}
+
+// shellQuote quotes s for a shell if it contains anything other than characters that are
+// safe in a word, so conda specs like "numpy>=1.20" aren't treated as redirects
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_.=:/+@") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// runWithCacheAndSecrets is runWithCache, but also mounts the secrets from cog.yaml, for
+// commands that might need credentials to install packages
+func (g *Generator) runWithCacheAndSecrets(target string) string {
+	return g.runWithCache(target) + g.secretMounts()
+}
+
+// secretMounts returns the options to mount the secrets from cog.yaml in a RUN instruction.
+// Secret mounts aren't saved in the image.
+func (g *Generator) secretMounts() string {
+	mounts := ""
+	for _, secret := range g.Config.Build.Secrets {
+		mounts += "--mount=type=secret,id=" + secret.ID
+		if secret.Target != "" {
+			mounts += ",target=" + secret.Target
+		}
+		mounts += " "
+	}
+	return mounts
+}
+
+// sshSetup installs the SSH client and adds the keys of common git hosts to known_hosts, so
+// pip can install git+ssh packages with the SSH agents forwarded to the build
+func (g *Generator) sshSetup() string {
+	if len(g.SSHIDs) == 0 {
+		return ""
+	}
+	hosts := append([]string{}, sshKnownHosts...)
+	keyscans := []string{}
+	for _, pkg := range g.Config.Build.PythonPackages {
+		host, port := gitSSHHost(pkg)
+		switch {
+		case host == "" || slices.ContainsString(hosts, host):
+			// Not a git+ssh package, or the host is already scanned
+		case port != "":
+			keyscans = append(keyscans, "ssh-keyscan -p "+port+" "+host+" >> /root/.ssh/known_hosts")
+		default:
+			hosts = append(hosts, host)
+		}
+	}
+	keyscans = append([]string{"ssh-keyscan " + strings.Join(hosts, " ") + " >> /root/.ssh/known_hosts"}, keyscans...)
+	return g.runWithCache("/var/cache/apt") + `(command -v ssh-keyscan >/dev/null && command -v git >/dev/null || ` +
+		`(apt-get update -qq && apt-get install -qqy --no-install-recommends openssh-client git && rm -rf /var/lib/apt/lists/*)) && ` +
+		`mkdir -p -m 0700 /root/.ssh && ` + strings.Join(keyscans, " && ")
+}
+
+// sshMounts returns the options to mount the forwarded SSH agents or keys in a RUN instruction
+func (g *Generator) sshMounts() string {
+	mounts := ""
+	for _, id := range g.SSHIDs {
+		if id == "default" {
+			mounts += "--mount=type=ssh "
+		} else {
+			mounts += "--mount=type=ssh,id=" + id + " "
+		}
+	}
+	return mounts
+}
+
+// gitSSHHost returns the host and port of a package like git+ssh://git@github.com/org/repo.git,
+// or an empty host if it isn't a git+ssh package
+func gitSSHHost(pkg string) (host string, port string) {
+	if !strings.HasPrefix(pkg, "git+ssh://") {
+		return "", ""
+	}
+	host = strings.SplitN(strings.TrimPrefix(pkg, "git+ssh://"), "/", 2)[0]
+	if i := strings.LastIndex(host, "@"); i >= 0 {
+		host = host[i+1:]
+	}
+	if i := strings.Index(host, ":"); i >= 0 {
+		return host[:i], host[i+1:]
+	}
+	return host, ""
+}
+
 func filterEmpty(list []string) []string {
 	filtered := []string{}
 	for _, s := range list {
@@ -3,6 +3,7 @@ package dockerfile
 import (
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -250,3 +251,404 @@ build:
 	require.Contains(t, actual, `COPY my-requirements.txt /tmp/requirements.txt
 RUN --mount=type=cache,target=/root/.cache/pip pip install -r /tmp/requirements.txt && rm /tmp/requirements.txt`)
 }
+
+func TestWithoutCacheMounts(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "test")
+	require.NoError(t, err)
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  gpu: false
+  system_packages:
+    - cowsay
+  python_packages:
+    - pandas==1.2.0.12
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndCompleteConfig())
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	gen.UseCacheMounts = false
+	actual, err := gen.Generate()
+	require.NoError(t, err)
+
+	expected := `# syntax = docker/dockerfile:1.2
+FROM python:3.8
+ENV DEBIAN_FRONTEND=noninteractive
+ENV PYTHONUNBUFFERED=1
+ENV LD_LIBRARY_PATH=$LD_LIBRARY_PATH:/usr/lib/x86_64-linux-gnu:/usr/local/nvidia/lib64:/usr/local/nvidia/bin
+COPY ` + gen.relativeTmpDir + `/cog-0.0.1.dev-py3-none-any.whl /tmp/cog-0.0.1.dev-py3-none-any.whl
+RUN pip install /tmp/cog-0.0.1.dev-py3-none-any.whl
+RUN apt-get update -qq && apt-get install -qqy cowsay && rm -rf /var/lib/apt/lists/*
+RUN pip install   pandas==1.2.0.12
+WORKDIR /src
+EXPOSE 5000
+CMD ["python", "-m", "cog.server.http"]
+COPY . /src`
+	require.Equal(t, expected, actual)
+}
+
+func TestCondaGPU(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "test")
+	require.NoError(t, err)
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  gpu: true
+  cuda: "11.2"
+  python_version: "3.9"
+  conda_channels:
+    - pytorch
+    - conda-forge
+  conda_packages:
+    - faiss-gpu
+    - rdkit>=2022.03
+  conda_environment: environment.yml
+  python_packages:
+    - pandas==1.2.0.12
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndCompleteConfig())
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	actual, err := gen.Generate()
+	require.NoError(t, err)
+
+	expected := `# syntax = docker/dockerfile:1.2
+FROM nvidia/cuda:11.2.0-cudnn8-devel-ubuntu20.04
+ENV DEBIAN_FRONTEND=noninteractive
+ENV PYTHONUNBUFFERED=1
+ENV LD_LIBRARY_PATH=$LD_LIBRARY_PATH:/usr/lib/x86_64-linux-gnu:/usr/local/nvidia/lib64:/usr/local/nvidia/bin
+RUN rm -f /etc/apt/sources.list.d/cuda.list && \
+    rm -f /etc/apt/sources.list.d/nvidia-ml.list && \
+    apt-key del 7fa2af80
+ENV MAMBA_ROOT_PREFIX=/opt/micromamba
+ENV PATH="/opt/conda/bin:$PATH"
+RUN --mount=type=cache,target=/var/cache/apt apt-get update -qq && apt-get install -qqy --no-install-recommends curl ca-certificates bzip2 && rm -rf /var/lib/apt/lists/*
+RUN curl -fsSL -o /usr/local/bin/micromamba https://github.com/mamba-org/micromamba-releases/releases/download/` + micromambaVersion + `/micromamba-linux-$(uname -m | sed -e s/x86_64/64/) && chmod +x /usr/local/bin/micromamba
+COPY environment.yml /tmp/environment.yml
+RUN --mount=type=cache,target=/opt/micromamba/pkgs micromamba create -y -p /opt/conda -f /tmp/environment.yml -c pytorch -c conda-forge python=3.9 pip faiss-gpu 'rdkit>=2022.03'
+` + testInstallCog(gen.relativeTmpDir) + `
+RUN --mount=type=cache,target=/root/.cache/pip pip install   pandas==1.2.0.12
+WORKDIR /src
+EXPOSE 5000
+CMD ["python", "-m", "cog.server.http"]
+COPY . /src`
+	require.Equal(t, expected, actual)
+}
+
+func TestCondaWithoutCacheMounts(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "test")
+	require.NoError(t, err)
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  conda_packages:
+    - rdkit
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndCompleteConfig())
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	gen.UseCacheMounts = false
+	actual, err := gen.Generate()
+	require.NoError(t, err)
+	require.Contains(t, actual, "\nRUN micromamba create -y -p /opt/conda -c conda-forge python=3.8 pip rdkit && micromamba clean -y --all\n")
+}
+
+func TestBaseImageAndDockerfileSnippets(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "test")
+	require.NoError(t, err)
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  gpu: true
+  base_image: registry.example.com/hardened/python:3.8
+  dockerfile_snippets:
+    before_install: |
+      COPY certs/ca.crt /usr/local/share/ca-certificates/ca.crt
+      RUN update-ca-certificates
+    after_install: |
+      USER model
+  python_packages:
+    - pandas==1.2.0.12
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndCompleteConfig())
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	gen.BaseImagePythonVersion = "3.8.13"
+	actual, err := gen.Generate()
+	require.NoError(t, err)
+
+	expected := `# syntax = docker/dockerfile:1.2
+FROM registry.example.com/hardened/python:3.8
+ENV DEBIAN_FRONTEND=noninteractive
+ENV PYTHONUNBUFFERED=1
+ENV LD_LIBRARY_PATH=$LD_LIBRARY_PATH:/usr/lib/x86_64-linux-gnu:/usr/local/nvidia/lib64:/usr/local/nvidia/bin
+COPY certs/ca.crt /usr/local/share/ca-certificates/ca.crt
+RUN update-ca-certificates
+` + testInstallCog(gen.relativeTmpDir) + `
+RUN --mount=type=cache,target=/root/.cache/pip pip install   pandas==1.2.0.12
+USER model
+WORKDIR /src
+EXPOSE 5000
+CMD ["python", "-m", "cog.server.http"]
+COPY . /src`
+	require.Equal(t, expected, actual)
+
+	// python and pip are linked to python3 and pip3 if the base image only has those
+	gen.BaseImagePython3Only = true
+	actual, err = gen.Generate()
+	require.NoError(t, err)
+	require.Contains(t, actual, "RUN update-ca-certificates\n"+`RUN ln -s "$(command -v python3)" /usr/local/bin/python && (command -v pip >/dev/null || ln -s "$(command -v pip3)" /usr/local/bin/pip)`+"\n")
+
+	// Cog installs Python if the base image doesn't have it
+	gen.BaseImagePythonVersion = ""
+	gen.BaseImagePython3Only = false
+	actual, err = gen.Generate()
+	require.NoError(t, err)
+	require.Contains(t, actual, "RUN update-ca-certificates\n"+testInstallPython("3.8"))
+}
+
+func TestSlimGPU(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "test")
+	require.NoError(t, err)
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  gpu: true
+  slim: true
+  cuda: "11.2"
+  system_packages:
+    - ffmpeg
+  python_packages:
+    - pandas==1.2.0.12
+  run:
+    - "cowsay moo"
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndCompleteConfig())
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	actual, err := gen.Generate()
+	require.NoError(t, err)
+
+	preamble := `ENV DEBIAN_FRONTEND=noninteractive
+ENV PYTHONUNBUFFERED=1
+ENV LD_LIBRARY_PATH=$LD_LIBRARY_PATH:/usr/lib/x86_64-linux-gnu:/usr/local/nvidia/lib64:/usr/local/nvidia/bin
+RUN rm -f /etc/apt/sources.list.d/cuda.list && \
+    rm -f /etc/apt/sources.list.d/nvidia-ml.list && \
+    apt-key del 7fa2af80
+`
+	aptInstall := "RUN --mount=type=cache,target=/var/cache/apt apt-get update -qq && apt-get install -qqy ffmpeg && rm -rf /var/lib/apt/lists/*\n"
+	expected := `# syntax = docker/dockerfile:1.2
+FROM nvidia/cuda:11.2.0-cudnn8-devel-ubuntu20.04 AS builder
+` + preamble + testInstallPython("3.8") + testInstallCog(gen.relativeTmpDir) + "\n" + aptInstall +
+		`RUN --mount=type=cache,target=/root/.cache/pip pip install   pandas==1.2.0.12
+FROM nvidia/cuda:11.2.0-cudnn8-runtime-ubuntu20.04
+` + preamble + `RUN --mount=type=cache,target=/var/cache/apt apt-get update -qq && apt-get install -qqy --no-install-recommends \
+	libssl-dev \
+	zlib1g-dev \
+	libbz2-dev \
+	libreadline-dev \
+	libsqlite3-dev \
+	libncursesw5-dev \
+	libffi-dev \
+	liblzma-dev \
+	ca-certificates \
+	&& rm -rf /var/lib/apt/lists/*
+` + aptInstall + `ENV PATH="/root/.pyenv/shims:/root/.pyenv/bin:$PATH"
+COPY --from=builder /root/.pyenv /root/.pyenv
+RUN cowsay moo
+WORKDIR /src
+EXPOSE 5000
+CMD ["python", "-m", "cog.server.http"]
+COPY . /src`
+	require.Equal(t, expected, actual)
+}
+
+func TestSlimCPU(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "test")
+	require.NoError(t, err)
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  slim: true
+  python_version: "3.9"
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndCompleteConfig())
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	actual, err := gen.Generate()
+	require.NoError(t, err)
+	require.Contains(t, actual, "FROM python:3.9 AS builder\n")
+	require.Contains(t, actual, "FROM python:3.9-slim\n")
+	require.Contains(t, actual, "COPY --from=builder /usr/local /usr/local\n")
+}
+
+func TestPinnedImages(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "test")
+	require.NoError(t, err)
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  slim: true
+  python_version: "3.9"
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndCompleteConfig())
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	images, err := gen.BaseImages()
+	require.NoError(t, err)
+	require.Equal(t, []string{"python:3.9", "python:3.9-slim"}, images)
+
+	gen.PinnedImages = map[string]string{
+		"python:3.9":      "python:3.9@sha256:1111",
+		"python:3.9-slim": "python:3.9-slim@sha256:2222",
+	}
+	actual, err := gen.Generate()
+	require.NoError(t, err)
+	require.Contains(t, actual, "FROM python:3.9@sha256:1111 AS builder\n")
+	require.Contains(t, actual, "FROM python:3.9-slim@sha256:2222\n")
+}
+
+func TestSecrets(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "test")
+	require.NoError(t, err)
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  system_packages:
+    - cowsay
+  python_extra_index_urls:
+    - https://pypi.example.com/simple
+  python_packages:
+    - private-package==1.0.0
+  run:
+    - "cowsay moo"
+  secrets:
+    - id: netrc
+      src: ~/.netrc
+      target: /root/.netrc
+    - id: token
+      env: TOKEN
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndCompleteConfig())
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	actual, err := gen.Generate()
+	require.NoError(t, err)
+
+	mounts := "--mount=type=secret,id=netrc,target=/root/.netrc --mount=type=secret,id=token "
+	require.Contains(t, actual, "RUN --mount=type=cache,target=/var/cache/apt "+mounts+"apt-get update")
+	require.Contains(t, actual, "RUN --mount=type=cache,target=/root/.cache/pip "+mounts+"pip install  --extra-index-url=https://pypi.example.com/simple private-package==1.0.0")
+	require.Contains(t, actual, "RUN "+mounts+"cowsay moo")
+	require.Contains(t, actual, "\n"+testInstallCog(gen.relativeTmpDir)+"\n")
+}
+
+func TestSSH(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "test")
+	require.NoError(t, err)
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  python_packages:
+    - git+ssh://git@git.example.com:2222/org/private.git
+    - git+ssh://git@github.com/org/other.git
+    - pandas==1.2.0.12
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndCompleteConfig())
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	gen.SSHIDs = []string{"default", "work"}
+	actual, err := gen.Generate()
+	require.NoError(t, err)
+
+	require.Contains(t, actual, `
+RUN --mount=type=cache,target=/var/cache/apt (command -v ssh-keyscan >/dev/null && command -v git >/dev/null || (apt-get update -qq && apt-get install -qqy --no-install-recommends openssh-client git && rm -rf /var/lib/apt/lists/*)) && mkdir -p -m 0700 /root/.ssh && ssh-keyscan github.com gitlab.com bitbucket.org >> /root/.ssh/known_hosts && ssh-keyscan -p 2222 git.example.com >> /root/.ssh/known_hosts
+RUN --mount=type=cache,target=/root/.cache/pip --mount=type=ssh --mount=type=ssh,id=work pip install   git+ssh://git@git.example.com:2222/org/private.git git+ssh://git@github.com/org/other.git pandas==1.2.0.12
+`)
+}
+
+func TestLock(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "test")
+	require.NoError(t, err)
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  system_packages:
+    - ffmpeg
+  python_requirements: requirements.txt
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndCompleteConfig())
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	gen.Lock = &config.Lock{
+		PythonPackages: []string{"attrs==22.1.0", "torch==1.12.1"},
+		SystemPackages: []string{"ffmpeg=7:4.2.7-0ubuntu0.1"},
+	}
+	actual, err := gen.Generate()
+	require.NoError(t, err)
+
+	require.NotContains(t, actual, "requirements.txt")
+	require.Contains(t, actual, "apt-get install -qqy ffmpeg=7:4.2.7-0ubuntu0.1 &&")
+	require.Contains(t, actual, `COPY `+gen.relativeTmpDir+`/requirements.lock.txt /tmp/requirements.lock.txt
+RUN --mount=type=cache,target=/root/.cache/pip pip install   -r /tmp/requirements.lock.txt && rm /tmp/requirements.lock.txt
+`)
+	contents, err := os.ReadFile(gen.tmpDir + "/requirements.lock.txt")
+	require.NoError(t, err)
+	require.Equal(t, "attrs==22.1.0\ntorch==1.12.1\n", string(contents))
+}
+
+func TestCondaLock(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "test")
+	require.NoError(t, err)
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  conda_packages:
+    - rdkit
+  conda_environment: environment.yml
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndCompleteConfig())
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	gen.Lock = &config.Lock{
+		PythonPackages: []string{"attrs==22.1.0"},
+		CondaPackages: []string{
+			"https://conda.anaconda.org/conda-forge/linux-64/python-3.8.13-ha86cf86_0_cpython.tar.bz2#c5e1a8ffc0bd2c4bc6ac6ad2a9b1d7ba",
+			"https://conda.anaconda.org/conda-forge/linux-64/rdkit-2022.03.5-py38h1ad9e9e_0.tar.bz2#3a1b4d2e5c6f7a8b9c0d1e2f3a4b5c6d",
+		},
+	}
+	actual, err := gen.Generate()
+	require.NoError(t, err)
+
+	require.NotContains(t, actual, "environment.yml")
+	require.Contains(t, actual, `COPY `+gen.relativeTmpDir+`/conda.lock.txt /tmp/conda.lock.txt
+RUN --mount=type=cache,target=/opt/micromamba/pkgs micromamba create -y -p /opt/conda -f /tmp/conda.lock.txt
+`)
+	contents, err := os.ReadFile(gen.tmpDir + "/conda.lock.txt")
+	require.NoError(t, err)
+	require.Equal(t, "@EXPLICIT\n"+strings.Join(gen.Lock.CondaPackages, "\n")+"\n", string(contents))
+}
@@ -1,7 +1,19 @@
 package errors
 
+import (
+	"errors"
+)
+
 const (
-	CodeConfigNotFound = "CONFIG_NOT_FOUND"
+	CodeConfigNotFound   = "CONFIG_NOT_FOUND"
+	CodeConfigInvalid    = "CONFIG_INVALID"
+	CodeBuildFailed      = "BUILD_FAILED"
+	CodePushFailed       = "PUSH_FAILED"
+	CodeSetupFailed      = "SETUP_FAILED"
+	CodePredictionFailed = "PREDICTION_FAILED"
+	CodeTestFailed       = "TEST_FAILED"
+	CodeInterrupted      = "INTERRUPTED"
+	CodeUnknown          = "UNKNOWN"
 )
 
 // Types ////////////////////////////////////////
@@ -13,6 +25,7 @@ type CodedError interface {
 type codedError struct {
 	code string
 	msg  string
+	err  error
 }
 
 func (e *codedError) Error() string {
@@ -23,6 +36,10 @@ func (e *codedError) Code() string {
 	return e.code
 }
 
+func (e *codedError) Unwrap() error {
+	return e.err
+}
+
 // Error Creators ///////////////////////////////
 
 // The Cog config was not found
@@ -33,15 +50,64 @@ func ConfigNotFound(msg string) error {
 	}
 }
 
+// Building the Docker image failed
+func BuildFailed(err error) error {
+	return withCode(CodeBuildFailed, err)
+}
+
+// Pushing the Docker image failed
+func PushFailed(err error) error {
+	return withCode(CodePushFailed, err)
+}
+
+// The model's container failed to start or run setup()
+func SetupFailed(err error) error {
+	return withCode(CodeSetupFailed, err)
+}
+
+// Running a prediction failed
+func PredictionFailed(err error) error {
+	return withCode(CodePredictionFailed, err)
+}
+
+// One or more of the examples run by 'cog test' failed
+func TestFailed(err error) error {
+	return withCode(CodeTestFailed, err)
+}
+
+// The command was stopped with Ctrl-C or SIGTERM
+func Interrupted() error {
+	return &codedError{
+		code: CodeInterrupted,
+		msg:  "Interrupted",
+	}
+}
+
+func withCode(code string, err error) error {
+	if err == nil {
+		return nil
+	}
+	// Keep the most specific code
+	if Code(err) != "" {
+		return err
+	}
+	return &codedError{code: code, msg: err.Error(), err: err}
+}
+
 // Helpers //////////////////////////////////////
 
 func IsConfigNotFound(err error) bool {
 	return Code(err) == CodeConfigNotFound
 }
 
+func IsPredictionFailed(err error) bool {
+	return Code(err) == CodePredictionFailed
+}
+
 // Return the error code, or the empty string
 func Code(err error) string {
-	if cerr, ok := err.(CodedError); ok {
+	var cerr CodedError
+	if errors.As(err, &cerr) {
 		return cerr.Code()
 	}
 
@@ -12,7 +12,9 @@ var (
 	ProfilingEnabled      = false
 	StartupTimeout        = 5 * time.Minute
 	ConfigFilename        = "cog.yaml"
+	LockFilename          = "cog.lock"
 	ReplicateRegistryHost = "r8.im"
 	ReplicateWebsiteHost  = "replicate.com"
 	LabelNamespace        = "run.cog."
+	Runtime               = "docker"
 )
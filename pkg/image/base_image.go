@@ -0,0 +1,149 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/dockerfile"
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// baseImagePythonVersion returns the version of Python on the PATH in a base image, or
+// an empty string if it doesn't have Python. Some images only have Python as python3, in
+// which case python3Only is true.
+func baseImagePythonVersion(ctx context.Context, baseImage string) (version string, python3Only bool, err error) {
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	err = docker.DefaultClient().RunWithIO(ctx, docker.RunOptions{
+		Image: baseImage,
+		Args: []string{
+			"sh", "-c", `for python in python python3; do if command -v $python >/dev/null; then echo $python; $python -c 'import platform; print(platform.python_version())' 2>/dev/null; exit; fi; done`,
+		},
+		Labels: map[string]string{docker.LabelCommand: "build"},
+	}, nil, &stdout, &stderr)
+	if err != nil {
+		console.Info(stderr.String())
+		return "", false, fmt.Errorf("Failed to check the version of Python in %s: %w", baseImage, err)
+	}
+	lines := strings.Fields(stdout.String())
+	if len(lines) != 2 {
+		return "", false, nil
+	}
+	return lines[1], lines[0] == "python3", nil
+}
+
+// Labels that record the base images an image was built from, pinned to their digests
+var (
+	baseImageLabel    = global.LabelNamespace + "base_image"
+	runtimeImageLabel = global.LabelNamespace + "runtime_image"
+)
+
+// pinnedImages are the images an image is built from, pinned to their digests. Each is
+// empty if there isn't one, or it doesn't have a digest it could be pinned to.
+type pinnedImages struct {
+	base string
+	// runtime is the image for the runtime stage of slim builds
+	runtime string
+}
+
+// list returns the images that were pinned, base image first
+func (p pinnedImages) list() []string {
+	images := []string{}
+	for _, ref := range []string{p.base, p.runtime} {
+		if ref != "" {
+			images = append(images, ref)
+		}
+	}
+	return images
+}
+
+// pinBaseImages pins the images the generator builds from to their digests, and returns
+// the pinned images. With options.Reproducible, the digests recorded in cog.lock or a
+// previous build of imageName are used, instead of the ones the tags currently refer to.
+func pinBaseImages(ctx context.Context, generator *dockerfile.Generator, dir string, imageName string, options BuildOptions) (pinnedImages, error) {
+	pinned := pinnedImages{}
+	images, err := generator.BaseImages()
+	if err != nil {
+		return pinned, err
+	}
+	recorded := map[string]string{}
+	if options.Reproducible {
+		recorded, err = recordedBaseImages(ctx, dir, imageName)
+		if err != nil {
+			return pinned, err
+		}
+	}
+
+	generator.PinnedImages = map[string]string{}
+	for i, image := range images {
+		var ref string
+		if options.Reproducible {
+			var ok bool
+			ref, ok = recorded[image]
+			if !ok {
+				return pinned, fmt.Errorf("There is no recorded digest for %s in %s or a previous build of %s. Run 'cog lock' or build without --reproducible to record one", image, global.LockFilename, imageName)
+			}
+		} else {
+			ref, err = docker.ResolveDigest(ctx, image)
+			if err != nil {
+				return pinned, err
+			}
+			if ref == "" {
+				console.Warnf("%s doesn't have a digest, so the build can't be pinned to it", image)
+				continue
+			}
+		}
+		console.Debugf("Using %s", ref)
+		generator.PinnedImages[image] = ref
+		// BaseImages returns the base image first, then the runtime image
+		if i == 0 {
+			pinned.base = ref
+		} else {
+			pinned.runtime = ref
+		}
+	}
+	return pinned, nil
+}
+
+// recordedBaseImages returns the pinned base images recorded in cog.lock and in the labels
+// of an existing imageName, by the image they were pinned from. cog.lock takes precedence.
+func recordedBaseImages(ctx context.Context, dir string, imageName string) (map[string]string, error) {
+	recorded := map[string]string{}
+	add := func(ref string) {
+		image := strings.SplitN(ref, "@", 2)[0]
+		if _, ok := recorded[image]; !ok && strings.Contains(ref, "@") {
+			recorded[image] = ref
+		}
+	}
+
+	lock, err := config.ReadLock(dir)
+	if err != nil {
+		return nil, err
+	}
+	if lock != nil {
+		for _, ref := range lock.BaseImages {
+			add(ref)
+		}
+	}
+
+	inspect, err := docker.DefaultClient().ImageInspect(ctx, imageName)
+	if err == docker.ErrNoSuchImage {
+		return recorded, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to inspect %s: %w", imageName, err)
+	}
+	if inspect.Config != nil {
+		for _, label := range []string{baseImageLabel, runtimeImageLabel} {
+			if ref := inspect.Config.Labels[label]; ref != "" {
+				add(ref)
+			}
+		}
+	}
+	return recorded, nil
+}
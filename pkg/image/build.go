@@ -2,6 +2,7 @@ package image
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 
@@ -12,15 +13,34 @@ import (
 	"github.com/replicate/cog/pkg/util/console"
 )
 
+// BuildOptions are the options for building an image that aren't in cog.yaml
+type BuildOptions struct {
+	ProgressOutput string
+	// SSH are SSH agent sockets or keys to forward to the build, as well as the ones in cog.yaml
+	SSH []string
+	// Locked makes the build fail if cog.lock doesn't exist or is out of date
+	Locked bool
+	// IgnoreLock builds from cog.yaml even if there is a cog.lock, e.g. to make a new lock
+	IgnoreLock bool
+	// Reproducible builds from the base image digests recorded in cog.lock or a previous
+	// build of the image, instead of the ones the tags currently refer to
+	Reproducible bool
+	// CacheFrom and CacheTo are where to import and export the build cache. They are buildx
+	// cache specs, or registry or local for the defaults for those types. They replace
+	// build.cache in cog.yaml.
+	CacheFrom []string
+	CacheTo   []string
+}
+
 // Build a Cog model from a config
 //
 // This is separated out from docker.Build(), so that can be as close as possible to the behavior of 'docker build'.
-func Build(cfg *config.Config, dir, imageName string, progressOutput string) error {
+func Build(ctx context.Context, cfg *config.Config, dir, imageName string, options BuildOptions) error {
 	console.Infof("Building Docker image from environment in cog.yaml as %s...", imageName)
 
-	generator, err := dockerfile.NewGenerator(cfg, dir)
+	generator, ssh, pinned, err := prepareGenerator(ctx, cfg, dir, imageName, options)
 	if err != nil {
-		return fmt.Errorf("Error creating Dockerfile generator: %w", err)
+		return err
 	}
 	defer func() {
 		if err := generator.Cleanup(); err != nil {
@@ -32,8 +52,25 @@ func Build(cfg *config.Config, dir, imageName string, progressOutput string) err
 	if err != nil {
 		return fmt.Errorf("Failed to generate Dockerfile: %w", err)
 	}
+	secrets, err := buildSecrets(cfg, dir)
+	if err != nil {
+		return err
+	}
+	cacheFrom, cacheTo, err := options.cache(cfg, dir)
+	if err != nil {
+		return err
+	}
 
-	if err := docker.Build(dir, dockerfileContents, imageName, progressOutput); err != nil {
+	if err := docker.DefaultClient().Build(ctx, docker.BuildOptions{
+		Dir:            dir,
+		Dockerfile:     dockerfileContents,
+		ImageName:      imageName,
+		ProgressOutput: options.ProgressOutput,
+		Secrets:        secrets,
+		SSH:            ssh,
+		CacheFrom:      cacheFrom,
+		CacheTo:        cacheTo,
+	}); err != nil {
 		return fmt.Errorf("Failed to build Docker image: %w", err)
 	}
 
@@ -42,7 +79,8 @@ func Build(cfg *config.Config, dir, imageName string, progressOutput string) err
 	if err != nil {
 		return fmt.Errorf("Failed to get type signature: %w", err)
 	}
-	configJSON, err := json.Marshal(cfg)
+	// The config is redacted so credentials in URLs aren't saved in the image
+	configJSON, err := json.Marshal(cfg.Redacted())
 	if err != nil {
 		return fmt.Errorf("Failed to convert config to JSON: %w", err)
 	}
@@ -52,6 +90,7 @@ func Build(cfg *config.Config, dir, imageName string, progressOutput string) err
 	labels := map[string]string{
 		global.LabelNamespace + "version": global.Version,
 		global.LabelNamespace + "config":  string(bytes.TrimSpace(configJSON)),
+		docker.LabelProjectDir:            dir,
 		// Backwards compatibility. Remove for 1.0.
 		"org.cogmodel.deprecated":  "The org.cogmodel labels are deprecated. Use run.cog.",
 		"org.cogmodel.cog_version": global.Version,
@@ -68,21 +107,34 @@ func Build(cfg *config.Config, dir, imageName string, progressOutput string) err
 		labels["org.cogmodel.openapi_schema"] = string(schemaJSON)
 	}
 
-	if err := docker.BuildAddLabelsToImage(imageName, labels); err != nil {
+	// The base images pinned to digests, so the same ones can be used with --reproducible
+	if pinned.base != "" {
+		labels[baseImageLabel] = pinned.base
+	}
+	if pinned.runtime != "" {
+		labels[runtimeImageLabel] = pinned.runtime
+	}
+
+	if err := docker.DefaultClient().BuildAddLabelsToImage(ctx, imageName, labels); err != nil {
 		return fmt.Errorf("Failed to add labels to image: %w", err)
 	}
 	return nil
 }
 
-func BuildBase(cfg *config.Config, dir string, progressOutput string) (string, error) {
-	// TODO: better image management so we don't eat up disk space
-	// https://github.com/replicate/cog/issues/80
+func BuildBase(ctx context.Context, cfg *config.Config, dir string, options BuildOptions) (string, error) {
+	imageName, _, err := buildBase(ctx, cfg, dir, options)
+	return imageName, err
+}
+
+// buildBase builds the base image, and returns its name and the base images it was built
+// from, pinned to their digests
+func buildBase(ctx context.Context, cfg *config.Config, dir string, options BuildOptions) (string, pinnedImages, error) {
 	imageName := config.BaseDockerImageName(dir)
 
 	console.Info("Building Docker image from environment in cog.yaml...")
-	generator, err := dockerfile.NewGenerator(cfg, dir)
+	generator, ssh, pinned, err := prepareGenerator(ctx, cfg, dir, imageName, options)
 	if err != nil {
-		return "", fmt.Errorf("Error creating Dockerfile generator: %w", err)
+		return "", pinnedImages{}, err
 	}
 	defer func() {
 		if err := generator.Cleanup(); err != nil {
@@ -90,11 +142,141 @@ func BuildBase(cfg *config.Config, dir string, progressOutput string) (string, e
 		}
 	}()
 	dockerfileContents, err := generator.GenerateBase()
+	if err != nil {
+		return "", pinnedImages{}, fmt.Errorf("Failed to generate Dockerfile: %w", err)
+	}
+	secrets, err := buildSecrets(cfg, dir)
+	if err != nil {
+		return "", pinnedImages{}, err
+	}
+	// The build cache isn't used here, only when building the image to push. Otherwise
+	// running a model locally would need credentials to push the cache, and the cache of
+	// the base image would replace the cache of the full image.
+	if err := docker.DefaultClient().Build(ctx, docker.BuildOptions{
+		Dir:            dir,
+		Dockerfile:     dockerfileContents,
+		ImageName:      imageName,
+		ProgressOutput: options.ProgressOutput,
+		Secrets:        secrets,
+		SSH:            ssh,
+		// So `cog images` and `cog prune` can find base images
+		Labels: map[string]string{
+			global.LabelNamespace + "version": global.Version,
+			docker.LabelProjectDir:            dir,
+		},
+	}); err != nil {
+		return "", pinnedImages{}, fmt.Errorf("Failed to build Docker image: %w", err)
+	}
+	return imageName, pinned, nil
+}
+
+// Dockerfile returns the Dockerfile that Build would build imageName with
+func Dockerfile(ctx context.Context, cfg *config.Config, dir, imageName string, options BuildOptions) (string, error) {
+	generator, _, _, err := prepareGenerator(ctx, cfg, dir, imageName, options)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err := generator.Cleanup(); err != nil {
+			console.Warnf("Error cleaning up Dockerfile generator: %s", err)
+		}
+	}()
+	dockerfileContents, err := generator.Generate()
 	if err != nil {
 		return "", fmt.Errorf("Failed to generate Dockerfile: %w", err)
 	}
-	if err := docker.Build(dir, dockerfileContents, imageName, progressOutput); err != nil {
-		return "", fmt.Errorf("Failed to build Docker image: %w", err)
+	return dockerfileContents, nil
+}
+
+// prepareGenerator sets up a Dockerfile generator with everything that affects the build:
+// the SSH agents or keys to forward, cog.lock, and the pinned base images. It returns the
+// generator, the SSH agents or keys, and the pinned base images.
+func prepareGenerator(ctx context.Context, cfg *config.Config, dir, imageName string, options BuildOptions) (*dockerfile.Generator, []string, pinnedImages, error) {
+	ssh, err := options.ssh(cfg)
+	if err != nil {
+		return nil, nil, pinnedImages{}, err
+	}
+	lock, err := loadLock(cfg, dir, options)
+	if err != nil {
+		return nil, nil, pinnedImages{}, err
+	}
+	generator, pinned, err := newGenerator(ctx, cfg, dir, imageName, options, ssh)
+	if err != nil {
+		return nil, nil, pinnedImages{}, err
+	}
+	generator.Lock = lock
+	return generator, ssh, pinned, nil
+}
+
+// ssh returns the SSH agent sockets or keys to forward to the build. Ones passed on the
+// command line replace ones in cog.yaml with the same ID.
+func (o BuildOptions) ssh(cfg *config.Config) ([]string, error) {
+	for _, s := range o.SSH {
+		if err := config.ValidateSSH(s); err != nil {
+			return nil, err
+		}
+	}
+	ssh := []string{}
+	for _, s := range cfg.Build.SSH {
+		if !sshIDIn(config.SSHID(s), o.SSH) {
+			ssh = append(ssh, s)
+		}
+	}
+	return append(ssh, o.SSH...), nil
+}
+
+// cache returns the buildx specs for where to import and export the build cache. Ones
+// passed on the command line replace the ones from build.cache in cog.yaml.
+func (o BuildOptions) cache(cfg *config.Config, dir string) (from []string, to []string, err error) {
+	from, to = []string{}, []string{}
+	if cfg.Build.Cache != nil {
+		cacheFrom, cacheTo, err := cfg.Build.Cache.CacheSpecs(cfg, dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		from, to = []string{cacheFrom}, []string{cacheTo}
+	}
+	if len(o.CacheFrom) > 0 {
+		if from, err = expandCacheSpecs(cfg, dir, o.CacheFrom, false); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(o.CacheTo) > 0 {
+		if to, err = expandCacheSpecs(cfg, dir, o.CacheTo, true); err != nil {
+			return nil, nil, err
+		}
+	}
+	return from, to, nil
+}
+
+// expandCacheSpecs replaces the cache types registry and local with the specs for the
+// default caches of those types. none turns the cache off.
+func expandCacheSpecs(cfg *config.Config, dir string, specs []string, export bool) ([]string, error) {
+	expanded := []string{}
+	for _, spec := range specs {
+		if spec == "none" {
+			continue
+		}
+		if spec == config.CacheTypeRegistry || spec == config.CacheTypeLocal {
+			from, to, err := (&config.BuildCache{Type: spec}).CacheSpecs(cfg, dir)
+			if err != nil {
+				return nil, err
+			}
+			spec = from
+			if export {
+				spec = to
+			}
+		}
+		expanded = append(expanded, spec)
+	}
+	return expanded, nil
+}
+
+func sshIDIn(id string, ssh []string) bool {
+	for _, s := range ssh {
+		if config.SSHID(s) == id {
+			return true
+		}
 	}
-	return imageName, nil
+	return false
 }
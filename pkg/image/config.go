@@ -1,23 +1,30 @@
 package image
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 
 	"github.com/replicate/cog/pkg/config"
-	"github.com/replicate/cog/pkg/docker"
 	"github.com/replicate/cog/pkg/global"
 )
 
-func GetConfig(imageName string) (*config.Config, error) {
-	image, err := docker.ImageInspect(imageName)
+// GetConfig returns the config in the labels of an image. If the image isn't available
+// locally, it is read from its registry, without pulling the image.
+func GetConfig(ctx context.Context, imageName string) (*config.Config, error) {
+	image, _, err := inspectImage(ctx, imageName)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to inspect %s: %w", imageName, err)
+		return nil, err
 	}
-	configString := image.Config.Labels[global.LabelNamespace+"config"]
+	return configFromLabels(imageName, image.Config.Labels)
+}
+
+// configFromLabels returns the config in the labels of an image
+func configFromLabels(imageName string, labels map[string]string) (*config.Config, error) {
+	configString := labels[global.LabelNamespace+"config"]
 	if configString == "" {
 		// Deprecated. Remove for 1.0.
-		configString = image.Config.Labels["org.cogmodel.config"]
+		configString = labels["org.cogmodel.config"]
 	}
 	if configString == "" {
 		return nil, fmt.Errorf("Image %s does not appear to be a Cog model", imageName)
@@ -0,0 +1,75 @@
+package image
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/docker/dockertest"
+)
+
+func TestGetConfig(t *testing.T) {
+	client := dockertest.NewFakeClient()
+	client.Images["cog-test"] = &types.ImageInspect{
+		Config: &container.Config{Labels: map[string]string{
+			"run.cog.config": `{"build": {"gpu": true, "python_version": "3.8"}, "predict": "predict.py:Predictor"}`,
+		}},
+	}
+	client.Images["not-cog"] = &types.ImageInspect{
+		Config: &container.Config{Labels: map[string]string{}},
+	}
+	docker.SetDefaultClient(client)
+	registry := dockertest.NewFakeRegistry()
+	registry.Images["r8.im/user/model"] = &types.ImageInspect{
+		Config: &container.Config{Labels: map[string]string{
+			"run.cog.config": `{"build": {"python_version": "3.9"}}`,
+		}},
+	}
+	docker.SetDefaultRegistry(registry)
+
+	conf, err := GetConfig(context.Background(), "cog-test")
+	require.NoError(t, err)
+	require.True(t, conf.Build.GPU)
+	require.Equal(t, "predict.py:Predictor", conf.Predict)
+
+	_, err = GetConfig(context.Background(), "not-cog")
+	require.ErrorContains(t, err, "does not appear to be a Cog model")
+
+	// Images that haven't been pulled are read from the registry
+	conf, err = GetConfig(context.Background(), "r8.im/user/model")
+	require.NoError(t, err)
+	require.Equal(t, "3.9", conf.Build.PythonVersion)
+	require.Empty(t, client.Pulled)
+
+	_, err = GetConfig(context.Background(), "missing")
+	require.ErrorIs(t, err, docker.ErrNoSuchImage)
+	require.Equal(t, []string{"r8.im/user/model", "missing"}, registry.Inspected)
+}
+
+func TestInspect(t *testing.T) {
+	client := dockertest.NewFakeClient()
+	client.Images["cog-test"] = &types.ImageInspect{
+		ID: "sha256:abc",
+		Config: &container.Config{Labels: map[string]string{
+			"run.cog.version":    "0.5.0",
+			"run.cog.base_image": "python:3.8@sha256:1111",
+			"run.cog.config":     `{"build": {"python_version": "3.8"}}`,
+		}},
+	}
+	docker.SetDefaultClient(client)
+	docker.SetDefaultRegistry(dockertest.NewFakeRegistry())
+
+	model, err := Inspect(context.Background(), "cog-test")
+	require.NoError(t, err)
+	require.Equal(t, "sha256:abc", model.ID)
+	require.False(t, model.Remote)
+	require.Equal(t, "0.5.0", model.CogVersion)
+	require.Equal(t, "python:3.8@sha256:1111", model.BaseImage)
+	require.Equal(t, "3.8", model.Config.Build.PythonVersion)
+	// Models without a predictor don't have a schema
+	require.Nil(t, model.Schema)
+}
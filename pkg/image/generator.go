@@ -0,0 +1,62 @@
+package image
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/dockerfile"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// newGenerator creates a Dockerfile generator for cfg, checking that the runtime supports
+// the options in cog.yaml, and pins the base images to their digests. If cog.yaml sets a
+// base image, it is checked for a compatible version of Python. ssh are the SSH agents or
+// keys forwarded to the build. It returns the pinned base images too.
+func newGenerator(ctx context.Context, cfg *config.Config, dir string, imageName string, options BuildOptions, ssh []string) (*dockerfile.Generator, pinnedImages, error) {
+	generator, err := dockerfile.NewGenerator(cfg, dir)
+	if err != nil {
+		return nil, pinnedImages{}, fmt.Errorf("Error creating Dockerfile generator: %w", err)
+	}
+	fail := func(err error) (*dockerfile.Generator, pinnedImages, error) {
+		if cleanupErr := generator.Cleanup(); cleanupErr != nil {
+			console.Warnf("Error cleaning up Dockerfile generator: %s", cleanupErr)
+		}
+		return nil, pinnedImages{}, err
+	}
+
+	generator.UseCacheMounts = docker.RuntimeCapabilities().CacheMounts
+	for _, s := range ssh {
+		generator.SSHIDs = append(generator.SSHIDs, config.SSHID(s))
+	}
+	if (len(cfg.Build.Secrets) > 0 || len(ssh) > 0) && !generator.UseCacheMounts {
+		// Podman 3 doesn't support RUN --mount, so secrets and SSH agents can't be mounted
+		return fail(fmt.Errorf("%s doesn't support build secrets or SSH forwarding. You might need to upgrade it", docker.CurrentRuntime()))
+	}
+
+	pinned, err := pinBaseImages(ctx, generator, dir, imageName, options)
+	if err != nil {
+		return fail(err)
+	}
+
+	if cfg.Build.BaseImage != "" && !cfg.UsesConda() {
+		baseImage := cfg.Build.BaseImage
+		if ref, ok := generator.PinnedImages[baseImage]; ok {
+			baseImage = ref
+		}
+		version, python3Only, err := baseImagePythonVersion(ctx, baseImage)
+		if err == nil {
+			err = cfg.ValidateBaseImagePython(version)
+		}
+		if err != nil {
+			return fail(err)
+		}
+		if version == "" {
+			console.Infof("%s doesn't have Python, so Cog will install Python %s", cfg.Build.BaseImage, cfg.Build.PythonVersion)
+		}
+		generator.BaseImagePythonVersion = version
+		generator.BaseImagePython3Only = python3Only
+	}
+	return generator, pinned, nil
+}
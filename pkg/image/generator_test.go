@@ -0,0 +1,175 @@
+package image
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/docker/dockertest"
+)
+
+func TestNewGeneratorChecksBaseImagePython(t *testing.T) {
+	client := dockertest.NewFakeClient()
+	client.RunOutputs["with-python@sha256:1111"] = "python\n3.8.13\n"
+	client.RunOutputs["with-python3@sha256:1111"] = "python3\n3.8.10\n"
+	docker.SetDefaultClient(client)
+	registry := dockertest.NewFakeRegistry()
+	for _, image := range []string{"with-python", "with-python3", "without-python"} {
+		registry.Images[image] = &types.ImageInspect{RepoDigests: []string{image + "@sha256:1111"}}
+	}
+	docker.SetDefaultRegistry(registry)
+
+	cfg := config.DefaultConfig()
+	cfg.Build.BaseImage = "with-python"
+	generator, _, err := newGenerator(context.Background(), cfg, t.TempDir(), "test", BuildOptions{}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "3.8.13", generator.BaseImagePythonVersion)
+	require.False(t, generator.BaseImagePython3Only)
+	require.NoError(t, generator.Cleanup())
+
+	cfg.Build.BaseImage = "with-python3"
+	generator, _, err = newGenerator(context.Background(), cfg, t.TempDir(), "test", BuildOptions{}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "3.8.10", generator.BaseImagePythonVersion)
+	require.True(t, generator.BaseImagePython3Only)
+	require.NoError(t, generator.Cleanup())
+
+	cfg.Build.BaseImage = "without-python"
+	generator, _, err = newGenerator(context.Background(), cfg, t.TempDir(), "test", BuildOptions{}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "", generator.BaseImagePythonVersion)
+	require.NoError(t, generator.Cleanup())
+
+	cfg.Build.BaseImage = "with-python"
+	cfg.Build.PythonVersion = "3.9"
+	_, _, err = newGenerator(context.Background(), cfg, t.TempDir(), "test", BuildOptions{}, nil)
+	require.ErrorContains(t, err, "The base image with-python has Python 3.8.13, but python_version in cog.yaml is 3.9")
+}
+
+func TestNewGeneratorPinsBaseImages(t *testing.T) {
+	client := dockertest.NewFakeClient()
+	client.Images["python:3.8"] = &types.ImageInspect{RepoDigests: []string{"python@sha256:0000"}}
+	docker.SetDefaultClient(client)
+	registry := dockertest.NewFakeRegistry()
+	registry.Images["python:3.8"] = &types.ImageInspect{RepoDigests: []string{"python@sha256:1111"}}
+	docker.SetDefaultRegistry(registry)
+
+	// The digest comes from the registry, not the local copy, which might be out of date
+	cfg := config.DefaultConfig()
+	dir := t.TempDir()
+	generator, pinned, err := newGenerator(context.Background(), cfg, dir, "test", BuildOptions{}, nil)
+	require.NoError(t, err)
+	require.Equal(t, pinnedImages{base: "python:3.8@sha256:1111"}, pinned)
+	require.Equal(t, map[string]string{"python:3.8": "python:3.8@sha256:1111"}, generator.PinnedImages)
+	require.Empty(t, client.Pulled)
+	require.NoError(t, generator.Cleanup())
+
+	// Images that aren't in a registry are pinned to the digest of the local copy, if it has one
+	cfg.Build.BaseImage = "my-base-image"
+	client.RunOutputs["my-base-image"] = "python\n3.8.13\n"
+	client.Images["my-base-image"] = &types.ImageInspect{}
+	_, pinned, err = newGenerator(context.Background(), cfg, dir, "test", BuildOptions{}, nil)
+	require.NoError(t, err)
+	require.Equal(t, pinnedImages{}, pinned)
+	cfg.Build.BaseImage = ""
+
+	// Slim builds pin the runtime image too, and it's still the runtime image if the base
+	// image can't be pinned
+	cfg.Build.Slim = true
+	registry.Images["python:3.8-slim"] = &types.ImageInspect{RepoDigests: []string{"python@sha256:4444"}}
+	_, pinned, err = newGenerator(context.Background(), cfg, dir, "test", BuildOptions{}, nil)
+	require.NoError(t, err)
+	require.Equal(t, pinnedImages{base: "python:3.8@sha256:1111", runtime: "python:3.8-slim@sha256:4444"}, pinned)
+	delete(registry.Images, "python:3.8")
+	client.Images["python:3.8"] = &types.ImageInspect{}
+	_, pinned, err = newGenerator(context.Background(), cfg, dir, "test", BuildOptions{}, nil)
+	require.NoError(t, err)
+	require.Equal(t, pinnedImages{runtime: "python:3.8-slim@sha256:4444"}, pinned)
+	require.Equal(t, []string{"python:3.8-slim@sha256:4444"}, pinned.list())
+	cfg.Build.Slim = false
+	registry.Images["python:3.8"] = &types.ImageInspect{RepoDigests: []string{"python@sha256:1111"}}
+
+	// With --reproducible, the digest comes from a previous build of the image...
+	registry.Images["python:3.8"].RepoDigests = []string{"python@sha256:2222"}
+	_, _, err = newGenerator(context.Background(), cfg, dir, "test", BuildOptions{Reproducible: true}, nil)
+	require.ErrorContains(t, err, "There is no recorded digest for python:3.8")
+	client.Images["test"] = &types.ImageInspect{Config: &container.Config{Labels: map[string]string{
+		"run.cog.base_image": "python:3.8@sha256:1111",
+	}}}
+	generator, pinned, err = newGenerator(context.Background(), cfg, dir, "test", BuildOptions{Reproducible: true}, nil)
+	require.NoError(t, err)
+	require.Equal(t, pinnedImages{base: "python:3.8@sha256:1111"}, pinned)
+	require.NoError(t, generator.Cleanup())
+
+	// ...or cog.lock, which takes precedence
+	require.NoError(t, (&config.Lock{BaseImages: []string{"python:3.8@sha256:3333"}}).Write(dir))
+	generator, pinned, err = newGenerator(context.Background(), cfg, dir, "test", BuildOptions{Reproducible: true}, nil)
+	require.NoError(t, err)
+	require.Equal(t, pinnedImages{base: "python:3.8@sha256:3333"}, pinned)
+	require.NoError(t, generator.Cleanup())
+}
+
+func TestBuildOptionsSSH(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Build.SSH = []string{"default", "work=/home/user/.ssh/work"}
+
+	ssh, err := BuildOptions{SSH: []string{"default=/home/user/.ssh/id_ed25519"}}.ssh(cfg)
+	require.NoError(t, err)
+	require.Equal(t, []string{"work=/home/user/.ssh/work", "default=/home/user/.ssh/id_ed25519"}, ssh)
+
+	_, err = BuildOptions{SSH: []string{"not valid=/path"}}.ssh(cfg)
+	require.ErrorContains(t, err, "'not valid=/path' isn't a valid SSH agent or key")
+}
+
+func TestBuildOptionsCache(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Image = "r8.im/user/model"
+	cfg.Build.Cache = &config.BuildCache{Type: config.CacheTypeLocal, Dir: "/tmp/cache"}
+
+	from, to, err := BuildOptions{}.cache(cfg, "/src")
+	require.NoError(t, err)
+	require.Equal(t, []string{"type=local,src=/tmp/cache"}, from)
+	require.Equal(t, []string{"type=local,dest=/tmp/cache,mode=max"}, to)
+
+	// Flags replace build.cache, and registry and local are the default caches of those types
+	from, to, err = BuildOptions{CacheFrom: []string{"registry"}, CacheTo: []string{"type=inline"}}.cache(cfg, "/src")
+	require.NoError(t, err)
+	require.Equal(t, []string{"type=registry,ref=r8.im/user/model:buildcache"}, from)
+	require.Equal(t, []string{"type=inline"}, to)
+
+	from, to, err = BuildOptions{CacheTo: []string{"none"}}.cache(cfg, "/src")
+	require.NoError(t, err)
+	require.Equal(t, []string{"type=local,src=/tmp/cache"}, from)
+	require.Equal(t, []string{}, to)
+}
+
+func TestDockerfile(t *testing.T) {
+	client := dockertest.NewFakeClient()
+	client.RunOutputs["registry.example.com/base@sha256:1111"] = "python3\n3.8.10\n"
+	docker.SetDefaultClient(client)
+	registry := dockertest.NewFakeRegistry()
+	registry.Images["registry.example.com/base"] = &types.ImageInspect{RepoDigests: []string{"registry.example.com/base@sha256:1111"}}
+	docker.SetDefaultRegistry(registry)
+
+	cfg := config.DefaultConfig()
+	cfg.Build.BaseImage = "registry.example.com/base"
+	dir := t.TempDir()
+	hash, err := cfg.BuildHash(dir)
+	require.NoError(t, err)
+	require.NoError(t, (&config.Lock{ConfigHash: hash, PythonPackages: []string{"attrs==22.1.0"}}).Write(dir))
+
+	// It's the Dockerfile the image is built with: pinned, from the lock, and with the
+	// Python the base image has
+	dockerfile, err := Dockerfile(context.Background(), cfg, dir, "test", BuildOptions{SSH: []string{"default"}})
+	require.NoError(t, err)
+	require.Contains(t, dockerfile, "FROM registry.example.com/base@sha256:1111\n")
+	require.Contains(t, dockerfile, `RUN ln -s "$(command -v python3)" /usr/local/bin/python`)
+	require.Contains(t, dockerfile, "-r /tmp/requirements.lock.txt")
+	require.Contains(t, dockerfile, "--mount=type=ssh ")
+	require.NotContains(t, dockerfile, "pyenv")
+}
@@ -0,0 +1,81 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/docker/docker/api/types"
+	"github.com/getkin/kin-openapi/openapi3"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/global"
+)
+
+// Model is what Cog knows about a model image from its labels
+type Model struct {
+	Image string
+	// ID is the image ID, if the image is available locally
+	ID string
+	// Remote is true if the image was read from its registry
+	Remote     bool
+	Created    string
+	CogVersion string
+	// BaseImage and RuntimeImage are the images the model was built from, pinned to digests
+	BaseImage    string
+	RuntimeImage string
+	Config       *config.Config
+	// Schema is nil if the model doesn't have a predictor
+	Schema *openapi3.T
+}
+
+// Inspect reads a model from the labels of an image. If the image isn't available
+// locally, it is read from its registry, without pulling its layers.
+func Inspect(ctx context.Context, imageName string) (*Model, error) {
+	model := &Model{Image: imageName}
+	image, remote, err := inspectImage(ctx, imageName)
+	if err != nil {
+		return nil, err
+	}
+	model.Remote = remote
+	labels := map[string]string{}
+	if image.Config != nil && image.Config.Labels != nil {
+		labels = image.Config.Labels
+	}
+
+	if model.Config, err = configFromLabels(imageName, labels); err != nil {
+		return nil, err
+	}
+	model.ID = image.ID
+	model.Created = image.Created
+	model.CogVersion = labels[global.LabelNamespace+"version"]
+	if model.CogVersion == "" {
+		// Deprecated. Remove for 1.0.
+		model.CogVersion = labels["org.cogmodel.cog_version"]
+	}
+	model.BaseImage = labels[baseImageLabel]
+	model.RuntimeImage = labels[runtimeImageLabel]
+
+	// The schema isn't set if there is no predictor
+	if labels[global.LabelNamespace+"openapi_schema"] != "" || labels["org.cogmodel.openapi_schema"] != "" {
+		if model.Schema, err = schemaFromLabels(imageName, labels); err != nil {
+			return nil, fmt.Errorf("Failed to parse schema from %s: %w", imageName, err)
+		}
+	}
+	return model, nil
+}
+
+// inspectImage inspects an image, or reads its config from its registry if it isn't
+// available locally. remote is true if it was read from the registry.
+func inspectImage(ctx context.Context, imageName string) (image *types.ImageInspect, remote bool, err error) {
+	image, err = docker.DefaultClient().ImageInspect(ctx, imageName)
+	if errors.Is(err, docker.ErrNoSuchImage) {
+		remote = true
+		image, err = docker.RemoteImageInspect(ctx, imageName)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("Failed to inspect %s: %w", imageName, err)
+	}
+	return image, remote, nil
+}
@@ -0,0 +1,226 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/dockerfile"
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// Lock builds the base image from cog.yaml, ignoring any existing lock, and returns the
+// versions of the packages that were installed in it
+func Lock(ctx context.Context, cfg *config.Config, dir string, options BuildOptions) (*config.Lock, error) {
+	options.IgnoreLock = true
+	imageName, pinned, err := buildBase(ctx, cfg, dir, options)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := cfg.BuildHash(dir)
+	if err != nil {
+		return nil, err
+	}
+	lock := &config.Lock{
+		ConfigHash:     hash,
+		PythonPackages: []string{},
+		SystemPackages: []string{},
+		BaseImages:     pinned.list(),
+	}
+
+	console.Info("Resolving Python packages...")
+	freeze, err := runInImage(ctx, imageName, "pip", "freeze")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list Python packages: %w", err)
+	}
+	lock.PythonPackages = parsePipFreeze(freeze)
+
+	if cfg.UsesConda() {
+		console.Info("Resolving conda packages...")
+		packages, err := runInImage(ctx, imageName, "python", "-c", condaExplicitScript)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to list conda packages: %w", err)
+		}
+		lock.CondaPackages = nonEmptyLines(packages)
+	}
+
+	if len(cfg.Build.SystemPackages) > 0 {
+		console.Info("Resolving system packages...")
+		if lock.SystemPackages, err = lockSystemPackages(ctx, cfg, imageName, pinned); err != nil {
+			return nil, fmt.Errorf("Failed to list system packages: %w", err)
+		}
+	}
+
+	return lock, nil
+}
+
+// loadLock returns the lock to build the image with, or nil if the image should be built
+// from cog.yaml without one
+func loadLock(cfg *config.Config, dir string, options BuildOptions) (*config.Lock, error) {
+	if options.IgnoreLock {
+		return nil, nil
+	}
+	lock, err := config.ReadLock(dir)
+	if err != nil {
+		return nil, err
+	}
+	if lock == nil {
+		if options.Locked {
+			return nil, fmt.Errorf("%s does not exist. Run 'cog lock' to create it", global.LockFilename)
+		}
+		return nil, nil
+	}
+	upToDate, err := lock.IsUpToDate(cfg, dir)
+	if err != nil {
+		return nil, err
+	}
+	if !upToDate {
+		if options.Locked {
+			return nil, fmt.Errorf("%s or the files it refers to have changed since %s was made. Run 'cog lock' to update it", global.ConfigFilename, global.LockFilename)
+		}
+		console.Warnf("%s or the files it refers to have changed since %s was made, so it isn't being used. Run 'cog lock' to update it.", global.ConfigFilename, global.LockFilename)
+		return nil, nil
+	}
+	console.Infof("Installing packages from %s", global.LockFilename)
+	return lock, nil
+}
+
+// lockSystemPackages returns the versions of the system packages installed on top of the
+// image the final stage of imageName is built from: the packages in system_packages, the
+// packages they depend on, and any others Cog installed. That image is only known if it
+// was pinned to a digest, so otherwise only the packages in system_packages are locked.
+func lockSystemPackages(ctx context.Context, cfg *config.Config, imageName string, pinned pinnedImages) ([]string, error) {
+	fromImage := pinned.base
+	if cfg.Build.Slim {
+		fromImage = pinned.runtime
+	}
+	if fromImage == "" {
+		console.Warnf("The base image doesn't have a digest, so only the packages in system_packages are locked, not the packages they depend on")
+		args := []string{"dpkg-query", "--show", "--showformat", "${Package}=${Version}\\n"}
+		for _, pkg := range cfg.Build.SystemPackages {
+			// Packages can already have a version, like ffmpeg=7:4.2.7-0ubuntu0.1
+			args = append(args, strings.SplitN(pkg, "=", 2)[0])
+		}
+		packages, err := runInImage(ctx, imageName, args...)
+		if err != nil {
+			return nil, err
+		}
+		return nonEmptyLines(packages), nil
+	}
+
+	installed, err := installedDebianPackages(ctx, imageName)
+	if err != nil {
+		return nil, err
+	}
+	before, err := installedDebianPackages(ctx, fromImage)
+	if err != nil {
+		return nil, err
+	}
+	return addedPackages(before, installed), nil
+}
+
+// installedDebianPackages returns the packages installed in an image, in the form
+// name=version
+func installedDebianPackages(ctx context.Context, imageName string) ([]string, error) {
+	out, err := runInImage(ctx, imageName, "dpkg-query", "--show", "--showformat", "${Status}\\t${Package}=${Version}\\n")
+	if err != nil {
+		return nil, err
+	}
+	return parseDpkgQuery(out), nil
+}
+
+// parseDpkgQuery returns the packages in the output of dpkg-query that are installed,
+// leaving out ones that were removed but still have their config files
+func parseDpkgQuery(out string) []string {
+	packages := []string{}
+	for _, line := range nonEmptyLines(out) {
+		parts := strings.SplitN(line, "\t", 2)
+		if len(parts) == 2 && strings.HasSuffix(parts[0], " installed") {
+			packages = append(packages, parts[1])
+		}
+	}
+	return packages
+}
+
+// addedPackages returns the packages in after that aren't in before, including ones that
+// have a different version, sorted by name
+func addedPackages(before []string, after []string) []string {
+	existing := map[string]bool{}
+	for _, pkg := range before {
+		existing[pkg] = true
+	}
+	added := []string{}
+	for _, pkg := range after {
+		if !existing[pkg] {
+			added = append(added, pkg)
+		}
+	}
+	sort.Strings(added)
+	return added
+}
+
+func runInImage(ctx context.Context, imageName string, args ...string) (string, error) {
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	err := docker.DefaultClient().RunWithIO(ctx, docker.RunOptions{
+		Image:  imageName,
+		Args:   args,
+		Labels: map[string]string{docker.LabelCommand: "lock"},
+	}, nil, &stdout, &stderr)
+	if err != nil {
+		console.Info(stderr.String())
+		return "", err
+	}
+	return stdout.String(), nil
+}
+
+// condaExplicitScript prints the packages in the conda environment as URLs with their
+// MD5s, like `micromamba env export --explicit` does. It reads the environment's metadata
+// with Python, because micromamba isn't copied into the runtime stage of slim images.
+var condaExplicitScript = fmt.Sprintf(`import glob, json
+for path in sorted(glob.glob("%s/conda-meta/*.json")):
+    with open(path) as f:
+        meta = json.load(f)
+    print(meta["url"] + "#" + meta["md5"])
+`, dockerfile.CondaPrefix)
+
+// parsePipFreeze returns the packages in the output of pip freeze, without Cog, which is
+// installed from the wheel embedded in the Cog binary. Packages installed from local
+// files are left out too. pip can't install them from the lock, and in conda environments
+// they are the conda packages, which are locked separately.
+func parsePipFreeze(freeze string) []string {
+	packages := []string{}
+	for _, line := range nonEmptyLines(freeze) {
+		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "-") {
+			continue
+		}
+		if strings.Contains(line, " @ file://") {
+			console.Debugf("Not locking %s, because it was installed from a local file", line)
+			continue
+		}
+		name := strings.FieldsFunc(line, func(r rune) bool {
+			return r == '=' || r == '@' || r == ' '
+		})
+		if len(name) > 0 && strings.EqualFold(name[0], "cog") {
+			continue
+		}
+		packages = append(packages, line)
+	}
+	return packages
+}
+
+func nonEmptyLines(s string) []string {
+	lines := []string{}
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,64 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func TestParsePipFreeze(t *testing.T) {
+	freeze := `attrs==22.1.0
+cog @ file:///tmp/cog-0.0.1.dev-py3-none-any.whl
+-e git+https://github.com/example/editable.git@abc123#egg=editable
+numpy @ file:///home/conda/feedstock_root/build_artifacts/numpy_1653325313343/work
+private-package @ git+ssh://git@github.com/example/private.git@0123456789abcdef
+torch==1.12.1+cu113
+
+`
+	require.Equal(t, []string{
+		"attrs==22.1.0",
+		"private-package @ git+ssh://git@github.com/example/private.git@0123456789abcdef",
+		"torch==1.12.1+cu113",
+	}, parsePipFreeze(freeze))
+}
+
+func TestLockSystemPackages(t *testing.T) {
+	before := parseDpkgQuery("install ok installed\tbash=5.0-6ubuntu1.2\ninstall ok installed\tlibc6=2.31-0ubuntu9.9\ndeinstall ok config-files\told=1.0\n")
+	require.Equal(t, []string{"bash=5.0-6ubuntu1.2", "libc6=2.31-0ubuntu9.9"}, before)
+
+	// The dependencies of system packages are locked too, and so are packages that were
+	// upgraded, but not the ones that came with the base image
+	after := []string{"libc6=2.31-0ubuntu9.12", "bash=5.0-6ubuntu1.2", "ffmpeg=7:4.2.7-0ubuntu0.1", "libavcodec58=7:4.2.7-0ubuntu0.1"}
+	require.Equal(t, []string{"ffmpeg=7:4.2.7-0ubuntu0.1", "libavcodec58=7:4.2.7-0ubuntu0.1", "libc6=2.31-0ubuntu9.12"}, addedPackages(before, after))
+}
+
+func TestLoadLock(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig()
+
+	lock, err := loadLock(cfg, dir, BuildOptions{})
+	require.NoError(t, err)
+	require.Nil(t, lock)
+	_, err = loadLock(cfg, dir, BuildOptions{Locked: true})
+	require.ErrorContains(t, err, "cog.lock does not exist")
+
+	hash, err := cfg.BuildHash(dir)
+	require.NoError(t, err)
+	require.NoError(t, (&config.Lock{ConfigHash: hash, PythonPackages: []string{"attrs==22.1.0"}}).Write(dir))
+
+	lock, err = loadLock(cfg, dir, BuildOptions{Locked: true})
+	require.NoError(t, err)
+	require.Equal(t, []string{"attrs==22.1.0"}, lock.PythonPackages)
+	lock, err = loadLock(cfg, dir, BuildOptions{IgnoreLock: true})
+	require.NoError(t, err)
+	require.Nil(t, lock)
+
+	cfg.Build.SystemPackages = []string{"ffmpeg"}
+	lock, err = loadLock(cfg, dir, BuildOptions{})
+	require.NoError(t, err)
+	require.Nil(t, lock)
+	_, err = loadLock(cfg, dir, BuildOptions{Locked: true})
+	require.ErrorContains(t, err, "cog.yaml or the files it refers to have changed since cog.lock was made")
+}
@@ -2,6 +2,7 @@ package image
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 
@@ -28,7 +29,8 @@ func GenerateOpenAPISchema(imageName string, enableGPU bool) (*interface{}, erro
 		Args: []string{
 			"python", "-m", "cog.command.openapi_schema",
 		},
-		GPUs: gpus,
+		GPUs:   gpus,
+		Labels: map[string]string{docker.LabelCommand: "build"},
 	}, nil, &stdout, &stderr)
 
 	if enableGPU && err == docker.ErrMissingDeviceDriver {
@@ -54,15 +56,22 @@ func GenerateOpenAPISchema(imageName string, enableGPU bool) (*interface{}, erro
 	return schema, nil
 }
 
-func GetOpenAPISchema(imageName string) (*openapi3.T, error) {
-	image, err := docker.ImageInspect(imageName)
+// GetOpenAPISchema returns the schema in the labels of an image. Like GetConfig, it reads
+// the image from its registry if it isn't available locally.
+func GetOpenAPISchema(ctx context.Context, imageName string) (*openapi3.T, error) {
+	image, _, err := inspectImage(ctx, imageName)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to inspect %s: %w", imageName, err)
+		return nil, err
 	}
-	schemaString := image.Config.Labels[global.LabelNamespace+"openapi_schema"]
+	return schemaFromLabels(imageName, image.Config.Labels)
+}
+
+// schemaFromLabels returns the OpenAPI schema in the labels of an image
+func schemaFromLabels(imageName string, labels map[string]string) (*openapi3.T, error) {
+	schemaString := labels[global.LabelNamespace+"openapi_schema"]
 	if schemaString == "" {
 		// Deprecated. Remove for 1.0.
-		schemaString = image.Config.Labels["org.cogmodel.openapi_schema"]
+		schemaString = labels["org.cogmodel.openapi_schema"]
 	}
 	if schemaString == "" {
 		return nil, fmt.Errorf("Image %s does not appear to be a Cog model", imageName)
@@ -0,0 +1,44 @@
+package image
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/mitchellh/go-homedir"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/util/files"
+)
+
+// buildSecrets returns the secrets in cog.yaml in the form passed to `docker build --secret`.
+// Files are relative to the project directory.
+func buildSecrets(cfg *config.Config, dir string) ([]string, error) {
+	secrets := []string{}
+	for _, secret := range cfg.Build.Secrets {
+		if secret.Env != "" {
+			if _, ok := os.LookupEnv(secret.Env); !ok {
+				return nil, fmt.Errorf("The environment variable %s for the secret %s is not set", secret.Env, secret.ID)
+			}
+			secrets = append(secrets, fmt.Sprintf("id=%s,env=%s", secret.ID, secret.Env))
+			continue
+		}
+
+		src, err := homedir.Expand(secret.Src)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to expand path %s for the secret %s: %w", secret.Src, secret.ID, err)
+		}
+		if !filepath.IsAbs(src) {
+			src = filepath.Join(dir, src)
+		}
+		exists, err := files.Exists(src)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, fmt.Errorf("The file %s for the secret %s does not exist", secret.Src, secret.ID)
+		}
+		secrets = append(secrets, fmt.Sprintf("id=%s,src=%s", secret.ID, src))
+	}
+	return secrets, nil
+}
@@ -0,0 +1,37 @@
+package image
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func TestBuildSecrets(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "token.txt"), []byte("s3cret"), 0o600))
+	t.Setenv("COG_TEST_TOKEN", "s3cret")
+
+	cfg := config.DefaultConfig()
+	cfg.Build.Secrets = []config.Secret{
+		{ID: "file", Src: "token.txt"},
+		{ID: "env", Env: "COG_TEST_TOKEN"},
+	}
+	secrets, err := buildSecrets(cfg, dir)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"id=file,src=" + filepath.Join(dir, "token.txt"),
+		"id=env,env=COG_TEST_TOKEN",
+	}, secrets)
+
+	cfg.Build.Secrets = []config.Secret{{ID: "missing", Src: "missing.txt"}}
+	_, err = buildSecrets(cfg, dir)
+	require.ErrorContains(t, err, "The file missing.txt for the secret missing does not exist")
+
+	cfg.Build.Secrets = []config.Secret{{ID: "unset", Env: "COG_TEST_UNSET"}}
+	_, err = buildSecrets(cfg, dir)
+	require.ErrorContains(t, err, "The environment variable COG_TEST_UNSET for the secret unset is not set")
+}
@@ -0,0 +1,110 @@
+package predict
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ReadBatchFile reads rows of inputs from a JSONL or CSV file, depending on its extension.
+//
+// Each line of a JSONL file is an object that maps input names to values. CSV files have a
+// header row of input names. Values prefixed with @ are files, relative to the batch file.
+// Each row is parsed against fields, the inputs in the model's schema, like `cog predict -i`.
+func ReadBatchFile(path string, fields []*InputField) ([]Inputs, error) {
+	var readRows func(io.Reader) ([]map[string]string, error)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jsonl", ".ndjson":
+		readRows = readJSONLRows
+	case ".csv":
+		readRows = readCSVRows
+	default:
+		return nil, fmt.Errorf("Batch file %s must be a .jsonl or .csv file", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open batch file: %w", err)
+	}
+	defer f.Close()
+
+	rows, err := readRows(f)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %s: %w", path, err)
+	}
+
+	baseDir := filepath.Dir(path)
+	inputs := []Inputs{}
+	for i, row := range rows {
+		values := map[string][]string{}
+		for name, value := range row {
+			values[name] = []string{value}
+		}
+		rowInputs, err := ParseInputsWithBaseDir(fields, values, baseDir)
+		if err != nil {
+			return nil, fmt.Errorf("Row %d of %s has invalid inputs:\n%w", i, path, err)
+		}
+		inputs = append(inputs, rowInputs)
+	}
+	return inputs, nil
+}
+
+func readJSONLRows(r io.Reader) ([]map[string]string, error) {
+	rows := []map[string]string{}
+	scanner := bufio.NewScanner(r)
+	// Allow long lines, e.g. for long text prompts
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		obj := map[string]json.RawMessage{}
+		if err := json.Unmarshal(line, &obj); err != nil {
+			return nil, fmt.Errorf("line %d is not a JSON object: %w", lineNum, err)
+		}
+		row := map[string]string{}
+		for key, raw := range obj {
+			// Strings are passed as-is, anything else as its JSON representation
+			var s string
+			if err := json.Unmarshal(raw, &s); err == nil {
+				row[key] = s
+			} else {
+				row[key] = string(raw)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
+
+func readCSVRows(r io.Reader) ([]map[string]string, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("CSV file must have a header row of input names")
+	}
+	header := records[0]
+	rows := []map[string]string{}
+	for _, record := range records[1:] {
+		row := map[string]string{}
+		for i, name := range header {
+			// Empty cells use the input's default
+			if record[i] != "" {
+				row[name] = record[i]
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
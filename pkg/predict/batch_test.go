@@ -0,0 +1,73 @@
+package predict
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadBatchFileJSONL(t *testing.T) {
+	fields, err := InputFields(loadTestSchema(t))
+	require.NoError(t, err)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "inputs.jsonl")
+	err = os.WriteFile(path, []byte(`{"image": "@images/1.jpg", "scale": 2.5}
+{"image": "@/abs/2.jpg", "mode": "best", "seeds": [1, 2]}
+
+`), 0o644)
+	require.NoError(t, err)
+
+	inputs, err := ReadBatchFile(path, fields)
+	require.NoError(t, err)
+	require.Len(t, inputs, 2)
+
+	require.Equal(t, filepath.Join(dir, "images/1.jpg"), *inputs[0]["image"].File)
+	require.Equal(t, 2.5, *inputs[0]["scale"].Value)
+	require.Equal(t, "/abs/2.jpg", *inputs[1]["image"].File)
+	require.Equal(t, "best", *inputs[1]["mode"].String)
+	seeds, err := inputs[1]["seeds"].toJSON()
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{int64(1), int64(2)}, seeds)
+}
+
+func TestReadBatchFileCSV(t *testing.T) {
+	fields, err := InputFields(loadTestSchema(t))
+	require.NoError(t, err)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "inputs.csv")
+	err = os.WriteFile(path, []byte(`image,scale
+@1.jpg,2
+@2.jpg,
+`), 0o644)
+	require.NoError(t, err)
+
+	inputs, err := ReadBatchFile(path, fields)
+	require.NoError(t, err)
+	require.Len(t, inputs, 2)
+	require.Equal(t, filepath.Join(dir, "1.jpg"), *inputs[0]["image"].File)
+	require.Equal(t, 2.0, *inputs[0]["scale"].Value)
+	require.NotContains(t, inputs[1], "scale")
+}
+
+func TestReadBatchFileInvalid(t *testing.T) {
+	fields, err := InputFields(loadTestSchema(t))
+	require.NoError(t, err)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "inputs.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte("{}\n[1, 2]\n"), 0o644))
+	_, err = ReadBatchFile(path, fields)
+	require.ErrorContains(t, err, "line 2 is not a JSON object")
+
+	_, err = ReadBatchFile(filepath.Join(dir, "inputs.txt"), fields)
+	require.ErrorContains(t, err, "must be a .jsonl or .csv file")
+
+	// Rows are checked against the schema
+	require.NoError(t, os.WriteFile(path, []byte(`{"image": "@1.jpg"}
+{"image": "@2.jpg", "scale": "big"}
+`), 0o644))
+	_, err = ReadBatchFile(path, fields)
+	require.ErrorContains(t, err, `Row 1 of `+path+` has invalid inputs:
+- scale: Expected a number, but got "big"`)
+}
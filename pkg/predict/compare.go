@@ -0,0 +1,144 @@
+package predict
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/vincent-petithory/dataurl"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+// CheckExampleOutput returns an error describing how output differs from the output an
+// example expects. Files the example refers to with @ are relative to baseDir.
+//
+// Output files are compared by their SHA-256 hash, numbers are compared within the
+// example's tolerance, and everything else has to be exactly the same.
+func CheckExampleOutput(example *config.Example, output interface{}, baseDir string) error {
+	expected := example.Output
+	switch {
+	case expected == "":
+		return nil
+
+	case strings.HasPrefix(expected, "@"):
+		path := expected[1:]
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("Failed to read expected output: %w", err)
+		}
+		return checkOutputFileHash(output, sha256Hex(contents), expected[1:])
+
+	case strings.HasPrefix(expected, "sha256:"):
+		return checkOutputFileHash(output, strings.TrimPrefix(expected, "sha256:"), expected)
+	}
+
+	if s, ok := output.(string); ok {
+		if s != expected {
+			return fmt.Errorf("Expected output %q, but got %q", expected, s)
+		}
+		return nil
+	}
+	var expectedValue interface{}
+	if err := json.Unmarshal([]byte(expected), &expectedValue); err != nil {
+		return fmt.Errorf("Expected output %q, but got %s", expected, formatValue(output))
+	}
+	return compareValues(expectedValue, output, example.Tolerance, "output")
+}
+
+// checkOutputFileHash checks output is a file, as a data URL, with the SHA-256 hash
+// expectedHash. expectedName is how the expected output is described in errors.
+func checkOutputFileHash(output interface{}, expectedHash string, expectedName string) error {
+	s, ok := output.(string)
+	if !ok {
+		return fmt.Errorf("Expected a file like %s, but got %s", expectedName, formatValue(output))
+	}
+	file, err := dataurl.DecodeString(s)
+	if err != nil {
+		return fmt.Errorf("Expected a file like %s, but got %q", expectedName, s)
+	}
+	if hash := sha256Hex(file.Data); hash != strings.ToLower(expectedHash) {
+		return fmt.Errorf("Expected a file with SHA-256 hash %s, like %s, but got one with hash %s", expectedHash, expectedName, hash)
+	}
+	return nil
+}
+
+// compareValues compares values decoded from JSON. Numbers are equal if they are within
+// tolerance of each other. path is where the values are in the output, for errors.
+func compareValues(expected interface{}, actual interface{}, tolerance float64, path string) error {
+	switch expected := expected.(type) {
+	case float64:
+		if actual, ok := actual.(float64); ok {
+			if math.Abs(expected-actual) > tolerance {
+				if tolerance > 0 {
+					return fmt.Errorf("Expected %s to be %v ± %v, but got %v", path, expected, tolerance, actual)
+				}
+				return fmt.Errorf("Expected %s to be %v, but got %v", path, expected, actual)
+			}
+			return nil
+		}
+
+	case []interface{}:
+		if actual, ok := actual.([]interface{}); ok {
+			if len(expected) != len(actual) {
+				return fmt.Errorf("Expected %s to have %d items, but it has %d", path, len(expected), len(actual))
+			}
+			for i := range expected {
+				if err := compareValues(expected[i], actual[i], tolerance, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+	case map[string]interface{}:
+		if actual, ok := actual.(map[string]interface{}); ok {
+			if !reflect.DeepEqual(sortedKeys(expected), sortedKeys(actual)) {
+				return fmt.Errorf("Expected %s to have the keys %s, but it has %s", path, strings.Join(sortedKeys(expected), ", "), strings.Join(sortedKeys(actual), ", "))
+			}
+			for _, key := range sortedKeys(expected) {
+				if err := compareValues(expected[key], actual[key], tolerance, path+"."+key); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		return fmt.Errorf("Expected %s to be %s, but got %s", path, formatValue(expected), formatValue(actual))
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatValue(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,43 @@
+package predict
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vincent-petithory/dataurl"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func TestCheckExampleOutputExact(t *testing.T) {
+	require.NoError(t, CheckExampleOutput(&config.Example{}, "anything", ""))
+	require.NoError(t, CheckExampleOutput(&config.Example{Output: "hello"}, "hello", ""))
+	require.EqualError(t, CheckExampleOutput(&config.Example{Output: "hello"}, "goodbye", ""), `Expected output "hello", but got "goodbye"`)
+
+	example := &config.Example{Output: `{"label": "cat", "scores": [1, 2]}`}
+	require.NoError(t, CheckExampleOutput(example, map[string]interface{}{"label": "cat", "scores": []interface{}{1.0, 2.0}}, ""))
+	require.EqualError(t, CheckExampleOutput(example, map[string]interface{}{"label": "dog", "scores": []interface{}{1.0, 2.0}}, ""), `Expected output.label to be "cat", but got "dog"`)
+	require.EqualError(t, CheckExampleOutput(example, map[string]interface{}{"label": "cat"}, ""), "Expected output to have the keys label, scores, but it has label")
+}
+
+func TestCheckExampleOutputTolerance(t *testing.T) {
+	example := &config.Example{Output: "[0.5, 0.25]", Tolerance: 0.01}
+	require.NoError(t, CheckExampleOutput(example, []interface{}{0.501, 0.245}, ""))
+	require.EqualError(t, CheckExampleOutput(example, []interface{}{0.5, 0.3}, ""), "Expected output[1] to be 0.25 ± 0.01, but got 0.3")
+	require.EqualError(t, CheckExampleOutput(&config.Example{Output: "42"}, 42.5, ""), "Expected output to be 42, but got 42.5")
+}
+
+func TestCheckExampleOutputFile(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "expected.txt"), []byte("hello"), 0o644))
+	output := dataurl.New([]byte("hello"), "text/plain").String()
+
+	require.NoError(t, CheckExampleOutput(&config.Example{Output: "@expected.txt"}, output, dir))
+	require.NoError(t, CheckExampleOutput(&config.Example{Output: "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"}, output, dir))
+
+	err := CheckExampleOutput(&config.Example{Output: "@expected.txt"}, dataurl.New([]byte("goodbye"), "text/plain").String(), dir)
+	require.ErrorContains(t, err, "Expected a file with SHA-256 hash 2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824, like expected.txt, but got one with hash")
+	require.EqualError(t, CheckExampleOutput(&config.Example{Output: "@expected.txt"}, 1.0, dir), "Expected a file like expected.txt, but got 1")
+}
@@ -14,6 +14,10 @@ import (
 type Input struct {
 	String *string
 	File   *string
+	// Value is any other JSON value, like a number, boolean or object
+	Value *interface{}
+	// Array is a list of inputs, like several files
+	Array *[]Input
 }
 
 type Inputs map[string]Input
@@ -23,16 +27,7 @@ func NewInputs(keyVals map[string]string) Inputs {
 	for key, val := range keyVals {
 		val := val
 		if strings.HasPrefix(val, "@") {
-			val = val[1:]
-			expandedVal, err := homedir.Expand(val)
-			if err != nil {
-				// FIXME: handle this better?
-				console.Warnf("Error expanding homedir: %s", err)
-			} else {
-				val = expandedVal
-			}
-
-			input[key] = Input{File: &val}
+			input[key] = fileInput(val[1:])
 		} else {
 			input[key] = Input{String: &val}
 		}
@@ -45,7 +40,10 @@ func NewInputsWithBaseDir(keyVals map[string]string, baseDir string) Inputs {
 	for key, val := range keyVals {
 		val := val
 		if strings.HasPrefix(val, "@") {
-			val = filepath.Join(baseDir, val[1:])
+			val = val[1:]
+			if !filepath.IsAbs(val) {
+				val = filepath.Join(baseDir, val)
+			}
 			input[key] = Input{File: &val}
 		} else {
 			input[key] = Input{String: &val}
@@ -54,19 +52,54 @@ func NewInputsWithBaseDir(keyVals map[string]string, baseDir string) Inputs {
 	return input
 }
 
-func (inputs *Inputs) toMap() (map[string]string, error) {
-	keyVals := map[string]string{}
+// fileInput returns an input for a file on disk. ~ is expanded to the home directory.
+func fileInput(path string) Input {
+	expandedPath, err := homedir.Expand(path)
+	if err != nil {
+		// FIXME: handle this better?
+		console.Warnf("Error expanding homedir: %s", err)
+	} else {
+		path = expandedPath
+	}
+	return Input{File: &path}
+}
+
+func (inputs *Inputs) toMap() (map[string]interface{}, error) {
+	keyVals := map[string]interface{}{}
 	for key, input := range *inputs {
-		if input.String != nil {
-			keyVals[key] = *input.String
-		} else if input.File != nil {
-			content, err := ioutil.ReadFile(*input.File)
+		val, err := input.toJSON()
+		if err != nil {
+			return keyVals, err
+		}
+		keyVals[key] = val
+	}
+	return keyVals, nil
+}
+
+// toJSON returns the value to send to the model. Files are sent as data URLs.
+func (input Input) toJSON() (interface{}, error) {
+	switch {
+	case input.String != nil:
+		return *input.String, nil
+	case input.File != nil:
+		content, err := ioutil.ReadFile(*input.File)
+		if err != nil {
+			return nil, err
+		}
+		mimeType := mime.TypeByExtension(filepath.Ext(*input.File))
+		return dataurl.New(content, mimeType).String(), nil
+	case input.Value != nil:
+		return *input.Value, nil
+	case input.Array != nil:
+		vals := []interface{}{}
+		for _, item := range *input.Array {
+			val, err := item.toJSON()
 			if err != nil {
-				return keyVals, err
+				return nil, err
 			}
-			mimeType := mime.TypeByExtension(filepath.Ext(*input.File))
-			keyVals[key] = dataurl.New(content, mimeType).String()
+			vals = append(vals, val)
 		}
+		return vals, nil
 	}
-	return keyVals, nil
+	return nil, nil
 }
@@ -0,0 +1,228 @@
+package predict
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParseInputs converts the values passed for each input, like with `cog predict -i`, to
+// the types of the inputs in the model's schema. Values are checked against the schema,
+// so mistakes are reported before the prediction is sent. An input can be passed more
+// than once if it's an array.
+func ParseInputs(fields []*InputField, values map[string][]string) (Inputs, error) {
+	inputs, errorMessages := parseInputs(fields, values, "")
+	if len(errorMessages) > 0 {
+		return nil, inputValidationError(errorMessages)
+	}
+	return inputs, nil
+}
+
+// ParseInputsWithBaseDir is like ParseInputs, for inputs that aren't passed on the command
+// line, like the rows of a batch file. Files are relative to baseDir, and the error only
+// lists the problems with the inputs.
+func ParseInputsWithBaseDir(fields []*InputField, values map[string][]string, baseDir string) (Inputs, error) {
+	inputs, errorMessages := parseInputs(fields, values, baseDir)
+	if len(errorMessages) > 0 {
+		return nil, fmt.Errorf("%s", strings.Join(errorMessages, "\n"))
+	}
+	return inputs, nil
+}
+
+// parseInputs parses values for fields, returning the inputs and a message for each
+// problem with them
+func parseInputs(fields []*InputField, values map[string][]string, baseDir string) (Inputs, []string) {
+	inputs := Inputs{}
+	errorMessages := []string{}
+	known := map[string]bool{}
+	for _, field := range fields {
+		known[field.Name] = true
+		vals, ok := values[field.Name]
+		if !ok {
+			if field.Required {
+				errorMessages = append(errorMessages, fmt.Sprintf("- %s: This input is required", field.Name))
+			}
+			continue
+		}
+		input, err := field.parse(vals, baseDir)
+		if err != nil {
+			errorMessages = append(errorMessages, fmt.Sprintf("- %s: %s", field.Name, err))
+			continue
+		}
+		inputs[field.Name] = input
+	}
+
+	unknown := []string{}
+	for name := range values {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		names := []string{}
+		for _, field := range fields {
+			names = append(names, field.Name)
+		}
+		errorMessages = append(errorMessages, fmt.Sprintf("- %s: The model doesn't have this input. Its inputs are: %s", name, strings.Join(names, ", ")))
+	}
+	return inputs, errorMessages
+}
+
+// Parse converts the values passed for an input to its type. There must only be one
+// value, unless the input is an array. Arrays can also be passed as a JSON list.
+func (f *InputField) Parse(values []string) (Input, error) {
+	return f.parse(values, "")
+}
+
+// parse is Parse with files relative to baseDir, or the working directory if it's empty
+func (f *InputField) parse(values []string, baseDir string) (Input, error) {
+	if f.Type == "array" {
+		if len(values) == 1 && strings.HasPrefix(strings.TrimSpace(values[0]), "[") {
+			var items []interface{}
+			if err := json.Unmarshal([]byte(values[0]), &items); err != nil {
+				return Input{}, fmt.Errorf("%q isn't a valid JSON list: %s", values[0], err)
+			}
+			values = []string{}
+			for _, item := range items {
+				values = append(values, FormatInputValue(item))
+			}
+		}
+		itemField := f.Items
+		if itemField == nil {
+			itemField = &InputField{}
+		}
+		array := []Input{}
+		for _, value := range values {
+			item, err := itemField.parseValue(value, baseDir)
+			if err != nil {
+				return Input{}, err
+			}
+			array = append(array, item)
+		}
+		return Input{Array: &array}, nil
+	}
+
+	if len(values) != 1 {
+		return Input{}, fmt.Errorf("This input can only be passed once, but got %d values", len(values))
+	}
+	return f.parseValue(values[0], baseDir)
+}
+
+func (f *InputField) parseValue(s string, baseDir string) (Input, error) {
+	var value interface{}
+	switch f.Type {
+	case "string":
+		if f.Format == "uri" {
+			if strings.HasPrefix(s, "@") {
+				return fileInputIn(baseDir, s[1:]), nil
+			}
+			if !isURL(s) {
+				return Input{}, fmt.Errorf("This input is a file, so pass a path prefixed with @, like @%s, or a URL", s)
+			}
+		}
+		value = s
+
+	case "integer":
+		i, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			return Input{}, fmt.Errorf("Expected an integer, but got %q", s)
+		}
+		if err := f.checkRange(float64(i)); err != nil {
+			return Input{}, err
+		}
+		value = i
+
+	case "number":
+		n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return Input{}, fmt.Errorf("Expected a number, but got %q", s)
+		}
+		if err := f.checkRange(n); err != nil {
+			return Input{}, err
+		}
+		value = n
+
+	case "boolean":
+		b, err := strconv.ParseBool(strings.TrimSpace(s))
+		if err != nil {
+			return Input{}, fmt.Errorf("Expected true or false, but got %q", s)
+		}
+		value = b
+
+	case "object", "array":
+		if err := json.Unmarshal([]byte(s), &value); err != nil {
+			return Input{}, fmt.Errorf("Expected a JSON %s, but got %q", f.Type, s)
+		}
+
+	default:
+		// Without a type, it's up to the model what to do with it
+		if strings.HasPrefix(s, "@") {
+			return fileInputIn(baseDir, s[1:]), nil
+		}
+		value = s
+	}
+
+	if err := f.checkChoices(value); err != nil {
+		return Input{}, err
+	}
+	if s, ok := value.(string); ok {
+		return Input{String: &s}, nil
+	}
+	return Input{Value: &value}, nil
+}
+
+// fileInputIn returns an input for a file, which is relative to baseDir if it isn't empty
+func fileInputIn(baseDir string, path string) Input {
+	if baseDir != "" && !filepath.IsAbs(path) && !strings.HasPrefix(path, "~") {
+		path = filepath.Join(baseDir, path)
+	}
+	return fileInput(path)
+}
+
+func (f *InputField) checkRange(n float64) error {
+	switch {
+	case f.Minimum != nil && f.Maximum != nil && (n < *f.Minimum || n > *f.Maximum):
+		return fmt.Errorf("Must be between %v and %v, but got %v", *f.Minimum, *f.Maximum, n)
+	case f.Minimum != nil && n < *f.Minimum:
+		return fmt.Errorf("Must be at least %v, but got %v", *f.Minimum, n)
+	case f.Maximum != nil && n > *f.Maximum:
+		return fmt.Errorf("Must be at most %v, but got %v", *f.Maximum, n)
+	}
+	return nil
+}
+
+func (f *InputField) checkChoices(value interface{}) error {
+	if len(f.Choices) == 0 {
+		return nil
+	}
+	// Numbers in the schema are decoded as float64
+	compare := value
+	if i, ok := value.(int64); ok {
+		compare = float64(i)
+	}
+	choices := []string{}
+	for _, choice := range f.Choices {
+		if choice == compare {
+			return nil
+		}
+		choices = append(choices, FormatInputValue(choice))
+	}
+	return fmt.Errorf("Must be one of: %s, but got %s", strings.Join(choices, ", "), FormatInputValue(value))
+}
+
+// FormatInputValue formats a value as it would be passed to `cog predict -i`. Strings
+// are passed as they are, and everything else as JSON.
+func FormatInputValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return formatValue(v)
+}
+
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://") || strings.HasPrefix(s, "data:")
+}
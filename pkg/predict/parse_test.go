@@ -0,0 +1,96 @@
+package predict
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vincent-petithory/dataurl"
+)
+
+func TestParseInputs(t *testing.T) {
+	fields, err := InputFields(loadTestSchema(t))
+	require.NoError(t, err)
+
+	inputs, err := ParseInputs(fields, map[string][]string{
+		"image": {"@input.jpg"},
+		"scale": {"2.5"},
+		"mode":  {"best"},
+		"seeds": {"1", "2"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "input.jpg", *inputs["image"].File)
+	require.Equal(t, 2.5, *inputs["scale"].Value)
+	require.Equal(t, "best", *inputs["mode"].String)
+	seeds, err := inputs["seeds"].toJSON()
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{int64(1), int64(2)}, seeds)
+
+	// Lists can be passed as JSON too
+	inputs, err = ParseInputs(fields, map[string][]string{"image": {"https://example.com/input.jpg"}, "seeds": {"[3, 4]"}})
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com/input.jpg", *inputs["image"].String)
+	seeds, err = inputs["seeds"].toJSON()
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{int64(3), int64(4)}, seeds)
+
+	// All the problems are reported at once
+	_, err = ParseInputs(fields, map[string][]string{
+		"scale": {"5"},
+		"mode":  {"slow"},
+		"seeds": {"one"},
+		"size":  {"10"},
+	})
+	require.ErrorContains(t, err, `- image: This input is required
+- scale: Must be between 1 and 4, but got 5
+- mode: Must be one of: fast, best, but got slow
+- seeds: Expected an integer, but got "one"
+- size: The model doesn't have this input. Its inputs are: image, scale, mode, seeds`)
+}
+
+func TestInputFieldParse(t *testing.T) {
+	boolean := &InputField{Type: "boolean"}
+	input, err := boolean.Parse([]string{"true"})
+	require.NoError(t, err)
+	require.Equal(t, true, *input.Value)
+	_, err = boolean.Parse([]string{"true", "false"})
+	require.ErrorContains(t, err, "This input can only be passed once, but got 2 values")
+
+	object := &InputField{Type: "object"}
+	input, err = object.Parse([]string{`{"a": 1}`})
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"a": 1.0}, *input.Value)
+	_, err = object.Parse([]string{"a=1"})
+	require.ErrorContains(t, err, `Expected a JSON object, but got "a=1"`)
+
+	file := &InputField{Type: "string", Format: "uri"}
+	_, err = file.Parse([]string{"input.jpg"})
+	require.ErrorContains(t, err, "This input is a file, so pass a path prefixed with @, like @input.jpg, or a URL")
+
+	integer := &InputField{Type: "integer", Choices: []interface{}{1.0, 2.0}}
+	input, err = integer.Parse([]string{"2"})
+	require.NoError(t, err)
+	require.Equal(t, int64(2), *input.Value)
+	_, err = integer.Parse([]string{"3"})
+	require.ErrorContains(t, err, "Must be one of: 1, 2, but got 3")
+}
+
+func TestInputsToMap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input.png")
+	require.NoError(t, os.WriteFile(path, []byte("hello"), 0o644))
+	var number interface{} = 1.5
+	files := []Input{{File: &path}}
+	inputs := Inputs{
+		"number": {Value: &number},
+		"files":  {Array: &files},
+	}
+	m, err := inputs.toMap()
+	require.NoError(t, err)
+	require.Equal(t, 1.5, m["number"])
+	// Files are sent as data URLs
+	require.Len(t, m["files"], 1)
+	file, err := dataurl.DecodeString(m["files"].([]interface{})[0].(string))
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(file.Data))
+}
@@ -2,12 +2,15 @@ package predict
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"math/rand"
+	"net"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/getkin/kin-openapi/openapi3"
@@ -20,8 +23,7 @@ import (
 type status string
 
 type Request struct {
-	// TODO: could this be Inputs?
-	Input map[string]string `json:"input"`
+	Input map[string]interface{} `json:"input"`
 }
 
 type Response struct {
@@ -38,8 +40,18 @@ type ValidationErrorResponse struct {
 	} `json:"detail"`
 }
 
+// PredictionResult is the result of one of the predictions made by PredictAll
+type PredictionResult struct {
+	// Index is the index of the inputs the prediction was made with
+	Index    int
+	Response *Response
+	Err      error
+	Duration time.Duration
+}
+
 type Predictor struct {
 	runOptions docker.RunOptions
+	httpClient *http.Client
 
 	// Running state
 	containerID string
@@ -52,15 +64,41 @@ func NewPredictor(runOptions docker.RunOptions) Predictor {
 	} else {
 		runOptions.Env = append(runOptions.Env, "COG_LOG_LEVEL=warning")
 	}
-	return Predictor{runOptions: runOptions}
+	return Predictor{runOptions: runOptions, httpClient: newHTTPClient()}
 }
 
-func (p *Predictor) Start(logsWriter io.Writer) error {
-	var err error
-	p.port, err = shell.NextFreePort(5000 + rand.Intn(1000))
+// newHTTPClient returns a client that keeps connections to the model alive between
+// predictions. There is no overall timeout because predictions can take a long time, so
+// requests should be cancelled with their context.
+func newHTTPClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{
+				Timeout:   10 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			MaxIdleConns:        100,
+			MaxIdleConnsPerHost: 100,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
+
+// Start runs the model's HTTP server on a random free port and waits for it to be ready.
+// If ctx is cancelled while waiting, the container is left running so it can be stopped
+// with Stop.
+func (p *Predictor) Start(ctx context.Context, logsWriter io.Writer) error {
+	port, err := shell.NextFreePort(5000 + rand.Intn(1000))
 	if err != nil {
 		return err
 	}
+	return p.StartOnPort(ctx, logsWriter, port)
+}
+
+// StartOnPort runs the model's HTTP server on the given host port and waits for it to be ready
+func (p *Predictor) StartOnPort(ctx context.Context, logsWriter io.Writer, port int) error {
+	var err error
+	p.port = port
 
 	containerPort := 5000
 
@@ -76,10 +114,10 @@ func (p *Predictor) Start(logsWriter io.Writer) error {
 		}
 	}()
 
-	return p.waitForContainerReady()
+	return p.waitForContainerReady(ctx)
 }
 
-func (p *Predictor) waitForContainerReady() error {
+func (p *Predictor) waitForContainerReady(ctx context.Context) error {
 	url := fmt.Sprintf("http://localhost:%d/", p.port)
 
 	start := time.Now()
@@ -89,7 +127,11 @@ func (p *Predictor) waitForContainerReady() error {
 			return fmt.Errorf("Timed out")
 		}
 
-		time.Sleep(100 * time.Millisecond)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
 
 		cont, err := docker.ContainerInspect(p.containerID)
 		if err != nil {
@@ -99,10 +141,11 @@ func (p *Predictor) waitForContainerReady() error {
 			return fmt.Errorf("Container exited unexpectedly")
 		}
 
-		resp, err := http.Get(url)
+		resp, err := p.httpClient.Get(url)
 		if err != nil {
 			continue
 		}
+		resp.Body.Close()
 		if resp.StatusCode != http.StatusOK {
 			continue
 		}
@@ -110,11 +153,36 @@ func (p *Predictor) waitForContainerReady() error {
 	}
 }
 
+// URL returns the address of the model's HTTP server on the host
+func (p *Predictor) URL() string {
+	return fmt.Sprintf("http://localhost:%d", p.port)
+}
+
+// IsRunning returns false if the container has exited. The container is removed when
+// it exits, so failing to inspect it also means it isn't running.
+func (p *Predictor) IsRunning() bool {
+	cont, err := docker.ContainerInspect(p.containerID)
+	if err != nil {
+		return false
+	}
+	return cont.State != nil && cont.State.Running
+}
+
+// ContainerID returns the ID of the model's container, or an empty string if it hasn't started
+func (p *Predictor) ContainerID() string {
+	return p.containerID
+}
+
 func (p *Predictor) Stop() error {
 	return docker.Stop(p.containerID)
 }
 
 func (p *Predictor) Predict(inputs Inputs) (*Response, error) {
+	return p.PredictWithContext(context.Background(), inputs)
+}
+
+// PredictWithContext runs a prediction, which is cancelled if ctx is done
+func (p *Predictor) PredictWithContext(ctx context.Context, inputs Inputs) (*Response, error) {
 	inputMap, err := inputs.toMap()
 	if err != nil {
 		return nil, err
@@ -126,15 +194,13 @@ func (p *Predictor) Predict(inputs Inputs) (*Response, error) {
 	}
 
 	url := fmt.Sprintf("http://localhost:%d/predictions", p.port)
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(requestBody))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(requestBody))
 	if err != nil {
 		return nil, fmt.Errorf("Failed to create HTTP request to %s: %w", url, err)
 	}
 	req.Header.Set("Content-Type", "application/json")
-	req.Close = true
 
-	httpClient := &http.Client{}
-	resp, err := httpClient.Do(req)
+	resp, err := p.httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to POST HTTP request to %s: %w", url, err)
 	}
@@ -160,11 +226,70 @@ func (p *Predictor) Predict(inputs Inputs) (*Response, error) {
 	return prediction, nil
 }
 
+// PredictAll runs a prediction for each of inputs, with up to parallelism predictions
+// running at once. The results come back on the returned channel in the same order as
+// inputs: each one is sent as soon as its prediction and the ones before it have finished,
+// and results that finish early are held until then. The channel is closed when they all
+// have, and must be read until it's closed. If ctx is cancelled, predictions that are
+// running are cancelled and the rest are not started.
+func (p *Predictor) PredictAll(ctx context.Context, inputs []Inputs, parallelism int) <-chan PredictionResult {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	finished := make(chan PredictionResult)
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < parallelism; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if err := ctx.Err(); err != nil {
+					finished <- PredictionResult{Index: i, Err: err}
+					continue
+				}
+				start := time.Now()
+				response, err := p.PredictWithContext(ctx, inputs[i])
+				finished <- PredictionResult{Index: i, Response: response, Err: err, Duration: time.Since(start)}
+			}
+		}()
+	}
+	go func() {
+		for i := range inputs {
+			indexes <- i
+		}
+		close(indexes)
+		wg.Wait()
+		close(finished)
+	}()
+
+	results := make(chan PredictionResult)
+	go func() {
+		defer close(results)
+		pending := map[int]PredictionResult{}
+		next := 0
+		for result := range finished {
+			pending[result.Index] = result
+			for {
+				result, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				results <- result
+				next++
+			}
+		}
+	}()
+	return results
+}
+
 func (p *Predictor) GetSchema() (*openapi3.T, error) {
-	resp, err := http.Get(fmt.Sprintf("http://localhost:%d/openapi.json", p.port))
+	resp, err := p.httpClient.Get(fmt.Sprintf("http://localhost:%d/openapi.json", p.port))
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("Failed to get OpenAPI schema: %d", resp.StatusCode)
 	}
@@ -187,7 +312,12 @@ func buildInputValidationErrorMessage(errorResponse *ValidationErrorResponse) er
 
 		errorMessages = append(errorMessages, fmt.Sprintf("- %s: %s", validationError.Location[2], validationError.Message))
 	}
+	return inputValidationError(errorMessages)
+}
 
+// inputValidationError explains what was wrong with the inputs, with a line for each
+// of errorMessages
+func inputValidationError(errorMessages []string) error {
 	return fmt.Errorf(
 		`The inputs you passed to cog predict could not be validated:
 
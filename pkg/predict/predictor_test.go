@@ -0,0 +1,84 @@
+package predict
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/docker"
+)
+
+func newTestPredictor(t *testing.T, handler http.HandlerFunc) Predictor {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	predictor := NewPredictor(docker.RunOptions{})
+	predictor.port, err = strconv.Atoi(u.Port())
+	require.NoError(t, err)
+	return predictor
+}
+
+func TestPredictAll(t *testing.T) {
+	var running, maxRunning int32
+	predictor := newTestPredictor(t, func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		request := Request{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		text := request.Input["text"].(string)
+		// Earlier inputs take longer, so they finish after later ones
+		time.Sleep(time.Duration('g'-text[0]) * 10 * time.Millisecond)
+		var output interface{} = text + "!"
+		require.NoError(t, json.NewEncoder(w).Encode(Response{Status: "succeeded", Output: &output}))
+	})
+
+	inputs := []Inputs{}
+	for _, text := range []string{"a", "b", "c", "d", "e", "f"} {
+		inputs = append(inputs, NewInputs(map[string]string{"text": text}))
+	}
+	// Results come back in the order of the inputs
+	outputs := []interface{}{}
+	for result := range predictor.PredictAll(context.Background(), inputs, 3) {
+		require.NoError(t, result.Err)
+		require.Equal(t, len(outputs), result.Index)
+		outputs = append(outputs, *result.Response.Output)
+	}
+	require.Equal(t, []interface{}{"a!", "b!", "c!", "d!", "e!", "f!"}, outputs)
+	require.LessOrEqual(t, maxRunning, int32(3))
+	require.Greater(t, maxRunning, int32(1))
+}
+
+func TestPredictAllCancelled(t *testing.T) {
+	// The server doesn't notice the client going away until it reads the request body, so
+	// unblock the handler when the test finishes
+	done := make(chan struct{})
+	predictor := newTestPredictor(t, func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	})
+	t.Cleanup(func() { close(done) })
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	inputs := []Inputs{NewInputs(map[string]string{}), NewInputs(map[string]string{})}
+	count := 0
+	for result := range predictor.PredictAll(ctx, inputs, 1) {
+		require.ErrorIs(t, result.Err, context.DeadlineExceeded)
+		count++
+	}
+	require.Equal(t, 2, count)
+}
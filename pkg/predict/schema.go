@@ -0,0 +1,147 @@
+package predict
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// InputField is one of the inputs of a model, from the Input object in its OpenAPI schema
+type InputField struct {
+	Name        string        `json:"name"`
+	Order       int           `json:"order"`
+	Type        string        `json:"type"`
+	Format      string        `json:"format,omitempty"`
+	Description string        `json:"description,omitempty"`
+	Default     interface{}   `json:"default,omitempty"`
+	Required    bool          `json:"required"`
+	Choices     []interface{} `json:"choices,omitempty"`
+	Minimum     *float64      `json:"minimum,omitempty"`
+	Maximum     *float64      `json:"maximum,omitempty"`
+	// Items is the type of the items of an array
+	Items *InputField `json:"items,omitempty"`
+}
+
+// InputFields returns the inputs in a model's schema in the order they're defined in
+// predict()
+func InputFields(schema *openapi3.T) ([]*InputField, error) {
+	inputRef, ok := schema.Components.Schemas["Input"]
+	if !ok || inputRef.Value == nil {
+		return nil, fmt.Errorf("The schema doesn't have an Input object")
+	}
+	input := inputRef.Value
+	required := map[string]bool{}
+	for _, name := range input.Required {
+		required[name] = true
+	}
+
+	fields := []*InputField{}
+	for name, propRef := range input.Properties {
+		if propRef.Value == nil {
+			continue
+		}
+		field := inputField(name, propRef.Value)
+		field.Required = required[name]
+		order, err := xOrder(propRef.Value)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read the order of input %s: %w", name, err)
+		}
+		field.Order = order
+		fields = append(fields, field)
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		if fields[i].Order != fields[j].Order {
+			return fields[i].Order < fields[j].Order
+		}
+		return fields[i].Name < fields[j].Name
+	})
+	return fields, nil
+}
+
+func inputField(name string, prop *openapi3.Schema) *InputField {
+	field := &InputField{
+		Name:        name,
+		Type:        prop.Type,
+		Format:      prop.Format,
+		Description: prop.Description,
+		Default:     prop.Default,
+		Choices:     prop.Enum,
+		Minimum:     prop.Min,
+		Maximum:     prop.Max,
+	}
+	// Inputs with choices refer to an enum defined elsewhere in the schema
+	for _, ref := range prop.AllOf {
+		if ref.Value == nil {
+			continue
+		}
+		if field.Type == "" {
+			field.Type = ref.Value.Type
+		}
+		if len(field.Choices) == 0 {
+			field.Choices = ref.Value.Enum
+		}
+	}
+	if prop.Items != nil && prop.Items.Value != nil {
+		field.Items = inputField("", prop.Items.Value)
+	}
+	return field
+}
+
+// xOrder returns the position of an input in predict(), which Cog adds to the schema
+// because the properties of an object aren't ordered
+func xOrder(prop *openapi3.Schema) (int, error) {
+	val, ok := prop.Extensions["x-order"]
+	if !ok {
+		return 0, nil
+	}
+	rawMsg, ok := val.(json.RawMessage)
+	if !ok {
+		return 0, nil
+	}
+	var order int
+	if err := json.Unmarshal(rawMsg, &order); err != nil {
+		return 0, err
+	}
+	return order, nil
+}
+
+// TypeName describes the type of an input, e.g. "file" or "array of integer"
+func (f *InputField) TypeName() string {
+	return typeName(f.Type, f.Format, f.Items)
+}
+
+// OutputTypeName describes the type of a model's output, from the Response object in its
+// OpenAPI schema
+func OutputTypeName(schema *openapi3.T) string {
+	responseRef, ok := schema.Components.Schemas["Response"]
+	if !ok || responseRef.Value == nil {
+		return ""
+	}
+	outputRef, ok := responseRef.Value.Properties["output"]
+	if !ok || outputRef.Value == nil {
+		return ""
+	}
+	output := outputRef.Value
+	if output.Type == "" && len(output.AllOf) == 1 && output.AllOf[0].Value != nil {
+		output = output.AllOf[0].Value
+	}
+	var items *InputField
+	if output.Items != nil && output.Items.Value != nil {
+		items = inputField("", output.Items.Value)
+	}
+	return typeName(output.Type, output.Format, items)
+}
+
+func typeName(typ string, format string, items *InputField) string {
+	switch {
+	case typ == "string" && format == "uri":
+		return "file"
+	case typ == "array" && items != nil:
+		return "array of " + items.TypeName()
+	case typ == "":
+		return "any"
+	}
+	return typ
+}
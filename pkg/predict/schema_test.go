@@ -0,0 +1,81 @@
+package predict
+
+import (
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/require"
+)
+
+// testSchema is the schema Cog generates for a predictor like:
+//
+//	def predict(self,
+//	        image: Path = Input(description="Image to enlarge"),
+//	        scale: float = Input(description="Factor to scale image by", default=1.5, ge=1, le=4),
+//	        mode: str = Input(default="fast", choices=["fast", "best"]),
+//	        seeds: List[int] = Input(default=None),
+//	) -> List[Path]:
+const testSchema = `{
+  "openapi": "3.0.2",
+  "info": {"title": "Cog", "version": "0.1.0"},
+  "paths": {},
+  "components": {
+    "schemas": {
+      "Input": {
+        "title": "Input",
+        "required": ["image"],
+        "type": "object",
+        "properties": {
+          "seeds": {"title": "Seeds", "type": "array", "items": {"type": "integer"}, "x-order": 3},
+          "mode": {"allOf": [{"$ref": "#/components/schemas/mode"}], "default": "fast", "x-order": 2},
+          "scale": {"title": "Scale", "type": "number", "description": "Factor to scale image by", "default": 1.5, "minimum": 1, "maximum": 4, "x-order": 1},
+          "image": {"title": "Image", "type": "string", "format": "uri", "description": "Image to enlarge", "x-order": 0}
+        }
+      },
+      "mode": {"title": "mode", "enum": ["fast", "best"], "type": "string", "description": "An enumeration."},
+      "Output": {"title": "Output", "type": "array", "items": {"type": "string", "format": "uri"}},
+      "Response": {
+        "title": "Response",
+        "type": "object",
+        "properties": {
+          "status": {"type": "string"},
+          "output": {"$ref": "#/components/schemas/Output"}
+        }
+      }
+    }
+  }
+}`
+
+func loadTestSchema(t *testing.T) *openapi3.T {
+	schema, err := openapi3.NewLoader().LoadFromData([]byte(testSchema))
+	require.NoError(t, err)
+	return schema
+}
+
+func TestInputFields(t *testing.T) {
+	fields, err := InputFields(loadTestSchema(t))
+	require.NoError(t, err)
+	require.Len(t, fields, 4)
+
+	image, scale, mode, seeds := fields[0], fields[1], fields[2], fields[3]
+	require.Equal(t, "image", image.Name)
+	require.True(t, image.Required)
+	require.Equal(t, "file", image.TypeName())
+	require.Equal(t, "Image to enlarge", image.Description)
+
+	require.Equal(t, "scale", scale.Name)
+	require.False(t, scale.Required)
+	require.Equal(t, 1.5, scale.Default)
+	require.Equal(t, 1.0, *scale.Minimum)
+	require.Equal(t, 4.0, *scale.Maximum)
+
+	require.Equal(t, "mode", mode.Name)
+	require.Equal(t, "string", mode.TypeName())
+	require.Equal(t, []interface{}{"fast", "best"}, mode.Choices)
+
+	require.Equal(t, "array of integer", seeds.TypeName())
+}
+
+func TestOutputTypeName(t *testing.T) {
+	require.Equal(t, "array of file", OutputTypeName(loadTestSchema(t)))
+}
@@ -2,10 +2,14 @@
 package console
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/logrusorgru/aurora"
 )
@@ -87,6 +91,11 @@ func (c *Console) log(level Level, msg string) {
 		return
 	}
 
+	if c.IsMachine {
+		c.logJSON(level, msg)
+		return
+	}
+
 	prompt := ""
 	formattedMsg := msg
 
@@ -111,3 +120,90 @@ func (c *Console) log(level Level, msg string) {
 		fmt.Fprintln(os.Stderr, line)
 	}
 }
+
+// logJSON writes a message as a line of JSON, so stderr can be parsed as newline-delimited JSON in machine mode
+func (c *Console) logJSON(level Level, msg string) {
+	line, err := json.Marshal(logEvent{
+		Time:    time.Now().UTC().Format(time.RFC3339Nano),
+		Level:   level.String(),
+		Message: msg,
+	})
+	if err != nil {
+		line = []byte(fmt.Sprintf(`{"level":"error","message":%q}`, err.Error()))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintln(os.Stderr, string(line))
+}
+
+// OutputJSON writes v to stdout as a single line of JSON. It is the primary output of a command in machine mode.
+func (c *Console) OutputJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	c.Output(string(data))
+	return nil
+}
+
+// LogWriter returns a writer for the output of subprocesses and containers. Usually this
+// is just stderr, so subprocesses can tell they are writing to a terminal, but in machine
+// mode each line written to it is logged at level so stderr stays newline-delimited JSON.
+// Call done when finished writing to log a final line that doesn't end in a newline.
+func (c *Console) LogWriter(level Level) (w io.Writer, done func()) {
+	if !c.IsMachine {
+		return os.Stderr, func() {}
+	}
+	lw := &lineWriter{console: c, level: level}
+	return lw, lw.flush
+}
+
+type logEvent struct {
+	Time    string `json:"time"`
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+// lineWriter logs each line written to it
+type lineWriter struct {
+	console *Console
+	level   Level
+	buf     []byte
+	mu      sync.Mutex
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i == -1 {
+			break
+		}
+		w.logLine(w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+func (w *lineWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf) > 0 {
+		w.logLine(w.buf)
+		w.buf = nil
+	}
+}
+
+func (w *lineWriter) logLine(line []byte) {
+	// Progress output uses carriage returns to redraw the line, so only log the last of them
+	if i := bytes.LastIndexByte(bytes.TrimRight(line, "\r"), '\r'); i != -1 {
+		line = line[i+1:]
+	}
+	line = bytes.TrimRight(line, "\r")
+	if len(line) > 0 {
+		w.console.log(w.level, string(line))
+	}
+}
@@ -1,6 +1,7 @@
 package console
 
 import (
+	"io"
 	"os"
 
 	"github.com/mattn/go-isatty"
@@ -23,6 +24,16 @@ func SetColor(color bool) {
 	ConsoleInstance.Color = color
 }
 
+// SetMachine sets whether to output machine-readable JSON instead of text for humans
+func SetMachine(machine bool) {
+	ConsoleInstance.IsMachine = machine
+}
+
+// IsMachine returns true if output is machine-readable JSON
+func IsMachine() bool {
+	return ConsoleInstance.IsMachine
+}
+
 // Debug level message.
 func Debug(msg string) {
 	ConsoleInstance.Debug(msg)
@@ -78,6 +89,16 @@ func Output(s string) {
 	ConsoleInstance.Output(s)
 }
 
+// OutputJSON writes v to stdout as a single line of JSON.
+func OutputJSON(v interface{}) error {
+	return ConsoleInstance.OutputJSON(v)
+}
+
+// LogWriter returns a writer for the output of subprocesses and containers.
+func LogWriter(level Level) (w io.Writer, done func()) {
+	return ConsoleInstance.LogWriter(level)
+}
+
 // IsTTY checks if a file is a TTY or not. E.g. IsTTY(os.Stdin)
 func IsTTY(f *os.File) bool {
 	return isatty.IsTerminal(f.Fd())
@@ -15,6 +15,9 @@ type Interactive struct {
 	Default  string
 	Options  []string
 	Required bool
+	// Complete returns the values that what has been typed can be completed to when tab
+	// is pressed, if stdin is a terminal
+	Complete func(text string) []string
 }
 
 func (i Interactive) Read() (string, error) {
@@ -43,9 +46,7 @@ func (i Interactive) Read() (string, error) {
 	}
 
 	for {
-		fmt.Printf("%s%s: ", i.Prompt, parens)
-		reader := bufio.NewReader(os.Stdin)
-		text, err := reader.ReadString('\n')
+		text, err := readLine(fmt.Sprintf("%s%s: ", i.Prompt, parens), i.Complete)
 		if err != nil {
 			return "", err
 		}
@@ -0,0 +1,146 @@
+package console
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/moby/term"
+)
+
+// ErrInterrupted is returned when Ctrl-C is pressed while a line is being read. The
+// terminal is in raw mode then, so it doesn't send a signal.
+var ErrInterrupted = errors.New("Interrupted")
+
+const (
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyBackspace = 8
+	keyTab       = 9
+	keyNewline   = 10
+	keyEnter     = 13
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+// readLine prints prompt and reads a line from stdin. If stdin is a terminal and complete
+// isn't nil, pressing tab completes the line with the values complete returns for it.
+func readLine(prompt string, complete func(line string) []string) (string, error) {
+	fd := os.Stdin.Fd()
+	if complete != nil && term.IsTerminal(fd) {
+		if state, err := term.MakeRaw(fd); err == nil {
+			defer func() {
+				_ = term.RestoreTerminal(fd, state)
+			}()
+			return editLine(os.Stdin, os.Stdout, prompt, complete)
+		}
+	}
+	fmt.Print(prompt)
+	reader := bufio.NewReader(os.Stdin)
+	text, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(text, "\r\n"), nil
+}
+
+// editLine reads a line from a terminal in raw mode, echoing it to out. It handles
+// backspace and tab completion. Other control keys, like arrow keys, are ignored.
+func editLine(in io.Reader, out io.Writer, prompt string, complete func(line string) []string) (string, error) {
+	fmt.Fprint(out, prompt)
+	line := ""
+	// Read a byte at a time, so nothing after the line is consumed
+	buf := make([]byte, 1)
+	readByte := func() (byte, error) {
+		if _, err := io.ReadFull(in, buf); err != nil {
+			return 0, err
+		}
+		return buf[0], nil
+	}
+
+	for {
+		b, err := readByte()
+		if err != nil {
+			return "", err
+		}
+		switch b {
+		case keyEnter, keyNewline:
+			fmt.Fprint(out, "\r\n")
+			return line, nil
+
+		case keyCtrlC:
+			fmt.Fprint(out, "^C\r\n")
+			return "", ErrInterrupted
+
+		case keyCtrlD:
+			if line == "" {
+				fmt.Fprint(out, "\r\n")
+				return "", io.EOF
+			}
+
+		case keyBackspace, keyDelete:
+			if line != "" {
+				_, size := utf8.DecodeLastRuneInString(line)
+				line = line[:len(line)-size]
+				fmt.Fprint(out, "\b \b")
+			}
+
+		case keyTab:
+			candidates := complete(line)
+			switch {
+			case len(candidates) == 0:
+				fmt.Fprint(out, "\a")
+			case len(candidates) == 1:
+				line = candidates[0]
+			default:
+				if prefix := commonPrefix(candidates); len(prefix) > len(line) {
+					line = prefix
+				} else {
+					fmt.Fprintf(out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+				}
+			}
+			// Redraw the line, clearing anything left over from before
+			fmt.Fprintf(out, "\r%s%s\x1b[K", prompt, line)
+
+		case keyEscape:
+			// Skip escape sequences, like the ones arrow keys send: ESC [ or O, any
+			// parameters, then a final byte from @ to ~
+			next, err := readByte()
+			if err != nil {
+				return "", err
+			}
+			if next == '[' || next == 'O' {
+				for {
+					c, err := readByte()
+					if err != nil {
+						return "", err
+					}
+					if c >= '@' && c <= '~' {
+						break
+					}
+				}
+			}
+
+		default:
+			// Multibyte characters are added a byte at a time
+			if b >= ' ' {
+				line += string([]byte{b})
+				_, _ = out.Write([]byte{b})
+			}
+		}
+	}
+}
+
+func commonPrefix(values []string) string {
+	prefix := values[0]
+	for _, v := range values[1:] {
+		for !strings.HasPrefix(v, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
@@ -0,0 +1,38 @@
+package console
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEditLine(t *testing.T) {
+	complete := func(line string) []string {
+		var matches []string
+		for _, v := range []string{"@input.jpg", "@input.png", "@other.txt"} {
+			if strings.HasPrefix(v, line) {
+				matches = append(matches, v)
+			}
+		}
+		return matches
+	}
+	var out bytes.Buffer
+
+	// Tab completes as far as the matches have in common, then another character picks one
+	line, err := editLine(strings.NewReader("@i\tp\t\r"), &out, "> ", complete)
+	require.NoError(t, err)
+	require.Equal(t, "@input.png", line)
+
+	// Backspace removes whole characters, and arrow keys are ignored
+	line, err = editLine(strings.NewReader("café\x7f\x7fe\x1b[D\r"), &out, "> ", complete)
+	require.NoError(t, err)
+	require.Equal(t, "cae", line)
+
+	_, err = editLine(strings.NewReader("abc\x03"), &out, "> ", complete)
+	require.ErrorIs(t, err, ErrInterrupted)
+	_, err = editLine(strings.NewReader("\x04"), &out, "> ", complete)
+	require.ErrorIs(t, err, io.EOF)
+}
@@ -0,0 +1,86 @@
+package shell
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// InterruptContext returns a context that is cancelled the first time the process gets
+// SIGINT or SIGTERM, so the command can clean up before exiting. If another signal
+// arrives while it is cleaning up, onForce is called and the process exits immediately.
+//
+// Call stop once cleanup has finished to restore the default signal handling.
+func InterruptContext(onForce func()) (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case sig := <-signals:
+			console.Debugf("Received %s", sig)
+			console.Info("Stopping... Press Ctrl-C again to exit immediately.")
+			cancel()
+		case <-done:
+			return
+		}
+		select {
+		case <-signals:
+			console.Warn("Exiting immediately")
+			if onForce != nil {
+				onForce()
+			}
+			os.Exit(130)
+		case <-done:
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		close(done)
+		cancel()
+	}
+}
+
+// RunInterruptible runs cmd, sending it SIGINT if ctx is cancelled so it has a chance to
+// exit cleanly. It is killed if it is still running after timeout.
+func RunInterruptible(ctx context.Context, cmd *exec.Cmd, timeout time.Duration) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	exited := make(chan struct{})
+	defer close(exited)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-exited:
+			return
+		}
+		console.Debugf("Interrupting %s", cmd.Path)
+		// Interrupt isn't supported on Windows, so fall back to killing it
+		if err := cmd.Process.Signal(os.Interrupt); err != nil {
+			_ = cmd.Process.Kill()
+			return
+		}
+		select {
+		case <-time.After(timeout):
+			console.Debugf("%s did not exit after %s, killing it", cmd.Path, timeout)
+			_ = cmd.Process.Kill()
+		case <-exited:
+		}
+	}()
+
+	err := cmd.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
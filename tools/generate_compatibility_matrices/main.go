@@ -168,11 +168,15 @@ func getCUDABaseImageTags(url string) ([]string, error) {
 
 func writeCUDABaseImageTags(outputPath string) error {
 	console.Infof("Writing CUDA base images to %s...", outputPath)
-	url := "https://hub.docker.com/v2/repositories/nvidia/cuda/tags/?page_size=1000&name=devel-ubuntu&ordering=last_updated"
-
-	tags, err := getCUDABaseImageTags(url)
-	if err != nil {
-		return err
+	// devel images are used to build models, and runtime images for the final stage of slim builds
+	tags := []string{}
+	for _, flavor := range []string{"devel", "runtime"} {
+		url := "https://hub.docker.com/v2/repositories/nvidia/cuda/tags/?page_size=1000&name=" + flavor + "-ubuntu&ordering=last_updated"
+		flavorTags, err := getCUDABaseImageTags(url)
+		if err != nil {
+			return err
+		}
+		tags = append(tags, flavorTags...)
 	}
 
 	sort.Sort(sort.Reverse(sort.StringSlice(tags)))